@@ -19,9 +19,11 @@ var (
 
 func main() {
 	status := make(chan regolith.UpdateStatus)
+	regolith.Version = version
 	go regolith.CheckUpdate(version, status)
 	regolith.CustomHelp()
 	var debug bool
+	var output string
 	err := (&cli.App{
 		Name:                 "Regolith",
 		Usage:                "A bedrock addon compiler pipeline",
@@ -41,6 +43,16 @@ func main() {
 				Usage:       "Enables debugging.",
 				Destination: &debug,
 			},
+			&cli.StringFlag{
+				Name:  "output",
+				Value: regolith.TextOutputFormat,
+				Usage: "Sets the output format. Use \"json\" to print the " +
+					"output as newline-delimited JSON objects.",
+				Destination: &output,
+			},
+		},
+		Before: func(c *cli.Context) error {
+			return regolith.SetOutputFormat(output)
 		},
 		Commands: []*cli.Command{
 			{
@@ -53,7 +65,22 @@ func main() {
 					if len(args) != 0 {
 						profile = args[0]
 					}
-					return regolith.Run(profile, recycled, debug)
+					variables, err := regolith.ParseRunVariables(
+						c.StringSlice("var"))
+					if err != nil {
+						return err
+					}
+					return regolith.RunWithOptions(
+						profile, recycled, debug, regolith.RunOptions{
+							ManifestVersion: c.String("manifest-version"),
+							Variables:       variables,
+							Filters:         c.StringSlice("filter"),
+							From:            c.String("from"),
+							Until:           c.String("until"),
+							SaveSnapshots:   c.Bool("snapshots"),
+							ReuseSnapshot:   c.Bool("reuse-snapshot"),
+							Trace:           c.Bool("trace"),
+						})
 				},
 				Flags: []cli.Flag{
 					&cli.BoolFlag{
@@ -61,6 +88,39 @@ func main() {
 						Aliases: []string{"r"},
 						Usage:   "Uses different \"recycled\" function for moving files, might be faster in some cases. Not recommended.",
 					},
+					&cli.StringFlag{
+						Name:  "manifest-version",
+						Usage: "Sets the version of the packs and their modules in the manifest.json files (\"major.minor.patch\" or \"gitTag\"). Overrides the \"manifest\" property of the profile.",
+					},
+					&cli.StringSliceFlag{
+						Name:    "var",
+						Aliases: []string{"v"},
+						Usage:   "Sets a variable used by the \"when\" expressions of the filters (\"name=value\"). Can be used multiple times.",
+					},
+					&cli.StringSliceFlag{
+						Name:  "filter",
+						Usage: "Runs only the filters of the profile with this name. Can be used multiple times.",
+					},
+					&cli.StringFlag{
+						Name:  "from",
+						Usage: "Skips the filters of the profile before the first filter with this name.",
+					},
+					&cli.StringFlag{
+						Name:  "until",
+						Usage: "Skips the filters of the profile after the first filter with this name.",
+					},
+					&cli.BoolFlag{
+						Name:  "snapshots",
+						Usage: "Saves a copy of the tmp directory after every filter of the profile, so it can be reused with \"--reuse-snapshot\".",
+					},
+					&cli.BoolFlag{
+						Name:  "reuse-snapshot",
+						Usage: "Starts from the snapshot of the tmp directory saved before the first filter that runs, instead of copying the source files.",
+					},
+					&cli.BoolFlag{
+						Name:  "trace",
+						Usage: "Saves the state of the tmp directory after every filter of the profile, so the changes can be inspected with \"regolith trace\".",
+					},
 				},
 			},
 			{
@@ -73,7 +133,16 @@ func main() {
 					if len(args) != 0 {
 						profile = args[0]
 					}
-					return regolith.Watch(profile, recycled, debug)
+					variables, err := regolith.ParseRunVariables(
+						c.StringSlice("var"))
+					if err != nil {
+						return err
+					}
+					return regolith.WatchWithOptions(
+						profile, recycled, debug, regolith.RunOptions{
+							ManifestVersion: c.String("manifest-version"),
+							Variables:       variables,
+						})
 				},
 				Flags: []cli.Flag{
 					&cli.BoolFlag{
@@ -81,6 +150,15 @@ func main() {
 						Aliases: []string{"r"},
 						Usage:   "Uses different \"recycled\" function for moving files, might be faster in some cases. Not recommended.",
 					},
+					&cli.StringFlag{
+						Name:  "manifest-version",
+						Usage: "Sets the version of the packs and their modules in the manifest.json files (\"major.minor.patch\" or \"gitTag\"). Overrides the \"manifest\" property of the profile.",
+					},
+					&cli.StringSliceFlag{
+						Name:    "var",
+						Aliases: []string{"v"},
+						Usage:   "Sets a variable used by the \"when\" expressions of the filters (\"name=value\"). Can be used multiple times.",
+					},
 				},
 			},
 			{
@@ -97,7 +175,22 @@ func main() {
 				Usage: `It updates all of the filters listed in the
 				filtersDefinitions which aren't version locked.`,
 				Action: func(c *cli.Context) error {
-					return regolith.UpdateAll(debug)
+					return regolith.UpdateAll(c.Bool("major"), debug)
+				},
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "major",
+						Usage: "Updates the filters with semver ranges to the latest versions, even if they're outside of the ranges, and saves the new ranges in the config file.",
+					},
+				},
+			},
+			{
+				Name: "outdated",
+				Usage: "Lists the installed, pinned, latest and HEAD versions " +
+					"of the remote filters without downloading them. Exits " +
+					"with a non-zero status code if updates are available.",
+				Action: func(c *cli.Context) error {
+					return regolith.Outdated(debug)
 				},
 			},
 			{
@@ -105,7 +198,8 @@ func main() {
 				Usage: `Installs all of the filters from filtersDefintions of config.json file and their dependencies.`,
 				Action: func(c *cli.Context) error {
 					force := c.Bool("force")
-					return regolith.InstallAll(force, debug)
+					offline := c.Bool("offline")
+					return regolith.InstallAll(force, offline, debug)
 				},
 				Flags: []cli.Flag{
 					&cli.BoolFlag{
@@ -113,6 +207,10 @@ func main() {
 						Aliases: []string{"f"},
 						Usage:   "Force the operation, overriding potential safeguards.",
 					},
+					&cli.BoolFlag{
+						Name:  "offline",
+						Usage: "Installs the filters without network access, using the versions from regolith.lock and the files from the filter store shared by the projects.",
+					},
 				},
 			},
 			{
@@ -172,6 +270,80 @@ func main() {
 					},
 				},
 			},
+			{
+				Name: "validate",
+				Usage: "Checks the config.json file and prints all of the " +
+					"problems found in it. Exits with a non-zero status code " +
+					"if there are any problems.",
+				Action: func(c *cli.Context) error {
+					return regolith.Validate(debug)
+				},
+			},
+			{
+				Name:  "config",
+				Usage: "Shows the configuration of the project.",
+				Subcommands: []*cli.Command{
+					{
+						Name: "show",
+						Usage: "Prints the effective configuration of the " +
+							"profile, with the profiles that it extends " +
+							"merged into it.",
+						ArgsUsage: "[profile]",
+						Action: func(c *cli.Context) error {
+							return regolith.ConfigShow(c.Args().First(), debug)
+						},
+					},
+				},
+			},
+			{
+				Name: "trace",
+				Usage: "Lists the stages of the trace saved by the last run " +
+					"with the \"--trace\" flag.",
+				Action: func(c *cli.Context) error {
+					return regolith.Trace(debug)
+				},
+				Subcommands: []*cli.Command{
+					{
+						Name: "file",
+						Usage: "Shows which filters created, modified or " +
+							"deleted the file. The path is relative to the " +
+							"tmp directory, for example \"BP/manifest.json\".",
+						ArgsUsage: "<path>",
+						Action: func(c *cli.Context) error {
+							return regolith.TraceFile(c.Args().First(), debug)
+						},
+					},
+					{
+						Name: "diff",
+						Usage: "Lists the files changed between two stages " +
+							"of the trace, or shows the differences of the " +
+							"file if its path is specified. The stages are " +
+							"identified by their numbers or by the names of " +
+							"their filters.",
+						ArgsUsage: "<stage> <stage> [path]",
+						Action: func(c *cli.Context) error {
+							return regolith.TraceDiff(
+								c.Args().Get(0), c.Args().Get(1),
+								c.Args().Get(2), debug)
+						},
+					},
+				},
+			},
+			{
+				Name:  "cache",
+				Usage: "Manages the filter store shared by the projects.",
+				Subcommands: []*cli.Command{
+					{
+						Name: "prune",
+						Usage: "Removes the filters from the filter store " +
+							"that aren't locked in regolith.lock of any " +
+							"project that installed them.",
+						Action: func(c *cli.Context) error {
+							return regolith.CachePrune(debug)
+						},
+					},
+				},
+			},
 			{
 				Name:  "unlock",
 				Usage: "Unlocks Regolith, to enable use of Remote and Local filters.",
@@ -182,7 +354,8 @@ func main() {
 		},
 	}).Run(os.Args)
 	if err != nil {
-		regolith.Logger.Error(err)
+		regolith.InitLogging(debug)
+		regolith.LogError(err)
 		os.Exit(1)
 	} else {
 		regolith.InitLogging(false)
@@ -193,7 +366,13 @@ func main() {
 		regolith.Logger.Warn("Update check failed")
 		regolith.Logger.Debug(*result.Err)
 	} else if result.ShouldUpdate {
-		_, _ = fmt.Fprintln(color.Output, color.GreenString("New version available!"))
-		_, _ = fmt.Fprintln(color.Output, color.GreenString(*result.Url))
+		if regolith.IsJsonOutput() {
+			regolith.Logger.Infow(
+				"New version available!",
+				"event", "update_available", "url", *result.Url)
+		} else {
+			_, _ = fmt.Fprintln(color.Output, color.GreenString("New version available!"))
+			_, _ = fmt.Fprintln(color.Output, color.GreenString(*result.Url))
+		}
 	}
 }
@@ -0,0 +1,135 @@
+package regolith
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// comMojangEnvVar is the name of the environment variable that
+	// overrides the path to the com.mojang directory.
+	comMojangEnvVar = "REGOLITH_COM_MOJANG"
+
+	// comMojangPreviewEnvVar is the name of the environment variable that
+	// overrides the path to the com.mojang directory of Minecraft Preview.
+	comMojangPreviewEnvVar = "REGOLITH_COM_MOJANG_PREVIEW"
+)
+
+// comMojangCandidate is a path that possibly leads to the com.mojang
+// directory, together with the description of where it comes from.
+type comMojangCandidate struct {
+	Path   string
+	Source string
+}
+
+// FindMojangDir returns path to the com.mojang folder.
+func FindMojangDir() (string, error) {
+	return findComMojangDir(false)
+}
+
+// FindPreviewDir returns path to the com.mojang folder of Minecraft Preview.
+func FindPreviewDir() (string, error) {
+	return findComMojangDir(true)
+}
+
+// findComMojangDir looks for the com.mojang directory. The path set with
+// the environment variable or in the user config takes precedence over the
+// paths known for this system. The function logs which path was chosen and
+// returns an error that lists all of the rejected paths if none of them
+// is valid.
+func findComMojangDir(preview bool) (string, error) {
+	envVar, settingName := comMojangEnvVar, "comMojangPath"
+	if preview {
+		envVar, settingName = comMojangPreviewEnvVar, "comMojangPreviewPath"
+	}
+	// Check the overrides first. If the user set the path explicitly, it
+	// must be valid. Silently falling back to other paths would be confusing.
+	var overrides []comMojangCandidate
+	if path := os.Getenv(envVar); path != "" {
+		overrides = append(overrides, comMojangCandidate{
+			Path:   path,
+			Source: fmt.Sprintf("%s environment variable", envVar),
+		})
+	}
+	userConfig, err := LoadUserConfig()
+	if err != nil {
+		Logger.Warnf(
+			"Unable to load the user config.\n%s", err.Error())
+	}
+	settingPath := userConfig.ComMojangPath
+	if preview {
+		settingPath = userConfig.ComMojangPreviewPath
+	}
+	if settingPath != "" {
+		overrides = append(overrides, comMojangCandidate{
+			Path:   settingPath,
+			Source: fmt.Sprintf("%q in %s", settingName, userConfigFileName),
+		})
+	}
+	if len(overrides) > 0 {
+		override := overrides[0]
+		if reason := checkComMojangCandidate(override.Path); reason != "" {
+			return "", WrappedErrorf(
+				"The com.mojang path set by the user is invalid.\n"+
+					"Path: %s\nSource: %s\nReason: %s",
+				override.Path, override.Source, reason)
+		}
+		Logger.Infof(
+			"Using com.mojang path %q from %s.",
+			override.Path, override.Source)
+		return override.Path, nil
+	}
+	// Check the paths known for this system
+	candidates := comMojangCandidates(preview)
+	rejected := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		reason := checkComMojangCandidate(candidate.Path)
+		if reason == "" {
+			for _, r := range rejected {
+				Logger.Debugf("Rejected com.mojang path: %s", r)
+			}
+			Logger.Infof(
+				"Using com.mojang path %q (%s).",
+				candidate.Path, candidate.Source)
+			return candidate.Path, nil
+		}
+		rejected = append(rejected, fmt.Sprintf(
+			"%s (%s): %s", candidate.Path, candidate.Source, reason))
+	}
+	userConfigPath, _ := GetRegolithConfigPath()
+	return "", WrappedErrorf(
+		"Unable to find the com.mojang directory.\n"+
+			"Checked paths:\n%s\n"+
+			"You can set the path manually with the %s environment "+
+			"variable or with the %q property of the %q file.",
+		formatRejectedComMojangPaths(rejected), envVar, settingName,
+		filepath.Join(userConfigPath, userConfigFileName))
+}
+
+// checkComMojangCandidate checks whether the path can be used as the
+// com.mojang directory. It returns an empty string if the path is valid or
+// the reason why it's rejected.
+func checkComMojangCandidate(path string) string {
+	stat, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "the path doesn't exist"
+		}
+		return fmt.Sprintf("failed to access the path (%s)", err.Error())
+	}
+	if !stat.IsDir() {
+		return "the path is not a directory"
+	}
+	return ""
+}
+
+// formatRejectedComMojangPaths formats the list of the rejected candidates
+// for the error message.
+func formatRejectedComMojangPaths(rejected []string) string {
+	if len(rejected) == 0 {
+		return " - none (no known locations for this system)"
+	}
+	return " - " + strings.Join(rejected, "\n - ")
+}
@@ -3,6 +3,15 @@
 
 package regolith
 
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
 // venvScriptsPath is a folder name between "venv" and "python" that leads to
 // the python executable.
 const venvScriptsPath = "bin"
@@ -19,31 +28,111 @@ func copyFileSecurityInfo(source string, target string) error {
 	return nil
 }
 
-type DirWatcher struct{}
-
-func NewDirWatcher(path string) (*DirWatcher, error) {
-	return nil, WrappedError(notImplementedOnThisSystemError)
-}
-
-func (d *DirWatcher) WaitForChange() error {
-	return WrappedError(notImplementedOnThisSystemError)
+// comMojangCandidates returns the list of the paths where the com.mojang
+// directory can be found on this system. Minecraft doesn't support Linux and
+// macOS officially, so the list contains the paths used by the unofficial
+// launchers (mcpelauncher, including its Flatpak version) and the Windows
+// version running in Wine or Proton.
+func comMojangCandidates(preview bool) []comMojangCandidate {
+	var result []comMojangCandidate
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return result
+	}
+	// mcpelauncher doesn't have a separate directory for the preview
+	// version of the game
+	if !preview && runtime.GOOS == "darwin" {
+		result = append(result, comMojangCandidate{
+			Path: filepath.Join(
+				home, "Library", "Application Support", "mcpelauncher",
+				"games", "com.mojang"),
+			Source: "mcpelauncher",
+		})
+	} else if !preview {
+		dataHome := os.Getenv("XDG_DATA_HOME")
+		if dataHome == "" {
+			dataHome = filepath.Join(home, ".local", "share")
+		}
+		result = append(result,
+			comMojangCandidate{
+				Path: filepath.Join(
+					dataHome, "mcpelauncher", "games", "com.mojang"),
+				Source: "mcpelauncher",
+			},
+			comMojangCandidate{
+				Path: filepath.Join(
+					home, ".var", "app", "io.mrarm.mcpelauncher", "data",
+					"mcpelauncher", "games", "com.mojang"),
+				Source: "mcpelauncher (Flatpak)",
+			},
+		)
+	}
+	// Windows version of the game running in Wine or Proton
+	packageName := "Microsoft.MinecraftUWP_8wekyb3d8bbwe"
+	if preview {
+		packageName = "Microsoft.MinecraftWindowsBeta_8wekyb3d8bbwe"
+	}
+	var prefixes []comMojangCandidate
+	if winePrefix := os.Getenv("WINEPREFIX"); winePrefix != "" {
+		prefixes = append(prefixes, comMojangCandidate{
+			Path: winePrefix, Source: "Wine prefix from WINEPREFIX"})
+	}
+	prefixes = append(prefixes, comMojangCandidate{
+		Path: filepath.Join(home, ".wine"), Source: "default Wine prefix"})
+	prefixGlobs := []comMojangCandidate{
+		{
+			Path:   filepath.Join(home, ".local", "share", "wineprefixes", "*"),
+			Source: "Wine prefix",
+		},
+		{
+			Path: filepath.Join(
+				home, ".steam", "steam", "steamapps", "compatdata", "*", "pfx"),
+			Source: "Proton prefix",
+		},
+		{
+			Path: filepath.Join(
+				home, ".local", "share", "Steam", "steamapps", "compatdata",
+				"*", "pfx"),
+			Source: "Proton prefix",
+		},
+	}
+	for _, prefixGlob := range prefixGlobs {
+		matches, _ := filepath.Glob(prefixGlob.Path)
+		for _, match := range matches {
+			prefixes = append(prefixes, comMojangCandidate{
+				Path: match, Source: prefixGlob.Source})
+		}
+	}
+	for _, prefix := range prefixes {
+		pattern := filepath.Join(
+			prefix.Path, "drive_c", "users", "*", "AppData", "Local",
+			"Packages", packageName, "LocalState", "games", "com.mojang")
+		matches, _ := filepath.Glob(pattern)
+		if len(matches) == 0 {
+			// Report the path of a typical user to explain the rejection
+			matches = []string{strings.Replace(
+				pattern, "*", os.Getenv("USER"), 1)}
+		}
+		for _, match := range matches {
+			result = append(result, comMojangCandidate{
+				Path: match, Source: prefix.Source})
+		}
+	}
+	return result
 }
 
-func (d *DirWatcher) WaitForChangeGroup(
-	groupTimeout uint32, interruptionChannel chan string,
-	interruptionMessage string,
-) error {
-	return WrappedError(notImplementedOnThisSystemError)
+// setProcessGroup makes the command start in a new process group, so it can
+// be killed together with its children.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 }
 
-func (d *DirWatcher) Close() error {
-	return WrappedError(notImplementedOnThisSystemError)
-}
-
-func FindMojangDir() (string, error) {
-	return "", WrappedError(notImplementedOnThisSystemError)
-}
+// setCommandLine does nothing on the operating systems other than Windows,
+// because the arguments are passed to the processes separately.
+func setCommandLine(cmd *exec.Cmd, commandLine string) {}
 
-func FindPreviewDir() (string, error) {
-	return "", WrappedError(notImplementedOnThisSystemError)
+// killProcessTree kills the process group of a process started with
+// setProcessGroup.
+func killProcessTree(process *os.Process) error {
+	return syscall.Kill(-process.Pid, syscall.SIGKILL)
 }
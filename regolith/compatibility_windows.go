@@ -5,7 +5,10 @@ package regolith
 
 import (
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
+	"syscall"
 
 	"golang.org/x/sys/windows"
 )
@@ -138,32 +141,36 @@ func (d *DirWatcher) Close() error {
 	return windows.CloseHandle(d.handle)
 }
 
-// FindMojangDir returns path to the com.mojang folder.
-func FindMojangDir() (string, error) {
-	result := filepath.Join(
-		os.Getenv("LOCALAPPDATA"), "Packages",
-		"Microsoft.MinecraftUWP_8wekyb3d8bbwe", "LocalState", "games",
-		"com.mojang")
-	if _, err := os.Stat(result); err != nil {
-		if os.IsNotExist(err) {
-			return "", WrapErrorf(err, osStatErrorIsNotExist, result)
-		}
-		return "", WrapErrorf(err, osStatErrorAny, result)
+// comMojangCandidates returns the list of the paths where the com.mojang
+// directory can be found on Windows.
+func comMojangCandidates(preview bool) []comMojangCandidate {
+	packageName := "Microsoft.MinecraftUWP_8wekyb3d8bbwe"
+	if preview {
+		packageName = "Microsoft.MinecraftWindowsBeta_8wekyb3d8bbwe"
 	}
-	return result, nil
+	return []comMojangCandidate{{
+		Path: filepath.Join(
+			os.Getenv("LOCALAPPDATA"), "Packages", packageName,
+			"LocalState", "games", "com.mojang"),
+		Source: "Microsoft Store installation",
+	}}
 }
 
-func FindPreviewDir() (string, error) {
-	result := filepath.Join(
-		os.Getenv("LOCALAPPDATA"), "Packages",
-		"Microsoft.MinecraftWindowsBeta_8wekyb3d8bbwe", "LocalState", "games",
-		"com.mojang")
-	if _, err := os.Stat(result); err != nil {
-		if os.IsNotExist(err) {
-			return "", WrapErrorf(err, osStatErrorIsNotExist, result)
-		}
-		return "", WrapErrorf(
-			err, osStatErrorAny, result)
+// setProcessGroup does nothing on Windows. The children of a process are
+// found by killProcessTree.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// setCommandLine sets the command line of the process, which is passed to
+// the process without escaping its arguments.
+func setCommandLine(cmd *exec.Cmd, commandLine string) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
 	}
-	return result, nil
+	cmd.SysProcAttr.CmdLine = commandLine
+}
+
+// killProcessTree kills the process and all of its children.
+func killProcessTree(process *os.Process) error {
+	return exec.Command(
+		"taskkill", "/T", "/F", "/PID", strconv.Itoa(process.Pid)).Run()
 }
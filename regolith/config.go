@@ -1,8 +1,18 @@
 package regolith
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 const StandardLibraryUrl = "github.com/Bedrock-OSS/regolith-filters"
 const ConfigFilePath = "config.json"
-const GitIgnore = "/build\n/.regolith"
+
+// LocalConfigFilePath is the path to the optional config file with the
+// settings specific to the machine. It's merged over the config.json file
+// and shouldn't be committed to the repository.
+const LocalConfigFilePath = "config.local.json"
+const GitIgnore = "/build\n/.regolith\n/" + LocalConfigFilePath
 
 // Config represents the full configuration file of Regolith, as saved in
 // "config.json".
@@ -21,7 +31,26 @@ type ExportTarget struct {
 	BpPath    string `json:"bpPath,omitempty"` // Relative or absolute path to resource pack for "exact" export target
 	WorldName string `json:"worldName,omitempty"`
 	WorldPath string `json:"worldPath,omitempty"`
-	ReadOnly  bool   `json:"readOnly"` // Whether the exported files should be read-only
+	Path      string `json:"path,omitempty"`     // Directory of the archives for "mcpack", "mcaddon" and "mcworld" export targets
+	FileName  string `json:"fileName,omitempty"` // File name template of the archives for "mcpack", "mcaddon" and "mcworld" export targets
+	ReadOnly  bool   `json:"readOnly"`           // Whether the exported files should be read-only
+
+	// Path to the world used as a template for the "mcworld" export target
+	WorldTemplate string `json:"worldTemplate,omitempty"`
+}
+
+// ExportTargets is the list of the export targets of a profile. In
+// "config.json" it's either a single export target or an array of export
+// targets.
+type ExportTargets []ExportTarget
+
+// MarshalJSON implements json.Marshaler. A single export target is
+// marshaled as an object.
+func (e ExportTargets) MarshalJSON() ([]byte, error) {
+	if len(e) == 1 {
+		return json.Marshal(e[0])
+	}
+	return json.Marshal([]ExportTarget(e))
 }
 
 // Packs is a part of "config.json" that points to the source behavior and
@@ -41,8 +70,15 @@ type RegolithProject struct {
 }
 
 // ConfigFromObject creates a "Config" object from map[string]interface{}
+// The "${...}" placeholders in the strings of the object are replaced using
+// interpolateConfig.
 func ConfigFromObject(obj map[string]interface{}) (*Config, error) {
 	result := &Config{}
+	// Placeholders
+	obj, problems := interpolateConfig(obj)
+	if len(problems) > 0 {
+		return nil, PassError(problems[0].Err)
+	}
 	// Name
 	name, ok := obj["name"].(string)
 	if !ok {
@@ -139,6 +175,10 @@ func RegolithProjectFromObject(
 	if !ok {
 		return result, WrappedErrorf(jsonPropertyMissingError, "profiles")
 	}
+	profiles, err := resolveProfiles(profiles)
+	if err != nil {
+		return result, PassError(err)
+	}
 	for profileName, profile := range profiles {
 		profileMap, ok := profile.(map[string]interface{})
 		if !ok {
@@ -167,6 +207,40 @@ func RegolithProjectFromObject(
 	return result, nil
 }
 
+// ExportTargetsFromObject creates an "ExportTargets" object from the
+// "export" property of a profile, which can be a single export target or an
+// array of export targets.
+func ExportTargetsFromObject(obj interface{}) (ExportTargets, error) {
+	switch obj := obj.(type) {
+	case map[string]interface{}:
+		exportTarget, err := ExportTargetFromObject(obj)
+		if err != nil {
+			return nil, PassError(err)
+		}
+		return ExportTargets{exportTarget}, nil
+	case []interface{}:
+		if len(obj) == 0 {
+			return nil, WrappedError(
+				"The list of the export targets can't be empty.")
+		}
+		result := ExportTargets{}
+		for i, item := range obj {
+			item, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, WrappedErrorf(
+					jsonPathTypeError, fmt.Sprint(i), "object")
+			}
+			exportTarget, err := ExportTargetFromObject(item)
+			if err != nil {
+				return nil, WrapErrorf(err, jsonPathParseError, fmt.Sprint(i))
+			}
+			result = append(result, exportTarget)
+		}
+		return result, nil
+	}
+	return nil, WrappedErrorf(jsonPathTypeError, "export", "object or array")
+}
+
 // ExportTargetFromObject creates a "ExportTarget" object from
 // map[string]interface{}
 func ExportTargetFromObject(obj map[string]interface{}) (ExportTarget, error) {
@@ -194,6 +268,15 @@ func ExportTargetFromObject(obj map[string]interface{}) (ExportTarget, error) {
 	// WorldPath - can be empty
 	worldPath, _ := obj["worldPath"].(string)
 	result.WorldPath = worldPath
+	// Path - can be empty
+	path, _ := obj["path"].(string)
+	result.Path = path
+	// FileName - can be empty
+	fileName, _ := obj["fileName"].(string)
+	result.FileName = fileName
+	// WorldTemplate - can be empty
+	worldTemplate, _ := obj["worldTemplate"].(string)
+	result.WorldTemplate = worldTemplate
 	// ReadOnly - can be empty
 	readOnly, _ := obj["readOnly"].(bool)
 	result.ReadOnly = readOnly
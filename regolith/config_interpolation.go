@@ -0,0 +1,253 @@
+package regolith
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The placeholders that can be used in the strings of the config file.
+// "$${" is an escaped "${" that isn't replaced.
+const (
+	// ${env:NAME} is replaced with the value of the environment variable
+	envPlaceholderPrefix = "env:"
+
+	// ${config:path} is replaced with the value of another property of the
+	// config file. The path uses dots to separate the properties, for example
+	// "${config:packs.behaviorPack}"
+	configPlaceholderPrefix = "config:"
+
+	// ${projectRoot} is replaced with the absolute path to the project
+	projectRootPlaceholder = "projectRoot"
+
+	// ${profile} is replaced with the name of the profile, it can only be
+	// used inside of the profiles
+	profilePlaceholder = "profile"
+)
+
+// configInterpolator replaces the "${...}" placeholders in the strings of
+// the config file.
+type configInterpolator struct {
+	// config is the config file object used for resolving the
+	// "${config:...}" placeholders
+	config map[string]interface{}
+
+	// projectRoot is the absolute path to the project
+	projectRoot string
+
+	// problems are the problems found while replacing the placeholders
+	problems []ConfigProblem
+}
+
+// interpolateConfig returns a copy of the config file object with the
+// placeholders in its strings replaced. The profiles are resolved with
+// resolveProfiles first, so the "${profile}" placeholders in the extended
+// profiles use the name of the profile that extends them. The returned
+// problems have the JSON paths of the strings with invalid placeholders and
+// are sorted by the paths.
+func interpolateConfig(
+	obj map[string]interface{},
+) (result map[string]interface{}, problems []ConfigProblem) {
+	projectRoot, err := filepath.Abs(".")
+	if err != nil {
+		return obj, []ConfigProblem{{
+			JsonPath: "", Err: WrapErrorf(err, filepathAbsError, ".")}}
+	}
+	i := &configInterpolator{config: obj, projectRoot: projectRoot}
+	defer func() {
+		sort.SliceStable(problems, func(a, b int) bool {
+			return problems[a].JsonPath < problems[b].JsonPath
+		})
+	}()
+	result = make(map[string]interface{}, len(obj))
+	for key, value := range obj {
+		if key == "regolith" {
+			continue
+		}
+		result[key] = i.interpolate(value, key, "")
+	}
+	regolith, ok := obj["regolith"].(map[string]interface{})
+	if !ok {
+		if regolith, ok := obj["regolith"]; ok {
+			result["regolith"] = deepCopyJson(regolith)
+		}
+		return result, i.problems
+	}
+	regolithResult := make(map[string]interface{}, len(regolith))
+	for key, value := range regolith {
+		if key == "profiles" {
+			continue
+		}
+		regolithResult[key] = i.interpolate(value, "regolith->"+key, "")
+	}
+	result["regolith"] = regolithResult
+	profilesObj, ok := regolith["profiles"]
+	if !ok {
+		return result, i.problems
+	}
+	profiles, ok := profilesObj.(map[string]interface{})
+	if !ok {
+		regolithResult["profiles"] = deepCopyJson(profilesObj)
+		return result, i.problems
+	}
+	// Invalid "extends" properties are reported when the profiles are
+	// parsed, the profiles are interpolated without resolving them.
+	if resolved, err := resolveProfiles(profiles); err == nil {
+		profiles = resolved
+	}
+	profilesResult := make(map[string]interface{}, len(profiles))
+	for name, profile := range profiles {
+		profilesResult[name] = i.interpolate(
+			profile, "regolith->profiles->"+name, name)
+	}
+	regolithResult["profiles"] = profilesResult
+	return result, i.problems
+}
+
+// interpolate returns a copy of the value with the placeholders in its
+// strings replaced. The jsonPath is the path to the value used for reporting
+// the problems and the profile is the name of the profile that contains the
+// value (empty outside of the profiles).
+func (i *configInterpolator) interpolate(
+	value interface{}, jsonPath, profile string,
+) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			result[key] = i.interpolate(item, jsonPath+"->"+key, profile)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for index, item := range value {
+			result[index] = i.interpolate(
+				item, jsonPath+"->"+strconv.Itoa(index), profile)
+		}
+		return result
+	case string:
+		result, err := i.interpolateString(value, profile, nil)
+		if err != nil {
+			i.problems = append(i.problems, ConfigProblem{
+				JsonPath: jsonPath,
+				Err:      WrapErrorf(err, placeholderResolveError, jsonPath),
+			})
+			return value
+		}
+		return result
+	}
+	return value
+}
+
+// interpolateString replaces the placeholders in the text. The chain is the
+// list of the "${config:...}" placeholders being resolved, used for
+// detecting the circular references.
+func (i *configInterpolator) interpolateString(
+	text, profile string, chain []string,
+) (string, error) {
+	var result strings.Builder
+	for {
+		start := strings.Index(text, "${")
+		if start == -1 {
+			result.WriteString(text)
+			return result.String(), nil
+		}
+		if start > 0 && text[start-1] == '$' { // Escaped
+			result.WriteString(text[:start-1] + "${")
+			text = text[start+2:]
+			continue
+		}
+		end := strings.Index(text[start:], "}")
+		if end == -1 {
+			return "", WrappedErrorf(
+				"Unclosed placeholder.\nText: %s", text)
+		}
+		end += start
+		value, err := i.placeholderValue(text[start+2:end], profile, chain)
+		if err != nil {
+			return "", WrapErrorf(
+				err, "Failed to resolve the placeholder.\nPlaceholder: %s",
+				text[start:end+1])
+		}
+		result.WriteString(text[:start] + value)
+		text = text[end+1:]
+	}
+}
+
+// placeholderValue returns the value of the placeholder (without the "${"
+// and "}").
+func (i *configInterpolator) placeholderValue(
+	placeholder, profile string, chain []string,
+) (string, error) {
+	switch {
+	case placeholder == projectRootPlaceholder:
+		return i.projectRoot, nil
+	case placeholder == profilePlaceholder:
+		if profile == "" {
+			return "", WrappedError(
+				"The \"${profile}\" placeholder can only be used inside of " +
+					"the profiles.")
+		}
+		return profile, nil
+	case strings.HasPrefix(placeholder, envPlaceholderPrefix):
+		name := strings.TrimPrefix(placeholder, envPlaceholderPrefix)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", WrappedErrorf(
+				"The environment variable is not set.\nVariable: %s", name)
+		}
+		return value, nil
+	case strings.HasPrefix(placeholder, configPlaceholderPrefix):
+		path := strings.TrimPrefix(placeholder, configPlaceholderPrefix)
+		for _, previous := range chain {
+			if previous == path {
+				return "", WrappedErrorf(
+					"Circular references between the config properties.\n"+
+						"Chain: %s", strings.Join(append(chain, path), " -> "))
+			}
+		}
+		value, err := i.configValue(path)
+		if err != nil {
+			return "", PassError(err)
+		}
+		result, err := i.interpolateString(
+			value, profile, append(chain, path))
+		if err != nil {
+			return "", PassError(err)
+		}
+		return result, nil
+	}
+	return "", WrappedErrorf(
+		"Unknown placeholder. Use \"${env:NAME}\", \"${projectRoot}\", "+
+			"\"${profile}\" or \"${config:name}\".\nPlaceholder: ${%s}",
+		placeholder)
+}
+
+// configValue returns the value of the property of the config file at the
+// path with the names of the properties separated by dots. The value must
+// be a string, a number or a boolean.
+func (i *configInterpolator) configValue(path string) (string, error) {
+	var value interface{} = i.config
+	for _, property := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return "", WrappedErrorf(jsonPathMissingError, path)
+		}
+		value, ok = obj[property]
+		if !ok {
+			return "", WrappedErrorf(jsonPathMissingError, path)
+		}
+	}
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	}
+	return "", WrappedErrorf(
+		jsonPathTypeError, path, "string, number or boolean")
+}
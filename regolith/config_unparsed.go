@@ -7,12 +7,38 @@ package regolith
 
 import (
 	"io/ioutil"
+	"os"
 
 	"muzzammil.xyz/jsonc"
 )
 
-// LoadConfigAsMap loads the config.json file as map[string]interface{}
+// LoadConfigAsMap loads the config.json file as map[string]interface{}. If
+// the config.local.json file exists, it's deep-merged over the config using
+// mergeLocalConfig.
 func LoadConfigAsMap() (map[string]interface{}, error) {
+	configJson, err := loadConfigFileAsMap()
+	if err != nil {
+		return nil, PassError(err)
+	}
+	file, err := ioutil.ReadFile(LocalConfigFilePath)
+	if os.IsNotExist(err) {
+		return configJson, nil
+	}
+	if err != nil {
+		return nil, WrapErrorf(err, fileReadError, LocalConfigFilePath)
+	}
+	var localConfigJson map[string]interface{}
+	err = jsonc.Unmarshal(file, &localConfigJson)
+	if err != nil {
+		return nil, WrapErrorf(err, jsonUnmarshalError, LocalConfigFilePath)
+	}
+	return mergeLocalConfig(configJson, localConfigJson), nil
+}
+
+// loadConfigFileAsMap loads the config.json file as map[string]interface{}
+// without merging the config.local.json file. It's used by the functions
+// that save the modified config back to the config.json file.
+func loadConfigFileAsMap() (map[string]interface{}, error) {
 	file, err := ioutil.ReadFile(ConfigFilePath)
 	if err != nil {
 		return nil, WrappedError( // We don't need to pass OS error. It's confusing.
@@ -28,6 +54,25 @@ func LoadConfigAsMap() (map[string]interface{}, error) {
 	return configJson, nil
 }
 
+// mergeLocalConfig deep-merges the local config over the config. The objects
+// are merged recursively, and the other values (including the arrays) from
+// the local config replace the values from the config.
+func mergeLocalConfig(
+	config, localConfig map[string]interface{},
+) map[string]interface{} {
+	result := deepCopyJson(config).(map[string]interface{})
+	for key, value := range localConfig {
+		valueObj, ok1 := value.(map[string]interface{})
+		resultObj, ok2 := result[key].(map[string]interface{})
+		if ok1 && ok2 {
+			result[key] = mergeLocalConfig(resultObj, valueObj)
+		} else {
+			result[key] = deepCopyJson(value)
+		}
+	}
+	return result
+}
+
 // dataPathFromConfigMap returns the value of the data path from the config
 // file map, without parsing it to a Config object.
 func dataPathFromConfigMap(config map[string]interface{}) (string, error) {
@@ -0,0 +1,158 @@
+//go:build linux
+// +build linux
+
+package regolith
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyWatchMask is the list of the inotify events observed by the
+// DirWatcher. Just like on Windows, the changes of the attributes and the
+// access times are ignored.
+//
+// Useful links:
+// https://man7.org/linux/man-pages/man7/inotify.7.html
+const inotifyWatchMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MODIFY |
+	unix.IN_CLOSE_WRITE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO |
+	unix.IN_DELETE_SELF | unix.IN_MOVE_SELF | unix.IN_ONLYDIR
+
+// inotifyDirWatcher is the Linux backend of the DirWatcher. Inotify doesn't
+// support watching directories recursively so the backend adds a separate
+// watch for every subdirectory, including the ones created after the
+// watching began.
+type inotifyDirWatcher struct {
+	watcher *DirWatcher
+	file    *os.File
+	fd      int
+
+	// paths maps the watch descriptors to the paths of the watched
+	// directories.
+	paths map[int]string
+	mutex sync.Mutex
+}
+
+// startNativeDirWatcher starts the inotify backend of the DirWatcher. It
+// returns a function that stops the backend.
+func startNativeDirWatcher(d *DirWatcher, path string) (func() error, error) {
+	// The non-blocking descriptor wrapped in os.File uses Go's runtime
+	// poller, which lets Close interrupt the pending Read.
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, WrapError(err, "Failed to initialize inotify.")
+	}
+	w := &inotifyDirWatcher{
+		watcher: d,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		fd:      fd,
+		paths:   make(map[int]string),
+	}
+	err = w.addRecursive(path)
+	if err != nil {
+		w.file.Close()
+		return nil, PassError(err)
+	}
+	go w.readEvents()
+	return w.file.Close, nil
+}
+
+// addRecursive adds inotify watches for the path and all of its
+// subdirectories.
+func (w *inotifyDirWatcher) addRecursive(root string) error {
+	return filepath.WalkDir(
+		root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if path != root && os.IsNotExist(err) {
+					return nil // Deleted in the meantime
+				}
+				return WrapErrorf(err, osWalkError, root)
+			}
+			if !d.IsDir() {
+				return nil
+			}
+			wd, err := unix.InotifyAddWatch(w.fd, path, inotifyWatchMask)
+			if err != nil {
+				if path != root && (err == unix.ENOENT || err == unix.ENOTDIR) {
+					return nil // Deleted or replaced in the meantime
+				}
+				return WrapErrorf(
+					err, "Failed to add inotify watch.\nPath: %s", path)
+			}
+			w.mutex.Lock()
+			w.paths[wd] = path
+			w.mutex.Unlock()
+			return nil
+		})
+}
+
+// readEvents reads the inotify events until the backend is closed. It
+// reports the changes to the DirWatcher and starts watching the newly created
+// directories.
+func (w *inotifyDirWatcher) readEvents() {
+	buffer := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buffer)
+		if err != nil {
+			select {
+			case <-w.watcher.closed: // Closed on purpose
+			default:
+				w.watcher.notifyError(
+					WrapError(err, "Failed to read inotify events."))
+			}
+			return
+		}
+		changed := false
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			nameEnd := nameStart + int(event.Len)
+			offset = nameEnd
+			if event.Mask&unix.IN_Q_OVERFLOW != 0 {
+				changed = true
+				continue
+			}
+			w.mutex.Lock()
+			dirPath, ok := w.paths[int(event.Wd)]
+			if event.Mask&unix.IN_IGNORED != 0 {
+				// The watch was removed (usually because the directory
+				// was deleted)
+				delete(w.paths, int(event.Wd))
+			}
+			w.mutex.Unlock()
+			if !ok || event.Mask&unix.IN_IGNORED != 0 {
+				continue
+			}
+			changed = true
+			isNewDir := event.Mask&unix.IN_ISDIR != 0 &&
+				event.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0
+			if isNewDir && event.Len > 0 {
+				name := trimInotifyName(buffer[nameStart:nameEnd])
+				err := w.addRecursive(filepath.Join(dirPath, name))
+				if err != nil {
+					Logger.Warnf(
+						"Unable to watch new directory.\n%s", err.Error())
+				}
+			}
+		}
+		if changed {
+			w.watcher.notifyChange()
+		}
+	}
+}
+
+// trimInotifyName converts the name from the inotify event to string. The
+// names are padded with null bytes.
+func trimInotifyName(name []byte) string {
+	for i, b := range name {
+		if b == 0 {
+			return string(name[:i])
+		}
+	}
+	return string(name)
+}
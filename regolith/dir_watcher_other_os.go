@@ -0,0 +1,237 @@
+//go:build !windows
+// +build !windows
+
+package regolith
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// dirWatcherPollInterval is the interval between the scans of the watched
+// directory when the DirWatcher uses polling instead of the native file
+// system notifications.
+const dirWatcherPollInterval = 500 * time.Millisecond
+
+// Error used when DirWatcher is used after it was closed
+const dirWatcherClosedError = "The directory watcher is closed."
+
+// DirWatcher is a struct that provides easy to use methods for watching a
+// directory for changes. Just like its Windows counterpart, it doesn't
+// provide any information about the changes, only the fact that something
+// changed.
+//
+// The changes are detected by a backend running in a separate goroutine. On
+// Linux the backend uses inotify, on other systems (or when inotify can't be
+// used) it periodically scans the directory and compares the modification
+// times and sizes of the files.
+type DirWatcher struct {
+	// changes receives a value when the backend detects a change. It has a
+	// buffer of size 1, so multiple changes that happen before anyone reads
+	// from the channel are reported only once.
+	changes chan struct{}
+
+	// errors receives the errors from the backend, that make it impossible
+	// to continue watching the directory.
+	errors chan error
+
+	// closed is closed when the DirWatcher is closed.
+	closed chan struct{}
+
+	// closeBackend is a function used to release the resources of the
+	// backend.
+	closeBackend func() error
+
+	closeOnce sync.Once
+}
+
+// NewDirWatcher creates a new DirWatcher for the given path. The watcher
+// observes the path recursively, including the directories created after
+// the watching began. It uses the native file system notifications if they're
+// available on this system and falls back to polling otherwise.
+func NewDirWatcher(path string) (*DirWatcher, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, WrapErrorf(err, osStatErrorIsNotExist, path)
+		}
+		return nil, WrapErrorf(err, osStatErrorAny, path)
+	} else if !stat.IsDir() {
+		return nil, WrappedErrorf(isDirNotADirError, path)
+	}
+	d := &DirWatcher{
+		changes: make(chan struct{}, 1),
+		errors:  make(chan error, 1),
+		closed:  make(chan struct{}),
+	}
+	d.closeBackend, err = startNativeDirWatcher(d, path)
+	if err != nil {
+		Logger.Debugf(
+			"Unable to use native file system notifications, using polling "+
+				"instead.\nPath: %s\nReason: %s", path, err.Error())
+		d.closeBackend = startPollingDirWatcher(d, path)
+	}
+	return d, nil
+}
+
+// WaitForChange locks the goroutine until a single change is detected. Note
+// that some changes are reported multiple times, for example saving a file
+// will cause a change to the file and a change to the directory. If you want
+// to report cases like that as one event, see WaitForChangeGroup.
+func (d *DirWatcher) WaitForChange() error {
+	select {
+	case <-d.changes:
+		return nil
+	case err := <-d.errors:
+		return PassError(err)
+	case <-d.closed:
+		return WrappedError(dirWatcherClosedError)
+	}
+}
+
+// WaitForChangeGroup locks a goroutine until it recives a change notification.
+// When that happens it sends the interruptionMessage to the
+// interruptionChannel.
+// Then it continues locking as long as other changes keep coming with
+// intercals less than the given timeout (in milliseconds), to group
+// notifications that come in short intervals together.
+func (d *DirWatcher) WaitForChangeGroup(
+	groupTimeout uint32, interruptionChannel chan string,
+	interruptionMessage string,
+) error {
+	err := d.WaitForChange()
+	if err != nil {
+		return PassError(err)
+	}
+	// Instantly report the change
+	interruptionChannel <- interruptionMessage
+	// Consume all changes for groupDelay duration
+	timeout := time.Duration(groupTimeout) * time.Millisecond
+	for {
+		select {
+		case <-d.changes:
+			continue
+		case err := <-d.errors:
+			return PassError(err)
+		case <-d.closed:
+			return WrappedError(dirWatcherClosedError)
+		case <-time.After(timeout):
+			return nil
+		}
+	}
+}
+
+// Close stops the DirWatcher and releases its resources.
+func (d *DirWatcher) Close() error {
+	var err error
+	d.closeOnce.Do(func() {
+		close(d.closed)
+		err = d.closeBackend()
+	})
+	if err != nil {
+		return WrapError(err, "Failed to close the directory watcher.")
+	}
+	return nil
+}
+
+// notifyChange is used by the backends of the DirWatcher to report a change.
+// It never blocks.
+func (d *DirWatcher) notifyChange() {
+	select {
+	case d.changes <- struct{}{}:
+	default: // There is already a pending notification
+	}
+}
+
+// notifyError is used by the backends of the DirWatcher to report an error
+// that stops the watching. It never blocks.
+func (d *DirWatcher) notifyError(err error) {
+	select {
+	case d.errors <- err:
+	default: // There is already a pending error
+	}
+}
+
+// pollingFileState is the state of a single path remembered by the polling
+// backend of the DirWatcher between the scans.
+type pollingFileState struct {
+	modTime time.Time
+	size    int64
+	isDir   bool
+}
+
+// startPollingDirWatcher starts the polling backend of the DirWatcher. It
+// returns a function that stops the backend.
+func startPollingDirWatcher(d *DirWatcher, path string) func() error {
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(dirWatcherPollInterval)
+		defer ticker.Stop()
+		previous := scanPollingDirWatcherPath(path)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				current := scanPollingDirWatcherPath(path)
+				if !equalPollingStates(previous, current) {
+					d.notifyChange()
+				}
+				previous = current
+			}
+		}
+	}()
+	return func() error {
+		close(stop)
+		return nil
+	}
+}
+
+// scanPollingDirWatcherPath returns the state of all of the files and
+// directories in the path. The paths that can't be accessed are skipped.
+func scanPollingDirWatcherPath(root string) map[string]pollingFileState {
+	result := make(map[string]pollingFileState)
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // The file might have been deleted during the scan
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		result[path] = pollingFileState{
+			modTime: info.ModTime(),
+			size:    info.Size(),
+			isDir:   info.IsDir(),
+		}
+		return nil
+	})
+	return result
+}
+
+// equalPollingStates compares two states of the directory created with
+// scanPollingDirWatcherPath.
+func equalPollingStates(a, b map[string]pollingFileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, aState := range a {
+		bState, ok := b[path]
+		if !ok {
+			return false
+		}
+		if aState.isDir != bState.isDir {
+			return false
+		}
+		// The modification time and size of the directories depend on the
+		// file system, the changes of their content are detected anyway.
+		if !aState.isDir && (!aState.modTime.Equal(bState.modTime) ||
+			aState.size != bState.size) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,10 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package regolith
+
+// startNativeDirWatcher is a placeholder for a function which is implemented
+// only on Linux. On other systems the DirWatcher always uses polling.
+func startNativeDirWatcher(d *DirWatcher, path string) (func() error, error) {
+	return nil, WrappedError(notImplementedOnThisSystemError)
+}
@@ -28,6 +28,9 @@ const (
 	// Error message displayed when mkdir (or similar function) fails
 	osMkdirError = "Failed to create directory.\nPath: %s"
 
+	// Error message displayed when os.ReadDir (or similar function) fails
+	osReadDirError = "Failed to list the files in directory.\nPath: %s"
+
 	// Error message displayed when os.Getwd fails
 	osGetwdError = "Failed to get current working directory."
 
@@ -97,6 +100,10 @@ const (
 	jsonPathTypeError = "Invalid data type.\nJSON Path: %s\n" +
 		"Expected type: %s"
 
+	// Error used when the placeholders of a config value can't be resolved
+	placeholderResolveError = "Failed to resolve the placeholders.\n" +
+		"JSON Path: %s"
+
 	// Error used when RunSubProcess funciton fails
 	runSubProcessError = "Failed to run sub process."
 
@@ -151,11 +158,26 @@ const (
 	// Error used when ExportProject function fails
 	exportProjectError = "Failed to export project."
 
+	// Error used when UpdateManifests function fails
+	updateManifestsError = "Failed to update the manifests of the packs."
+
 	// Error used when RunContext.GetProfile function fails
 	runContextGetProfileError = "Failed to get profile."
 
 	filterRunnerRunError = "Failed to run filter.\nFilter: %s"
 
+	// Error used when some of the filters running in parallel fail
+	parallelFiltersRunError = "Failed to run %d of the filters running " +
+		"in parallel."
+
+	// Error used when the "dependsOn" properties of the filters in a profile
+	// can't be resolved
+	filterDependenciesError = "Invalid filter dependencies.\nProfile: %s"
+
+	// Error used when a filter is killed because it reaches its timeout
+	filterTimeoutError = "The filter didn't finish before the timeout and " +
+		"was killed.\nFilter: %s\nTimeout: %s"
+
 	// Error used when GetRegolithConfigPath fails
 	getRegolithConfigPathError = "Failed to get path to Regolith's app data folder."
 )
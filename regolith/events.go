@@ -0,0 +1,128 @@
+package regolith
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// The names of the events logged in the JSON output mode. Every JSON object
+// printed by Regolith has the "level" and "msg" properties. The objects that
+// represent events also have the "event" property with one of these values
+// and additional properties specific to the event.
+const (
+	// Properties: profile, watch
+	runStartedEvent = "run_started"
+
+	// Properties: filter, profile
+	filterStartedEvent = "filter_started"
+
+	// Properties: filter, profile, durationMs, success
+	filterFinishedEvent = "filter_finished"
+
+	// Properties: filter, stream, line
+	subprocessOutputEvent = "subprocess_output"
+
+	// Properties: filter, type, message
+	filterMessageEvent = "filter_message"
+
+	// Properties: pack, path
+	exportEvent = "export"
+
+	// Properties: chain
+	errorEvent = "error"
+
+	// Properties: jsonPath, chain
+	configProblemEvent = "config_problem"
+
+	// Properties: filter, url, pinned, installed, latest, head, outdated
+	filterVersionsEvent = "filter_versions"
+
+	// Properties: profile, stage, name, filter
+	traceStageEvent = "trace_stage"
+
+	// Properties: file, stage, name, change
+	traceFileHistoryEvent = "trace_file_history"
+
+	// Properties: from, to, path, change
+	traceChangeEvent = "trace_change"
+
+	// Properties: from, to, path, diff
+	traceDiffEvent = "trace_diff"
+
+	// Properties: profile, config
+	configProfileEvent = "config_profile"
+)
+
+// logEvent logs a message with an event. In the text output mode, only the
+// message is printed using the consoleLevel. In the JSON output mode, the
+// message is always logged at the info level, so the events aren't hidden
+// when the debug mode is disabled, and the fields are added to the JSON
+// object. The fields are alternating keys and values like in the Infow
+// function of the zap.SugaredLogger.
+func logEvent(
+	consoleLevel zapcore.Level, event, message string,
+	fields ...interface{},
+) {
+	if IsJsonOutput() {
+		Logger.Infow(message, append([]interface{}{"event", event}, fields...)...)
+		return
+	}
+	switch consoleLevel {
+	case zapcore.DebugLevel:
+		Logger.Debug(message)
+	case zapcore.WarnLevel:
+		Logger.Warn(message)
+	case zapcore.ErrorLevel:
+		Logger.Error(message)
+	default:
+		Logger.Info(message)
+	}
+}
+
+// logFilterStarted logs the start of a filter.
+func logFilterStarted(context RunContext, filter FilterRunner) {
+	// Skip printing if the filter ID is empty (most likely a nested profile)
+	if filter.GetId() == "" {
+		return
+	}
+	logEvent(
+		zapcore.InfoLevel, filterStartedEvent,
+		fmt.Sprintf("Running filter %s", filter.GetId()),
+		"filter", filter.GetId(), "profile", context.Profile)
+}
+
+// logFilterFinished logs the end of a filter, with the time of its
+// execution.
+func logFilterFinished(
+	context RunContext, filter FilterRunner, duration time.Duration, err error,
+) {
+	logEvent(
+		zapcore.DebugLevel, filterFinishedEvent,
+		fmt.Sprintf("Executed in %s", duration),
+		"filter", filter.GetId(), "profile", context.Profile,
+		"durationMs", duration.Milliseconds(), "success", err == nil)
+}
+
+// ErrorChain returns the list of messages of an error created with the
+// WrapError family of functions, starting from the outermost one. The
+// messages don't have the stack traces and the colors of the text of the
+// error.
+func ErrorChain(err error) []string {
+	chain := errorChain(err)
+	result := make([]string, len(chain))
+	copy(result, chain)
+	return result
+}
+
+// LogError logs an error. In the JSON output mode, the error is logged as an
+// event with the chain of the wrapped error messages.
+func LogError(err error) {
+	if IsJsonOutput() {
+		chain := ErrorChain(err)
+		Logger.Errorw(chain[0], "event", errorEvent, "chain", chain)
+		return
+	}
+	Logger.Error(err)
+}
@@ -1,8 +1,12 @@
 package regolith
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
 )
 
 // GetExportPaths returns file paths for exporting behavior pack and
@@ -11,6 +15,9 @@ import (
 func GetExportPaths(
 	exportTarget ExportTarget, name string,
 ) (bpPath string, rpPath string, err error) {
+	if err := validateExportTarget(exportTarget); err != nil {
+		return "", "", PassError(err)
+	}
 	if exportTarget.Target == "development" {
 		comMojang, err := FindMojangDir()
 		if err != nil {
@@ -38,11 +45,6 @@ func GetExportPaths(
 		rpPath = exportTarget.RpPath
 	} else if exportTarget.Target == "world" {
 		if exportTarget.WorldPath != "" {
-			if exportTarget.WorldName != "" {
-				return "", "", WrappedError(
-					"Using both \"worldName\" and \"worldPath\" is not" +
-						" allowed.")
-			}
 			bpPath = filepath.Join(
 				exportTarget.WorldPath, "behavior_packs", name+"_bp")
 			rpPath = filepath.Join(
@@ -65,21 +67,55 @@ func GetExportPaths(
 						world.Path, "resource_packs", name+"_rp")
 				}
 			}
-		} else {
-			err = WrappedError(
-				"The \"world\" export target requires either a " +
-					"\"worldName\" or \"worldPath\" property")
 		}
 	} else if exportTarget.Target == "local" {
 		bpPath = "build/BP/"
 		rpPath = "build/RP/"
-	} else {
-		err = WrappedErrorf(
-			"Export target %q is not valid", exportTarget.Target)
 	}
 	return
 }
 
+// validateExportTarget checks whether the export target is valid without
+// accessing the file system.
+func validateExportTarget(exportTarget ExportTarget) error {
+	switch exportTarget.Target {
+	case "development", "preview", "exact", "local", "mcaddon":
+		return nil
+	case "mcpack":
+		// Both packs would be saved to the same file
+		if exportTarget.FileName != "" &&
+			!strings.Contains(exportTarget.FileName, "{pack}") {
+			return WrappedErrorf(
+				"The \"fileName\" of the \"mcpack\" export target must "+
+					"contain the \"{pack}\" placeholder, because every pack "+
+					"is exported to a separate archive.\nFile name: %s",
+				exportTarget.FileName)
+		}
+		return nil
+	case "world":
+		if exportTarget.WorldPath != "" && exportTarget.WorldName != "" {
+			return WrappedError(
+				"Using both \"worldName\" and \"worldPath\" is not" +
+					" allowed.")
+		}
+		if exportTarget.WorldPath == "" && exportTarget.WorldName == "" {
+			return WrappedError(
+				"The \"world\" export target requires either a " +
+					"\"worldName\" or \"worldPath\" property")
+		}
+		return nil
+	case "mcworld":
+		if exportTarget.WorldTemplate == "" {
+			return WrappedError(
+				"The \"mcworld\" export target requires a " +
+					"\"worldTemplate\" property")
+		}
+		return nil
+	}
+	return WrappedErrorf(
+		"Export target %q is not valid", exportTarget.Target)
+}
+
 // RecycledExportProject copies files from the tmp paths (tmp/BP and tmp/RP)
 // into the project's export target. The paths are generated with
 // GetExportPaths. The function uses cached data about the state of the project
@@ -87,7 +123,27 @@ func GetExportPaths(
 func RecycledExportProject(
 	profile Profile, name, dataPath, dotRegolithPath string,
 ) error {
-	exportTarget := profile.ExportTarget
+	if len(profile.ExportTargets) != 1 {
+		// The cached data only describes a single export target. Exporting
+		// to multiple targets uses the regular export, and the cache is
+		// cleared because the states of the files are no longer known.
+		err := ExportProject(profile, name, dataPath, dotRegolithPath)
+		if err1 := ClearCachedStates(); err1 != nil {
+			err = firstErr(err, WrapError(err1, clearCachedStatesError))
+		}
+		if err != nil {
+			return PassError(err)
+		}
+		return nil
+	}
+	exportTarget := profile.ExportTargets[0]
+	if isArchiveExportTarget(exportTarget.Target) {
+		err := exportArchives(exportTarget, name, dotRegolithPath, nil)
+		if err != nil {
+			return WrapError(err, "Failed to export the archives.")
+		}
+		return recycledExportData(dataPath, dotRegolithPath)
+	}
 	bpPath, rpPath, err := GetExportPaths(exportTarget, name)
 	if err != nil {
 		return WrapError(
@@ -98,18 +154,13 @@ func RecycledExportProject(
 	editedFiles := LoadEditedFiles(dotRegolithPath)
 	err = editedFiles.CheckDeletionSafety(rpPath, bpPath)
 	if err != nil {
-		return WrapErrorf(
-			err,
-			"Safety mechanism stopped Regolith to protect unexpected files "+
-				"from your export targets.\n"+
-				"Did you edit the exported files manually?\n"+
-				"Please clear your export paths and try again.\n"+
-				"Resource pack export path: %s\n"+
-				"Behavior pack export path: %s",
-			rpPath, bpPath)
+		return deletionSafetyError(err, rpPath, bpPath)
 	}
 
-	Logger.Infof("Exporting behavior pack to \"%s\".", bpPath)
+	logEvent(
+		zapcore.InfoLevel, exportEvent,
+		fmt.Sprintf("Exporting behavior pack to \"%s\".", bpPath),
+		"pack", "BP", "path", bpPath)
 	err = FullRecycledMoveOrCopy(
 		filepath.Join(dotRegolithPath, "tmp/BP"), bpPath,
 		RecycledMoveOrCopySettings{
@@ -123,7 +174,10 @@ func RecycledExportProject(
 	if err != nil {
 		return WrapError(err, "Failed to export behavior pack.")
 	}
-	Logger.Infof("Exporting project to \"%s\".", rpPath)
+	logEvent(
+		zapcore.InfoLevel, exportEvent,
+		fmt.Sprintf("Exporting project to \"%s\".", rpPath),
+		"pack", "RP", "path", rpPath)
 	err = FullRecycledMoveOrCopy(
 		filepath.Join(dotRegolithPath, "tmp/RP"), rpPath,
 		RecycledMoveOrCopySettings{
@@ -137,20 +191,9 @@ func RecycledExportProject(
 	if err != nil {
 		return WrapError(err, "Failed to export resource pack.")
 	}
-	err = FullRecycledMoveOrCopy(
-		filepath.Join(dotRegolithPath, "tmp/data"), dataPath,
-		RecycledMoveOrCopySettings{
-			canMove:                 true,
-			saveSourceHashes:        true,
-			saveTargetHashes:        false,
-			makeTargetReadOnly:      false,
-			copyTargetAclFromParent: false,
-			reloadSourceHashes:      true,
-		})
+	err = recycledExportData(dataPath, dotRegolithPath)
 	if err != nil {
-		return WrapError(
-			err, "Failed to move the filter data back to the project's "+
-				"data folder.")
+		return PassError(err)
 	}
 
 	// Update or create edited_files.json
@@ -171,10 +214,26 @@ func RecycledExportProject(
 
 // ExportProject copies files from the tmp paths (tmp/BP and tmp/RP) into
 // the project's export target. The paths are generated with GetExportPaths.
+// Profiles with multiple export targets are exported with
+// exportMultipleTargets.
 func ExportProject(
 	profile Profile, name, dataPath, dotRegolithPath string,
 ) error {
-	exportTarget := profile.ExportTarget
+	if len(profile.ExportTargets) == 0 {
+		return WrappedError("The profile doesn't have any export targets.")
+	}
+	if len(profile.ExportTargets) > 1 {
+		return exportMultipleTargets(
+			profile.ExportTargets, name, dataPath, dotRegolithPath)
+	}
+	exportTarget := profile.ExportTargets[0]
+	if isArchiveExportTarget(exportTarget.Target) {
+		err := exportArchives(exportTarget, name, dotRegolithPath, nil)
+		if err != nil {
+			return WrapError(err, "Failed to export the archives.")
+		}
+		return exportData(dataPath, dotRegolithPath)
+	}
 	bpPath, rpPath, err := GetExportPaths(exportTarget, name)
 	if err != nil {
 		return WrapError(
@@ -185,15 +244,7 @@ func ExportProject(
 	editedFiles := LoadEditedFiles(dotRegolithPath)
 	err = editedFiles.CheckDeletionSafety(rpPath, bpPath)
 	if err != nil {
-		return WrapErrorf(
-			err,
-			"Safety mechanism stopped Regolith to protect unexpected files "+
-				"from your export targets.\n"+
-				"Did you edit the exported files manually?\n"+
-				"Please clear your export paths and try again.\n"+
-				"Resource pack export path: %s\n"+
-				"Behavior pack export path: %s",
-			rpPath, bpPath)
+		return deletionSafetyError(err, rpPath, bpPath)
 	}
 
 	// Clearing output locations
@@ -210,6 +261,104 @@ func ExportProject(
 			err, "Failed to clear resource pack from build path %q.\n"+
 				"Are user permissions correct?", rpPath)
 	}
+	revertibleOps, err := clearDataPath(dataPath, dotRegolithPath)
+	if err != nil {
+		return PassError(err)
+	}
+
+	logEvent(
+		zapcore.InfoLevel, exportEvent,
+		fmt.Sprintf("Exporting behavior pack to \"%s\".", bpPath),
+		"pack", "BP", "path", bpPath)
+	err = MoveOrCopy(filepath.Join(dotRegolithPath, "tmp/BP"), bpPath, exportTarget.ReadOnly, true)
+	if err != nil {
+		return WrapError(err, "Failed to export behavior pack.")
+	}
+	logEvent(
+		zapcore.InfoLevel, exportEvent,
+		fmt.Sprintf("Exporting project to \"%s\".", rpPath),
+		"pack", "RP", "path", rpPath)
+	err = MoveOrCopy(filepath.Join(dotRegolithPath, "tmp/RP"), rpPath, exportTarget.ReadOnly, true)
+	if err != nil {
+		return WrapError(err, "Failed to export resource pack.")
+	}
+	err = revertibleOps.MoveoOrCopyDir(
+		filepath.Join(dotRegolithPath, "tmp/data"), dataPath)
+	if err != nil {
+		revertibleOps.Undo()
+		return WrapError(
+			err, "Failed to move the filter data back to the project's "+
+				"data folder.")
+	}
+
+	// Update or create edited_files.json
+	err = editedFiles.UpdateFromPaths(rpPath, bpPath)
+	if err != nil {
+		return WrapError(
+			err,
+			"Failed to create a list of files edited by this 'regolith run'")
+	}
+	err = editedFiles.Dump(dotRegolithPath)
+	if err != nil {
+		return WrapError(
+			err, "Failed to update the list of the files edited by Regolith."+
+				"This may cause the next run to fail.")
+	}
+	if err := revertibleOps.Close(); err != nil {
+		return PassError(err)
+	}
+	return nil
+}
+
+// recycledExportData moves the data files of the filters from the tmp
+// directory back to the data path, using the cached data about the state of
+// the files like RecycledExportProject.
+func recycledExportData(dataPath, dotRegolithPath string) error {
+	err := FullRecycledMoveOrCopy(
+		filepath.Join(dotRegolithPath, "tmp/data"), dataPath,
+		RecycledMoveOrCopySettings{
+			canMove:                 true,
+			saveSourceHashes:        true,
+			saveTargetHashes:        false,
+			makeTargetReadOnly:      false,
+			copyTargetAclFromParent: false,
+			reloadSourceHashes:      true,
+		})
+	if err != nil {
+		return WrapError(
+			err, "Failed to move the filter data back to the project's "+
+				"data folder.")
+	}
+	return nil
+}
+
+// clearDataPath deletes the files from the data path before replacing them
+// with the files modified by the filters. The files are deleted using
+// revertible operations. The returned RevertableFsOperations should be used
+// to move the new files to the data path and closed afterwards.
+func clearDataPath(
+	dataPath, dotRegolithPath string,
+) (*RevertableFsOperations, error) {
+	backupPath := filepath.Join(dotRegolithPath, ".dataBackup")
+	revertibleOps, err := NewRevertableFsOperaitons(backupPath)
+	if err != nil {
+		return nil, WrapErrorf(err, "Failed to prepare backup path for revertable"+
+			" file system operations.\n"+
+			"Path that Regolith tried to use: %s", backupPath)
+	}
+	err = deleteDataFiles(dataPath, revertibleOps)
+	if err != nil {
+		revertibleOps.Undo()
+		return nil, PassError(err)
+	}
+	return revertibleOps, nil
+}
+
+// deleteDataFiles deletes the files from the data path using the revertible
+// operations. If the data path doesn't exist, it's created.
+func deleteDataFiles(
+	dataPath string, revertibleOps *RevertableFsOperations,
+) error {
 	// The root of the data path cannot be deleted because the
 	// "regolith watch" function would stop watching the file changes
 	// (due to Windows API limitation).
@@ -225,18 +374,10 @@ func ExportProject(
 				dataPath)
 		}
 	}
-	backupPath := filepath.Join(dotRegolithPath, ".dataBackup")
-	revertibleOps, err := NewRevertableFsOperaitons(backupPath)
-	if err != nil {
-		return WrapErrorf(err, "Failed to prepare backup path for revertable"+
-			" file system operations.\n"+
-			"Path that Regolith tried to use: %s", backupPath)
-	}
 	for _, path := range paths {
 		path := filepath.Join(dataPath, path.Name())
-		err = revertibleOps.DeleteDir(path)
+		err := revertibleOps.DeleteDir(path)
 		if err != nil {
-			revertibleOps.Undo()
 			return WrapError(
 				err, "Failed clear filters data before replacing it with "+
 					"updated version of the files.\n"+
@@ -254,16 +395,15 @@ func ExportProject(
 					"Make sure that you don't open it inside the filters data path.")
 		}
 	}
+	return nil
+}
 
-	Logger.Infof("Exporting behavior pack to \"%s\".", bpPath)
-	err = MoveOrCopy(filepath.Join(dotRegolithPath, "tmp/BP"), bpPath, exportTarget.ReadOnly, true)
-	if err != nil {
-		return WrapError(err, "Failed to export behavior pack.")
-	}
-	Logger.Infof("Exporting project to \"%s\".", rpPath)
-	err = MoveOrCopy(filepath.Join(dotRegolithPath, "tmp/RP"), rpPath, exportTarget.ReadOnly, true)
+// exportData moves the data files of the filters from the tmp directory back
+// to the data path, replacing the old files like ExportProject.
+func exportData(dataPath, dotRegolithPath string) error {
+	revertibleOps, err := clearDataPath(dataPath, dotRegolithPath)
 	if err != nil {
-		return WrapError(err, "Failed to export resource pack.")
+		return PassError(err)
 	}
 	err = revertibleOps.MoveoOrCopyDir(
 		filepath.Join(dotRegolithPath, "tmp/data"), dataPath)
@@ -273,22 +413,22 @@ func ExportProject(
 			err, "Failed to move the filter data back to the project's "+
 				"data folder.")
 	}
-
-	// Update or create edited_files.json
-	err = editedFiles.UpdateFromPaths(rpPath, bpPath)
-	if err != nil {
-		return WrapError(
-			err,
-			"Failed to create a list of files edited by this 'regolith run'")
-	}
-	err = editedFiles.Dump(dotRegolithPath)
-	if err != nil {
-		return WrapError(
-			err, "Failed to update the list of the files edited by Regolith."+
-				"This may cause the next run to fail.")
-	}
 	if err := revertibleOps.Close(); err != nil {
 		return PassError(err)
 	}
 	return nil
 }
+
+// deletionSafetyError wraps the error of the EditedFiles.CheckDeletionSafety
+// function with an explanation for the user.
+func deletionSafetyError(err error, rpPath, bpPath string) error {
+	return WrapErrorf(
+		err,
+		"Safety mechanism stopped Regolith to protect unexpected files "+
+			"from your export targets.\n"+
+			"Did you edit the exported files manually?\n"+
+			"Please clear your export paths and try again.\n"+
+			"Resource pack export path: %s\n"+
+			"Behavior pack export path: %s",
+		rpPath, bpPath)
+}
@@ -0,0 +1,287 @@
+package regolith
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// archiveModTime is the modification time of all of the files in the
+// exported archives. Using a constant time makes the archives with the same
+// content identical. It's the earliest time supported by the zip format.
+var archiveModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Default file name templates of the archive export targets
+const (
+	defaultMcpackFileName  = "{name}_{pack}.mcpack"
+	defaultMcaddonFileName = "{name}.mcaddon"
+	defaultMcworldFileName = "{name}.mcworld"
+)
+
+// defaultArchiveExportPath is the default directory of the archives created
+// by the archive export targets.
+const defaultArchiveExportPath = "build"
+
+// isArchiveExportTarget returns true if the export target creates archives
+// instead of copying the packs to directories.
+func isArchiveExportTarget(target string) bool {
+	return target == "mcpack" || target == "mcaddon" || target == "mcworld"
+}
+
+// archivePack is a pack added to an archive.
+type archivePack struct {
+	// path is the path to the directory with the files of the pack
+	path string
+
+	// short is the short name of the pack ("bp" or "rp")
+	short string
+}
+
+// archiveFileName returns the name of the archive file generated from the
+// template. The "{name}" placeholder is replaced with the name of the
+// project, "{pack}" with the short name of the pack ("bp" or "rp", empty for
+// the mcaddon export target) and "{version}" with the version from the
+// manifest of the pack.
+func archiveFileName(template, name string, pack archivePack) (string, error) {
+	version := ""
+	if strings.Contains(template, "{version}") {
+		var err error
+		version, err = manifestHeaderVersion(pack.path)
+		if err != nil {
+			return "", WrapErrorf(
+				err, "Failed to read the version of the pack from its "+
+					"manifest.\nPack: %s", pack.path)
+		}
+	}
+	result := strings.NewReplacer(
+		"{name}", name, "{pack}", pack.short, "{version}", version,
+	).Replace(template)
+	return result, nil
+}
+
+// exportArchives exports the packs from the tmp directory as archives. The
+// "mcpack" export target creates a separate archive for every pack, the
+// "mcaddon" target creates a single archive with both packs and the "mcworld"
+// target creates a world with both packs. Empty packs are skipped. If the
+// revertibleOps isn't nil, the archives are saved using the revertible
+// operations, so the export can be undone.
+func exportArchives(
+	exportTarget ExportTarget, name, dotRegolithPath string,
+	revertibleOps *RevertableFsOperations,
+) error {
+	if err := validateExportTarget(exportTarget); err != nil {
+		return PassError(err)
+	}
+	packs := []archivePack{}
+	for _, pack := range []archivePack{
+		{path: filepath.Join(dotRegolithPath, "tmp/BP"), short: "bp"},
+		{path: filepath.Join(dotRegolithPath, "tmp/RP"), short: "rp"},
+	} {
+		empty, err := IsDirEmpty(pack.path)
+		if err != nil {
+			return PassError(err)
+		}
+		if empty {
+			Logger.Debugf("Skipping the empty pack: %s", pack.path)
+			continue
+		}
+		packs = append(packs, pack)
+	}
+	if len(packs) == 0 {
+		return WrappedError("There are no files to export.")
+	}
+	exportPath := exportTarget.Path
+	if exportPath == "" {
+		exportPath = defaultArchiveExportPath
+	}
+	fileName := exportTarget.FileName
+	if exportTarget.Target == "mcpack" {
+		if fileName == "" {
+			fileName = defaultMcpackFileName
+		}
+		for _, pack := range packs {
+			archiveName, err := archiveFileName(fileName, name, pack)
+			if err != nil {
+				return PassError(err)
+			}
+			archivePath := filepath.Join(exportPath, archiveName)
+			logEvent(
+				zapcore.InfoLevel, exportEvent,
+				fmt.Sprintf(
+					"Exporting %s archive to \"%s\".",
+					strings.ToUpper(pack.short), archivePath),
+				"pack", strings.ToUpper(pack.short), "path", archivePath)
+			err = writePackArchive(archivePath, map[string]string{
+				"": pack.path,
+			}, nil, revertibleOps)
+			if err != nil {
+				return PassError(err)
+			}
+		}
+		return nil
+	}
+	if exportTarget.Target == "mcworld" {
+		return exportWorldArchive(
+			exportTarget, name, exportPath, packs, revertibleOps)
+	}
+	// mcaddon
+	if fileName == "" {
+		fileName = defaultMcaddonFileName
+	}
+	archiveName, err := archiveFileName(
+		fileName, name, archivePack{path: packs[0].path})
+	if err != nil {
+		return PassError(err)
+	}
+	archivePath := filepath.Join(exportPath, archiveName)
+	logEvent(
+		zapcore.InfoLevel, exportEvent,
+		fmt.Sprintf("Exporting the packs to \"%s\".", archivePath),
+		"pack", "addon", "path", archivePath)
+	dirs := map[string]string{}
+	for _, pack := range packs {
+		dirs[name+"_"+pack.short] = pack.path
+	}
+	err = writePackArchive(archivePath, dirs, nil, revertibleOps)
+	if err != nil {
+		return PassError(err)
+	}
+	return nil
+}
+
+// writePackArchive creates a zip archive with the files of the packs. The
+// dirs map assigns the paths inside of the archive to the directories with
+// the files of the packs (the empty string means the root of the archive).
+// If one of the paths is inside of another one, the files of the more
+// specific directory replace the files of the other one. The files map adds
+// generated files to the archive, which replace the files from the
+// directories. The files are sorted and their timestamps are the same, so the
+// same files always produce identical archives. If the revertibleOps isn't
+// nil, the old archive is moved to its backup directory and the new archive
+// is deleted when the operations are undone.
+func writePackArchive(
+	archivePath string, dirs map[string]string, files map[string][]byte,
+	revertibleOps *RevertableFsOperations,
+) error {
+	// Collect the files
+	type archiveEntry struct {
+		name, path string
+		isDir      bool
+		data       []byte
+	}
+	entries := []archiveEntry{}
+	for name, data := range files {
+		entries = append(entries, archiveEntry{name: name, path: name, data: data})
+	}
+	for archiveDir, dir := range dirs {
+		err := filepath.WalkDir(
+			dir, func(filePath string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				relPath, err := filepath.Rel(dir, filePath)
+				if err != nil {
+					return WrapErrorf(err, filepathRelError, dir, filePath)
+				}
+				name := path.Join(archiveDir, filepath.ToSlash(relPath))
+				if name == "." || name == "" {
+					return nil
+				}
+				if _, ok := dirs[name]; ok && name != archiveDir {
+					return filepath.SkipDir // Added from the other directory
+				}
+				if _, ok := files[name]; ok {
+					return nil
+				}
+				entries = append(entries, archiveEntry{
+					name: name, path: filePath, isDir: d.IsDir()})
+				return nil
+			})
+		if err != nil {
+			return WrapErrorf(err, "Failed to list the files.\nPath: %s", dir)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+	// Write the archive
+	err := os.MkdirAll(filepath.Dir(archivePath), 0755)
+	if err != nil {
+		return WrapErrorf(err, osMkdirError, filepath.Dir(archivePath))
+	}
+	// The archive is written to a temporary file first, so a failed export
+	// doesn't leave a broken archive
+	tmpPath := archivePath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return WrapErrorf(err, "Failed to create the archive.\nPath: %s", tmpPath)
+	}
+	writer := zip.NewWriter(file)
+	for _, entry := range entries {
+		header := &zip.FileHeader{
+			Name:     entry.name,
+			Method:   zip.Deflate,
+			Modified: archiveModTime,
+		}
+		if entry.isDir {
+			header.Name += "/"
+			header.Method = zip.Store
+			header.SetMode(fs.ModeDir | 0755)
+		} else {
+			header.SetMode(0644)
+		}
+		w, err := writer.CreateHeader(header)
+		if err == nil && entry.data != nil {
+			_, err = w.Write(entry.data)
+		} else if err == nil && !entry.isDir {
+			err = copyFileTo(w, entry.path)
+		}
+		if err != nil {
+			writer.Close()
+			file.Close()
+			os.Remove(tmpPath)
+			return WrapErrorf(
+				err, "Failed to add the file to the archive.\n"+
+					"File: %s\nArchive: %s", entry.path, archivePath)
+		}
+	}
+	err = firstErr(writer.Close(), file.Close())
+	if err == nil && revertibleOps != nil {
+		err = revertibleOps.Delete(archivePath)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, archivePath)
+	}
+	if err == nil && revertibleOps != nil {
+		revertibleOps.TrackCreatedFile(archivePath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return WrapErrorf(
+			err, "Failed to save the archive.\nPath: %s", archivePath)
+	}
+	return nil
+}
+
+// copyFileTo copies the content of the file to the writer.
+func copyFileTo(w io.Writer, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return WrapErrorf(err, fileReadError, filePath)
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	if err != nil {
+		return WrapErrorf(err, fileReadError, filePath)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package regolith
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// worldPackFiles are the names of the files that register the packs in a
+// world and the names of the directories with the packs, for the short names
+// of the packs.
+var worldPackFiles = map[string]struct{ registry, dir string }{
+	"bp": {registry: "world_behavior_packs.json", dir: "behavior_packs"},
+	"rp": {registry: "world_resource_packs.json", dir: "resource_packs"},
+}
+
+// exportWorldArchive creates a .mcworld archive from the world template of
+// the export target. The packs are added to the "behavior_packs" and
+// "resource_packs" directories of the world and registered in its
+// "world_behavior_packs.json" and "world_resource_packs.json" files.
+func exportWorldArchive(
+	exportTarget ExportTarget, name, exportPath string, packs []archivePack,
+	revertibleOps *RevertableFsOperations,
+) error {
+	templatePath := exportTarget.WorldTemplate
+	if _, err := os.Stat(filepath.Join(templatePath, "level.dat")); err != nil {
+		return WrapErrorf(
+			err, "The world template doesn't have a level.dat file.\n"+
+				"Path: %s", templatePath)
+	}
+	dirs := map[string]string{"": templatePath}
+	files := map[string][]byte{}
+	for _, pack := range packs {
+		packFiles := worldPackFiles[pack.short]
+		dirs[path.Join(packFiles.dir, name+"_"+pack.short)] = pack.path
+		registry, err := worldPackRegistry(
+			filepath.Join(templatePath, packFiles.registry), pack.path)
+		if err != nil {
+			return PassError(err)
+		}
+		files[packFiles.registry] = registry
+	}
+	fileName := exportTarget.FileName
+	if fileName == "" {
+		fileName = defaultMcworldFileName
+	}
+	archiveName, err := archiveFileName(
+		fileName, name, archivePack{path: packs[0].path})
+	if err != nil {
+		return PassError(err)
+	}
+	archivePath := filepath.Join(exportPath, archiveName)
+	logEvent(
+		zapcore.InfoLevel, exportEvent,
+		fmt.Sprintf("Exporting the world to \"%s\".", archivePath),
+		"pack", "world", "path", archivePath)
+	err = writePackArchive(archivePath, dirs, files, revertibleOps)
+	if err != nil {
+		return PassError(err)
+	}
+	return nil
+}
+
+// worldPackRegistry returns the content of the world_behavior_packs.json or
+// world_resource_packs.json file with the pack from packPath. The entries
+// from the file of the world template (registryPath) are kept, except for
+// the older versions of the same pack.
+func worldPackRegistry(registryPath, packPath string) ([]byte, error) {
+	reference, err := manifestPackReference(packPath)
+	if err != nil {
+		return nil, WrapErrorf(
+			err, "Failed to read the UUID and the version of the pack from "+
+				"its manifest.\nPack: %s", packPath)
+	}
+	registry := []map[string]interface{}{}
+	file, err := ioutil.ReadFile(registryPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, WrapErrorf(err, fileReadError, registryPath)
+	}
+	if err == nil {
+		err = json.Unmarshal(file, &registry)
+		if err != nil {
+			return nil, WrapErrorf(err, jsonUnmarshalError, registryPath)
+		}
+	}
+	result := []map[string]interface{}{reference}
+	for _, entry := range registry {
+		if entry["pack_id"] != reference["pack_id"] {
+			result = append(result, entry)
+		}
+	}
+	registryJson, _ := json.MarshalIndent(result, "", "  ") // no error
+	return registryJson, nil
+}
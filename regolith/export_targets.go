@@ -0,0 +1,167 @@
+package regolith
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// exportTargetPaths is an export target of a profile with multiple targets,
+// with the paths of its packs. The paths are empty for the archive export
+// targets.
+type exportTargetPaths struct {
+	exportTarget   ExportTarget
+	bpPath, rpPath string
+}
+
+// exportMultipleTargets copies the files from the tmp paths (tmp/BP and
+// tmp/RP) to every export target of the profile. The paths of all of the
+// targets are checked before changing any files. The files are exported
+// using revertible operations, so if exporting to one of the targets fails,
+// the other targets are restored to their previous state.
+func exportMultipleTargets(
+	exportTargets ExportTargets, name, dataPath, dotRegolithPath string,
+) error {
+	// Get the paths and check if the files can be deleted
+	editedFiles := LoadEditedFiles(dotRegolithPath)
+	targets := make([]exportTargetPaths, len(exportTargets))
+	usedPaths := map[string]int{}
+	for i, exportTarget := range exportTargets {
+		targets[i].exportTarget = exportTarget
+		if isArchiveExportTarget(exportTarget.Target) {
+			continue
+		}
+		bpPath, rpPath, err := GetExportPaths(exportTarget, name)
+		if err != nil {
+			return WrapErrorf(
+				err, "Failed to get generate export paths.\n"+
+					"Export target: %d", i)
+		}
+		for _, path := range []string{bpPath, rpPath} {
+			fullPath, err := filepath.Abs(path)
+			if err != nil {
+				return WrapErrorf(err, filepathAbsError, path)
+			}
+			if j, ok := usedPaths[fullPath]; ok {
+				return WrappedErrorf(
+					"Multiple export targets use the same path.\n"+
+						"Path: %s\nExport targets: %d, %d", path, j, i)
+			}
+			usedPaths[fullPath] = i
+		}
+		err = editedFiles.CheckDeletionSafety(rpPath, bpPath)
+		if err != nil {
+			return deletionSafetyError(err, rpPath, bpPath)
+		}
+		targets[i].bpPath, targets[i].rpPath = bpPath, rpPath
+	}
+
+	backupPath := filepath.Join(dotRegolithPath, ".exportBackup")
+	revertibleOps, err := NewRevertableFsOperaitons(backupPath)
+	if err != nil {
+		return WrapErrorf(err, "Failed to prepare backup path for revertable"+
+			" file system operations.\n"+
+			"Path that Regolith tried to use: %s", backupPath)
+	}
+	err = exportTargetsRevertibly(targets, name, dotRegolithPath, revertibleOps)
+	if err == nil {
+		err = deleteDataFiles(dataPath, revertibleOps)
+	}
+	if err == nil {
+		err = revertibleOps.MoveoOrCopyDir(
+			filepath.Join(dotRegolithPath, "tmp/data"), dataPath)
+		if err != nil {
+			err = WrapError(
+				err, "Failed to move the filter data back to the project's "+
+					"data folder.")
+		}
+	}
+	if err != nil {
+		if err1 := revertibleOps.Undo(); err1 != nil {
+			return WrapErrorf(
+				err, "Failed to revert the changes in the export targets: "+
+					"%s\nThe backup files are in: %s", err1, backupPath)
+		}
+		if err1 := revertibleOps.Close(); err1 != nil {
+			Logger.Warn(err1)
+		}
+		return WrapError(
+			err, "Failed to export the project. The changes in all of the "+
+				"export targets were reverted.")
+	}
+
+	// Update or create edited_files.json
+	for _, target := range targets {
+		if target.bpPath == "" && target.rpPath == "" {
+			continue
+		}
+		err = editedFiles.UpdateFromPaths(target.rpPath, target.bpPath)
+		if err != nil {
+			return WrapError(
+				err,
+				"Failed to create a list of files edited by this 'regolith run'")
+		}
+	}
+	err = editedFiles.Dump(dotRegolithPath)
+	if err != nil {
+		return WrapError(
+			err, "Failed to update the list of the files edited by Regolith."+
+				"This may cause the next run to fail.")
+	}
+	if err := revertibleOps.Close(); err != nil {
+		return PassError(err)
+	}
+	return nil
+}
+
+// exportTargetsRevertibly replaces the files of the export targets with the
+// files from the tmp directory using the revertible operations. The files
+// are copied, so the tmp directory stays unchanged.
+func exportTargetsRevertibly(
+	targets []exportTargetPaths, name, dotRegolithPath string,
+	revertibleOps *RevertableFsOperations,
+) error {
+	for i, target := range targets {
+		if isArchiveExportTarget(target.exportTarget.Target) {
+			err := exportArchives(
+				target.exportTarget, name, dotRegolithPath, revertibleOps)
+			if err != nil {
+				return WrapErrorf(
+					err, "Failed to export the archives.\nExport target: %d",
+					i)
+			}
+			continue
+		}
+		for _, pack := range []struct{ short, source, target string }{
+			{"BP", "tmp/BP", target.bpPath},
+			{"RP", "tmp/RP", target.rpPath},
+		} {
+			logEvent(
+				zapcore.InfoLevel, exportEvent,
+				fmt.Sprintf("Exporting %s to \"%s\".", pack.short, pack.target),
+				"pack", pack.short, "path", pack.target)
+			if _, err := os.Stat(pack.target); err == nil {
+				err = revertibleOps.DeleteDir(pack.target)
+				if err != nil {
+					return WrapErrorf(
+						err, "Failed to clear %s from export path %q.\n"+
+							"Are user permissions correct?",
+						pack.short, pack.target)
+				}
+			}
+			err := revertibleOps.CopyDir(
+				filepath.Join(dotRegolithPath, pack.source), pack.target)
+			if err != nil {
+				return WrapErrorf(
+					err, "Failed to export %s.\nExport target: %d",
+					pack.short, i)
+			}
+			if target.exportTarget.ReadOnly {
+				makePathReadOnly(pack.target)
+			}
+		}
+	}
+	return nil
+}
@@ -316,6 +316,59 @@ func (r *RevertableFsOperations) MoveoOrCopyDir(source, target string) error {
 	return nil
 }
 
+// CopyDir copies a directory from source to target. The target path must not
+// exist. Unlike MoveoOrCopyDir, it never moves the files, so the source
+// directory can be copied to multiple targets. The undo operations delete
+// the copied files and the created directories.
+func (r *RevertableFsOperations) CopyDir(source, target string) error {
+	if _, err := os.Stat(target); err == nil {
+		return WrappedErrorf(osStatExistsError, target)
+	}
+	err := filepath.WalkDir(
+		source, func(currSourcePath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			sourceRelativePath, err := filepath.Rel(source, currSourcePath)
+			if err != nil {
+				return WrapErrorf(
+					err, filepathRelError, source, currSourcePath)
+			}
+			currTargetPath := filepath.Join(target, sourceRelativePath)
+			if d.IsDir() {
+				err = r.MkdirAll(currTargetPath)
+				if err != nil {
+					return WrapErrorf(err, osMkdirError, currTargetPath)
+				}
+				return nil
+			}
+			err = r.Copy(currSourcePath, currTargetPath)
+			if err != nil {
+				return WrapErrorf(
+					err, osCopyError, currSourcePath, currTargetPath)
+			}
+			return nil
+		})
+	if err != nil {
+		return PassError(err)
+	}
+	return nil
+}
+
+// TrackCreatedFile pushes an operation that deletes the file to the undo
+// stack. It's used for the files created outside of the
+// RevertableFsOperations, which should be removed when the operations are
+// reverted.
+func (r *RevertableFsOperations) TrackCreatedFile(path string) {
+	r.undoOperations = append(r.undoOperations, func() error {
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return WrapErrorf(err, osRemoveError, path)
+		}
+		return nil
+	})
+}
+
 // moveOrCopyAssertions does a common check for move, copy and move or
 // copy operation. It asserts that source path is valid and that the
 // target doesn't exist.
@@ -377,6 +430,7 @@ func (r *RevertableFsOperations) copy(source, target string) error {
 // applied (before calling Close()).
 func (r *RevertableFsOperations) getTempFilePath(base string) string {
 	_, file := filepath.Split(base)
+	r.backupFileCounter++
 	return filepath.Join(
 		r.backupPath, strconv.Itoa(r.backupFileCounter)+"_"+file)
 }
@@ -772,27 +826,33 @@ func MoveOrCopy(
 	}
 	// Make files read only if this option is selected
 	if makeReadOnly {
-		Logger.Infof("Changing the access for output path to "+
-			"read-only.\n\tPath: %s", destination)
-		err := filepath.WalkDir(destination,
-			func(s string, d fs.DirEntry, e error) error {
-
-				if e != nil {
-					// Error messag isn't important as it's not passed further
-					// in the code
-					return e
-				}
-				if !d.IsDir() {
-					os.Chmod(s, 0444)
-				}
-				return nil
-			})
-		if err != nil {
-			Logger.Warnf(
-				"Failed to change access of the output path to read-only.\n"+
-					"\tPath: %s",
-				destination)
-		}
+		makePathReadOnly(destination)
 	}
 	return nil
 }
+
+// makePathReadOnly changes the access of the files in the path to read-only.
+// Failing to change the access is not critical, so it only prints a warning.
+func makePathReadOnly(path string) {
+	Logger.Infof("Changing the access for output path to "+
+		"read-only.\n\tPath: %s", path)
+	err := filepath.WalkDir(path,
+		func(s string, d fs.DirEntry, e error) error {
+
+			if e != nil {
+				// Error messag isn't important as it's not passed further
+				// in the code
+				return e
+			}
+			if !d.IsDir() {
+				os.Chmod(s, 0444)
+			}
+			return nil
+		})
+	if err != nil {
+		Logger.Warnf(
+			"Failed to change access of the output path to read-only.\n"+
+				"\tPath: %s",
+			path)
+	}
+}
@@ -1,7 +1,21 @@
 package regolith
 
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
 type FilterDefinition struct {
 	Id string `json:"-"`
+
+	// Protocol is the version of the filter protocol used by the filter, 0
+	// if the filter doesn't use it. Only the Python, NodeJS, Java and shell
+	// filters support the protocol.
+	Protocol int `json:"protocol,omitempty"`
 }
 
 type Filter struct {
@@ -10,6 +24,14 @@ type Filter struct {
 	Disabled    bool                   `json:"disabled,omitempty"`
 	Arguments   []string               `json:"arguments,omitempty"`
 	Settings    map[string]interface{} `json:"settings,omitempty"`
+	DependsOn   []string               `json:"dependsOn,omitempty"`
+	Inputs      []string               `json:"inputs,omitempty"`
+	Timeout     string                 `json:"timeout,omitempty"`
+	When        string                 `json:"when,omitempty"`
+
+	// when is the parsed When expression, nil if the filter doesn't have
+	// one
+	when whenExpression
 }
 
 type RunContext struct {
@@ -18,6 +40,7 @@ type RunContext struct {
 	Profile          string
 	Parent           *RunContext
 	DotRegolithPath  string
+	Options          RunOptions
 
 	// interruptionChannel is a channel that is used to notify about changes
 	// in the sourec files, in order to trigger a restart of the program in
@@ -25,6 +48,31 @@ type RunContext struct {
 	// of the change ("rp", "bp" or "data"), which may be used to handle
 	// some interuptions differently.
 	interruptionChannel chan string
+
+	// ctx is canceled when the subprocesses of the filters should be killed,
+	// for example when a filter reaches its timeout. If it's nil, the
+	// subprocesses are never killed.
+	ctx context.Context
+
+	// remoteFilters are the names of the remote filters that run the
+	// current filter as their subfilter, starting with the filter from the
+	// profile. It's used for detecting the cycles of the remote filters.
+	remoteFilters []string
+}
+
+// enterRemoteFilter returns the list of the remote filters for the
+// subfilters of the remote filter with the name. It returns an error if
+// the filter is already on the list, because it would run itself.
+func (c *RunContext) enterRemoteFilter(name string) ([]string, error) {
+	remoteFilters := append(append([]string{}, c.remoteFilters...), name)
+	for _, remoteFilter := range c.remoteFilters {
+		if remoteFilter == name {
+			return nil, WrappedErrorf(
+				"Detected a cycle of remote filters that use each other.\n"+
+					"Filter chain: %s", remoteFilterChain(remoteFilters))
+		}
+	}
+	return remoteFilters, nil
 }
 
 // GetProfile returns the Profile structure from the context.
@@ -40,7 +88,7 @@ func (c *RunContext) GetProfile() (Profile, error) {
 // IsWatchMode returns a value that shows whether the context is in the
 // watch mode.
 func (c *RunContext) IsInWatchMode() bool {
-	return c.interruptionChannel == nil
+	return c.interruptionChannel != nil
 }
 
 // StartWatchingSourceFiles causes the Context to start goroutines that watch
@@ -53,17 +101,39 @@ func (c *RunContext) StartWatchingSrouceFiles() error {
 	if c.interruptionChannel != nil {
 		return WrappedError("Files are already being watched.")
 	}
-	rpWatcher, err := NewDirWatcher(c.Config.ResourceFolder)
+	profile, err := c.GetProfile()
 	if err != nil {
-		return WrapError(err, "Could not create resource pack watcher.")
+		return WrapErrorf(err, runContextGetProfileError)
 	}
-	bpWatcher, err := NewDirWatcher(c.Config.BehaviorFolder)
-	if err != nil {
-		return WrapError(err, "Could not create behavior pack watcher.")
+	packs, dataPath := c.Config.profileSources(profile)
+	// The paths to watch and the names of the sources of their changes
+	type watchedPath struct{ path, sourceName, description string }
+	paths := []watchedPath{
+		{packs.ResourceFolder, "rp", "resource pack"},
+		{packs.BehaviorFolder, "bp", "behavior pack"},
+		{dataPath, "data", "data"},
 	}
-	dataWatcher, err := NewDirWatcher(c.Config.DataPath)
-	if err != nil {
-		return WrapError(err, "Could not create data watcher.")
+	for _, extraPacks := range profile.ExtraPacks {
+		if extraPacks.ResourceFolder != "" {
+			paths = append(paths, watchedPath{
+				extraPacks.ResourceFolder, "rp", "extra resource pack"})
+		}
+		if extraPacks.BehaviorFolder != "" {
+			paths = append(paths, watchedPath{
+				extraPacks.BehaviorFolder, "bp", "extra behavior pack"})
+		}
+	}
+	watchers := []*DirWatcher{}
+	for _, path := range paths {
+		watcher, err := NewDirWatcher(path.path)
+		if err != nil {
+			for _, watcher := range watchers {
+				watcher.Close()
+			}
+			return WrapErrorf(
+				err, "Could not create %s watcher.", path.description)
+		}
+		watchers = append(watchers, watcher)
 	}
 	c.interruptionChannel = make(chan string)
 	yieldChanges := func(
@@ -77,16 +147,23 @@ func (c *RunContext) StartWatchingSrouceFiles() error {
 			}
 		}
 	}
-	go yieldChanges(rpWatcher, "rp")
-	go yieldChanges(bpWatcher, "bp")
-	go yieldChanges(dataWatcher, "data")
+	for i, watcher := range watchers {
+		go yieldChanges(watcher, paths[i].sourceName)
+	}
 	return nil
 }
 
 // AwaitInterruption locks the goroutine with the interruption channel until
 // the Config is interrupted and returns the interruption message.
+// If the context.Context of the RunContext is canceled, it returns an empty
+// string.
 func (c *RunContext) AwaitInterruption() string {
-	return <-c.interruptionChannel
+	select {
+	case source := <-c.interruptionChannel:
+		return source
+	case <-c.cancelContext().Done():
+		return ""
+	}
 }
 
 // IsInterrupted returns true if there is a message on the interruptionChannel
@@ -109,6 +186,43 @@ func (c *RunContext) IsInterrupted(ignoredSourece ...string) bool {
 	}
 }
 
+// cancelContext returns the context.Context used for killing the
+// subprocesses of the filters.
+func (c *RunContext) cancelContext() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// handleInterruptSignal makes the context.Context of the RunContext
+// canceled when the user presses Ctrl+C. The subprocesses of the filters
+// run in their own process groups, so they don't receive the signal from
+// the terminal and they have to be killed by Regolith. The returned function
+// restores the default handling of the signal.
+func (c *RunContext) handleInterruptSignal() func() {
+	ctx, stop := signal.NotifyContext(
+		c.cancelContext(), os.Interrupt, syscall.SIGTERM)
+	c.ctx = ctx
+	return stop
+}
+
+// isStopped returns true if the context.Context of the RunContext was
+// canceled.
+func (c *RunContext) isStopped() bool {
+	return c.cancelContext().Err() != nil
+}
+
+// withCancel returns a copy of the RunContext with a context.Context that
+// can be canceled with the returned function. It's used to stop multiple
+// filters at once.
+func (c *RunContext) withCancel() (RunContext, context.CancelFunc) {
+	result := *c
+	ctx, cancel := context.WithCancel(c.cancelContext())
+	result.ctx = ctx
+	return result, cancel
+}
+
 func FilterDefinitionFromObject(id string) *FilterDefinition {
 	return &FilterDefinition{Id: id}
 }
@@ -122,18 +236,55 @@ func filterFromObject(obj map[string]interface{}) (*Filter, error) {
 	disabled, _ := obj["disabled"].(bool)
 	filter.Disabled = disabled
 	// Arguments
-	arguments, ok := obj["arguments"].([]interface{})
-	if !ok {
-		arguments = nil
-	}
-	s := make([]string, len(arguments))
-	for i, v := range arguments {
-		s[i] = v.(string)
+	arguments, err := stringArrayFromObject(obj, "arguments")
+	if err != nil {
+		return nil, PassError(err)
 	}
-	filter.Arguments = s
+	filter.Arguments = arguments
 	// Settings
 	settings, _ := obj["settings"].(map[string]interface{})
 	filter.Settings = settings
+	// DependsOn
+	dependsOn, err := stringArrayFromObject(obj, "dependsOn")
+	if err != nil {
+		return nil, PassError(err)
+	}
+	filter.DependsOn = dependsOn
+	// Inputs
+	inputs, err := stringArrayFromObject(obj, "inputs")
+	if err != nil {
+		return nil, PassError(err)
+	}
+	for i, input := range inputs {
+		if err := validateInputGlob(input); err != nil {
+			return nil, WrapErrorf(
+				err, jsonPropertyParseError, fmt.Sprintf("inputs->%d", i))
+		}
+	}
+	filter.Inputs = inputs
+	// Timeout
+	if timeoutObj, ok := obj["timeout"]; ok {
+		timeout, ok := timeoutObj.(string)
+		if !ok {
+			return nil, WrappedErrorf(jsonPropertyTypeError, "timeout", "string")
+		}
+		if _, err := parseFilterTimeout(timeout); err != nil {
+			return nil, WrapErrorf(err, jsonPropertyParseError, "timeout")
+		}
+		filter.Timeout = timeout
+	}
+	// When
+	if whenObj, ok := obj["when"]; ok {
+		when, ok := whenObj.(string)
+		if !ok {
+			return nil, WrappedErrorf(jsonPropertyTypeError, "when", "string")
+		}
+		filter.when, err = parseWhenExpression(when)
+		if err != nil {
+			return nil, WrapErrorf(err, jsonPropertyParseError, "when")
+		}
+		filter.When = when
+	}
 
 	// Id
 	idObj, ok := obj["filter"]
@@ -148,8 +299,39 @@ func filterFromObject(obj map[string]interface{}) (*Filter, error) {
 	return filter, nil
 }
 
+// stringArrayFromObject parses an optional property of a filter which is
+// an array of strings. If the property is missing, nil is returned.
+func stringArrayFromObject(
+	obj map[string]interface{}, property string,
+) ([]string, error) {
+	arrayObj, ok := obj[property]
+	if !ok {
+		return nil, nil
+	}
+	array, ok := arrayObj.([]interface{})
+	if !ok {
+		return nil, WrappedErrorf(jsonPropertyTypeError, property, "array")
+	}
+	result := make([]string, len(array))
+	for i, v := range array {
+		str, ok := v.(string)
+		if !ok {
+			return nil, WrappedErrorf(
+				jsonPropertyTypeError, fmt.Sprintf("%s->%d", property, i),
+				"string")
+		}
+		result[i] = str
+	}
+	return result, nil
+}
+
 type FilterInstaller interface {
-	InstallDependencies(parent *RemoteFilterDefinition, dotRegolithPath string) error
+	// InstallDependencies installs the dependencies of the filter. In
+	// offline mode, the dependencies can't be downloaded, so only the
+	// already installed or cached dependencies can be used.
+	InstallDependencies(
+		parent *RemoteFilterDefinition, dotRegolithPath string, offline bool,
+	) error
 	Check(context RunContext) error
 	CreateFilterRunner(runConfiguration map[string]interface{}) (FilterRunner, error)
 }
@@ -165,12 +347,28 @@ type FilterRunner interface {
 	// disabled it always returns false.
 	Run(context RunContext) (bool, error)
 
-	// IsDisabled returns whether the filter is disabled.
-	IsDisabled() bool
+	// IsDisabled returns whether the filter is disabled. The filter is
+	// disabled by its "disabled" property or when its "when" expression is
+	// false for the variables of the context.
+	IsDisabled(context RunContext) bool
 
 	// GetId returns the id of the filter.
 	GetId() string
 
+	// GetDependsOn returns the ids of the filters that must finish before
+	// this filter can run. It's used only by the profiles that run their
+	// filters in parallel.
+	GetDependsOn() []string
+
+	// GetInputs returns the glob patterns of the files from the temporary
+	// directory used by the filter. Filters with inputs can be skipped if
+	// their inputs didn't change since the last run.
+	GetInputs() []string
+
+	// GetTimeout returns the maximal time of running the filter. Zero means
+	// that the filter can run indefinitely.
+	GetTimeout() time.Duration
+
 	// Check checks whether the requirements of the filter are met. For
 	// example, a Python filter requires Python to be installed.
 	Check(context RunContext) error
@@ -193,8 +391,25 @@ func (f *Filter) GetId() string {
 	return f.Id
 }
 
-func (f *Filter) IsDisabled() bool {
-	return f.Disabled
+func (f *Filter) GetDependsOn() []string {
+	return f.DependsOn
+}
+
+func (f *Filter) GetInputs() []string {
+	return f.Inputs
+}
+
+func (f *Filter) GetTimeout() time.Duration {
+	// The timeout is validated when the filter is parsed
+	timeout, _ := parseFilterTimeout(f.Timeout)
+	return timeout
+}
+
+func (f *Filter) IsDisabled(context RunContext) bool {
+	if f.Disabled {
+		return true
+	}
+	return f.when != nil && !isWhenValueTrue(f.when(context))
 }
 
 func FilterInstallerFromObject(id string, obj map[string]interface{}) (FilterInstaller, error) {
@@ -281,7 +496,7 @@ func FilterInstallerFromObject(id string, obj map[string]interface{}) (FilterIns
 			"Filter: %s\n"+
 			"Value: %s\n"+
 			"Valid values: java, dotnet, nim, deno, nodejs, python, shell, exe",
-		runWith, id)
+		id, runWith)
 }
 
 func FilterRunnerFromObjectAndDefinitions(
@@ -289,7 +504,14 @@ func FilterRunnerFromObjectAndDefinitions(
 ) (FilterRunner, error) {
 	profile, ok := obj["profile"].(string)
 	if ok {
-		return &ProfileFilter{Profile: profile}, nil
+		dependsOn, err := stringArrayFromObject(obj, "dependsOn")
+		if err != nil {
+			return nil, PassError(err)
+		}
+		return &ProfileFilter{
+			Filter:  Filter{DependsOn: dependsOn},
+			Profile: profile,
+		}, nil
 	}
 	filterObj, ok := obj["filter"]
 	if !ok {
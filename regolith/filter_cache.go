@@ -0,0 +1,373 @@
+package regolith
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// filterOutputCachePath is the path to the directory with the cached outputs
+// of the filters, relative to the .regolith directory.
+const filterOutputCachePath = "cache/filter_outputs"
+
+// filterOutputInfo is the content of the "info.json" file stored together
+// with the cached output of a filter. The output of the filter is the list of
+// the paths it created or modified in the temporary directory and the list
+// of the paths it deleted. The modified files are stored in the "files"
+// directory next to the "info.json" file.
+type filterOutputInfo struct {
+	// Fingerprint is the fingerprint of the filter (see filterFingerprint)
+	// from the run that produced the output.
+	Fingerprint string `json:"fingerprint"`
+
+	// Changed is the list of the created or modified paths. Directories have
+	// empty hashes.
+	Changed []PathHashPair `json:"changed"`
+
+	// Deleted is the list of the deleted paths.
+	Deleted []string `json:"deleted"`
+}
+
+// filterFingerprintData is the data used to calculate the fingerprint of
+// a filter.
+type filterFingerprintData struct {
+	// Filter is the JSON representation of the filter. It contains its ID,
+	// settings, arguments and the inputs patterns.
+	Filter  json.RawMessage `json:"filter"`
+	Version string          `json:"version"`
+	Inputs  []PathHashPair  `json:"inputs"`
+}
+
+// validateInputGlob checks whether the glob pattern from the "inputs"
+// property of a filter is valid.
+func validateInputGlob(pattern string) error {
+	for _, part := range strings.Split(normalizeInputGlob(pattern), "/") {
+		if _, err := path.Match(part, ""); err != nil {
+			return WrapErrorf(err, "Invalid glob pattern.\nPattern: %s", pattern)
+		}
+	}
+	return nil
+}
+
+// normalizeInputGlob converts the glob pattern from the "inputs" property of
+// a filter to the form used by matchInputGlob.
+func normalizeInputGlob(pattern string) string {
+	return strings.TrimPrefix(filepath.ToSlash(pattern), "./")
+}
+
+// matchInputGlob checks whether the path relative to the temporary directory
+// matches the glob pattern. The pattern uses the syntax of path.Match, with
+// the addition of "**" which matches any number of directories.
+func matchInputGlob(pattern, relPath string) bool {
+	return matchInputGlobParts(
+		strings.Split(normalizeInputGlob(pattern), "/"),
+		strings.Split(filepath.ToSlash(relPath), "/"))
+}
+
+func matchInputGlobParts(pattern, pathParts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(pathParts); i++ {
+				if matchInputGlobParts(pattern[1:], pathParts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(pathParts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], pathParts[0]); !ok {
+			return false
+		}
+		pattern, pathParts = pattern[1:], pathParts[1:]
+	}
+	return len(pathParts) == 0
+}
+
+// filterVersion returns a string that changes when the code of the filter
+// changes. For remote filters it's based on the files of the installed
+// filter. For local filters it's based on their script or executable. Shell
+// filters use their command.
+func filterVersion(filter FilterRunner, context RunContext) (string, error) {
+	var sourcePath string
+	version := ""
+	switch f := filter.(type) {
+	case *RemoteFilter:
+		sourcePath = f.GetDownloadPath(context.DotRegolithPath)
+		version = f.Definition.Url + "@" + f.Definition.Version
+	case *PythonFilter:
+		sourcePath = f.Definition.Script
+	case *NodeJSFilter:
+		sourcePath = f.Definition.Script
+	case *DenoFilter:
+		sourcePath = f.Definition.Script
+	case *NimFilter:
+		sourcePath = f.Definition.Script
+	case *JavaFilter:
+		sourcePath = f.Definition.Script
+	case *DotNetFilter:
+		sourcePath = f.Definition.Path
+	case *ExeFilter:
+		sourcePath = f.Definition.Exe
+	case *ShellFilter:
+		version = f.Definition.Command
+	}
+	if sourcePath == "" {
+		return version, nil
+	}
+	if !filepath.IsAbs(sourcePath) {
+		sourcePath = filepath.Join(context.AbsoluteLocation, sourcePath)
+	}
+	stat, err := os.Stat(sourcePath)
+	if err != nil {
+		// The filter will fail anyway, the version doesn't matter
+		return version, nil
+	}
+	if !stat.IsDir() {
+		hash, err := getPathHash(sourcePath, crc32.NewIEEE())
+		if err != nil {
+			return "", PassError(err)
+		}
+		return version + ":" + hash, nil
+	}
+	state, err := GetStateFromPath(sourcePath, crc32.NewIEEE())
+	if err != nil {
+		return "", PassError(err)
+	}
+	stateSlice, err := stateToPathHashPairSlice(state)
+	if err != nil {
+		return "", PassError(err)
+	}
+	stateJson, err := json.Marshal(stateSlice)
+	if err != nil {
+		return "", PassError(err)
+	}
+	return version + ":" + hashBytes(stateJson), nil
+}
+
+// filterFingerprint returns a fingerprint of the filter based on the state
+// of the temporary directory before running the filter. The fingerprint
+// includes the hashes of the files matching the inputs of the filter, its
+// settings, arguments and version.
+func filterFingerprint(
+	filter FilterRunner, context RunContext, tmpState *list.List,
+) (string, error) {
+	version, err := filterVersion(filter, context)
+	if err != nil {
+		return "", WrapErrorf(
+			err, "Failed to get the version of the filter.\nFilter: %s",
+			filter.GetId())
+	}
+	filterJson, err := json.Marshal(filter)
+	if err != nil {
+		return "", WrapError(err, "Failed to encode the filter.")
+	}
+	data := filterFingerprintData{
+		Filter:  filterJson,
+		Version: version,
+		Inputs:  []PathHashPair{},
+	}
+	for e := tmpState.Front(); e != nil; e = e.Next() {
+		pair := e.Value.(PathHashPair)
+		for _, pattern := range filter.GetInputs() {
+			if matchInputGlob(pattern, pair.Path) {
+				pair.Path = filepath.ToSlash(pair.Path)
+				data.Inputs = append(data.Inputs, pair)
+				break
+			}
+		}
+	}
+	dataJson, err := json.Marshal(data)
+	if err != nil {
+		return "", WrapError(err, "Failed to encode the fingerprint data.")
+	}
+	return hashBytes(dataJson), nil
+}
+
+// hashBytes returns the hex encoded SHA-256 hash of the data.
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// runFilterWithCache runs the filter unless it declares its inputs and its
+// fingerprint matches the fingerprint saved in the cache from the last run.
+// In that case, the cached output of the filter is restored instead. The
+// index is the position of the filter in the profile, which together with the
+// name of the profile identifies the cache entry of the filter.
+func runFilterWithCache(
+	context RunContext, filter FilterRunner, index int,
+) (bool, error) {
+	if len(filter.GetInputs()) == 0 {
+		return runFilter(context, filter)
+	}
+	tmpPath := filepath.Join(context.DotRegolithPath, "tmp")
+	cachePath := filepath.Join(
+		context.DotRegolithPath, filterOutputCachePath, context.Profile,
+		fmt.Sprint(index))
+	before, err := GetStateFromPath(tmpPath, crc32.NewIEEE())
+	if err != nil {
+		return false, WrapErrorf(
+			err, "Failed to get the state of the temporary directory.\n"+
+				"Path: %s", tmpPath)
+	}
+	fingerprint, err := filterFingerprint(filter, context, before)
+	if err != nil {
+		return false, WrapError(
+			err, "Failed to calculate the fingerprint of the filter.")
+	}
+	info, err := loadFilterOutputInfo(cachePath)
+	if err == nil && info.Fingerprint == fingerprint {
+		err = restoreFilterOutput(cachePath, tmpPath, info)
+		if err == nil {
+			Logger.Infof(
+				"Inputs of filter %s didn't change, using the cached output.",
+				filter.GetId())
+			return context.IsInterrupted(), nil
+		}
+		// The files could be partially restored, so running the filter
+		// now could produce invalid results
+		return false, WrapError(
+			err, "Failed to restore the cached output of the filter.\n"+
+				"Clean the cache with \"regolith clean\" and try again.")
+	}
+	// The old output is invalid now
+	if err := os.RemoveAll(cachePath); err != nil {
+		return false, WrapErrorf(err, osRemoveError, cachePath)
+	}
+	interrupted, err := runFilter(context, filter)
+	if err != nil {
+		return false, PassError(err)
+	}
+	if interrupted {
+		// The filter could be stopped before it finished, so its output is
+		// incomplete and it must run again next time
+		return true, nil
+	}
+	after, err := GetStateFromPath(tmpPath, crc32.NewIEEE())
+	if err == nil {
+		err = saveFilterOutput(cachePath, tmpPath, fingerprint, before, after)
+	}
+	if err != nil {
+		// Not critical, the filter will run again next time
+		os.RemoveAll(cachePath)
+		Logger.Warnf(
+			"Failed to save the output of filter %s in the cache.\n%s",
+			filter.GetId(), err.Error())
+	}
+	return interrupted, nil
+}
+
+// loadFilterOutputInfo loads the "info.json" file of the cached filter output.
+func loadFilterOutputInfo(cachePath string) (filterOutputInfo, error) {
+	result := filterOutputInfo{}
+	infoPath := filepath.Join(cachePath, "info.json")
+	file, err := ioutil.ReadFile(infoPath)
+	if err != nil {
+		return result, WrapErrorf(err, fileReadError, infoPath)
+	}
+	err = json.Unmarshal(file, &result)
+	if err != nil {
+		return result, WrapErrorf(err, jsonUnmarshalError, infoPath)
+	}
+	return result, nil
+}
+
+// saveFilterOutput compares the states of the temporary directory from before
+// and after running the filter and saves the differences in the cache.
+func saveFilterOutput(
+	cachePath, tmpPath, fingerprint string, before, after *list.List,
+) error {
+	info := filterOutputInfo{
+		Fingerprint: fingerprint,
+		Changed:     []PathHashPair{},
+		Deleted:     []string{},
+	}
+	if err := os.MkdirAll(cachePath, 0755); err != nil {
+		return WrapErrorf(err, osMkdirError, cachePath)
+	}
+	beforeHashes := map[string]string{}
+	for e := before.Front(); e != nil; e = e.Next() {
+		pair := e.Value.(PathHashPair)
+		beforeHashes[pair.Path] = pair.Hash
+	}
+	afterPaths := map[string]struct{}{}
+	filesPath := filepath.Join(cachePath, "files")
+	for e := after.Front(); e != nil; e = e.Next() {
+		pair := e.Value.(PathHashPair)
+		afterPaths[pair.Path] = struct{}{}
+		if hash, ok := beforeHashes[pair.Path]; ok && hash == pair.Hash {
+			continue
+		}
+		info.Changed = append(info.Changed, pair)
+		if pair.Hash == "" {
+			continue // Directories are created on restoration
+		}
+		source := filepath.Join(tmpPath, pair.Path)
+		target := filepath.Join(filesPath, pair.Path)
+		if err := CopyFile(source, target); err != nil {
+			return WrapErrorf(err, osCopyError, source, target)
+		}
+	}
+	for e := before.Front(); e != nil; e = e.Next() {
+		pair := e.Value.(PathHashPair)
+		if _, ok := afterPaths[pair.Path]; !ok {
+			info.Deleted = append(info.Deleted, pair.Path)
+		}
+	}
+	infoJson, err := json.MarshalIndent(info, "", "\t")
+	if err != nil {
+		return WrapError(err, "Failed to encode the filter output info.")
+	}
+	infoPath := filepath.Join(cachePath, "info.json")
+	err = ioutil.WriteFile(infoPath, infoJson, 0644)
+	if err != nil {
+		return WrapErrorf(err, fileWriteError, infoPath)
+	}
+	return nil
+}
+
+// restoreFilterOutput applies the cached output of the filter to the
+// temporary directory.
+func restoreFilterOutput(
+	cachePath, tmpPath string, info filterOutputInfo,
+) error {
+	for _, deleted := range info.Deleted {
+		deletedPath := filepath.Join(tmpPath, deleted)
+		if err := os.RemoveAll(deletedPath); err != nil {
+			return WrapErrorf(err, osRemoveError, deletedPath)
+		}
+	}
+	// The paths are sorted, so the directories are created before their
+	// contents
+	for _, changed := range info.Changed {
+		target := filepath.Join(tmpPath, changed.Path)
+		stat, err := os.Stat(target)
+		if err == nil && stat.IsDir() != (changed.Hash == "") {
+			// The type of the path changed
+			if err := os.RemoveAll(target); err != nil {
+				return WrapErrorf(err, osRemoveError, target)
+			}
+		}
+		if changed.Hash == "" {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return WrapErrorf(err, osMkdirError, target)
+			}
+			continue
+		}
+		source := filepath.Join(cachePath, "files", changed.Path)
+		if err := CopyFile(source, target); err != nil {
+			return WrapErrorf(err, osCopyError, source, target)
+		}
+	}
+	return nil
+}
@@ -35,8 +35,8 @@ func DenoFilterDefinitionFromObject(id string, obj map[string]interface{}) (*Den
 func (f *DenoFilter) run(context RunContext) error {
 	// Run filter
 	if len(f.Settings) == 0 {
-		err := RunSubProcess(
-			"deno",
+		err := RunSubProcessContext(
+			context.cancelContext(), "deno",
 			append([]string{
 				"run",
 				context.AbsoluteLocation + string(os.PathSeparator) +
@@ -52,8 +52,8 @@ func (f *DenoFilter) run(context RunContext) error {
 		}
 	} else {
 		jsonSettings, _ := json.Marshal(f.Settings)
-		err := RunSubProcess(
-			"deno",
+		err := RunSubProcessContext(
+			context.cancelContext(), "deno",
 			append([]string{
 				"run",
 				context.AbsoluteLocation + string(os.PathSeparator) +
@@ -106,7 +106,7 @@ func (f *DenoFilterDefinition) Check(context RunContext) error {
 }
 
 func (f *DenoFilterDefinition) InstallDependencies(
-	parent *RemoteFilterDefinition, dotRegolithPath string,
+	parent *RemoteFilterDefinition, dotRegolithPath string, offline bool,
 ) error {
 	return nil
 }
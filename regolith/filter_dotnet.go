@@ -39,8 +39,8 @@ func (f *DotNetFilter) Run(context RunContext) (bool, error) {
 func (f *DotNetFilter) run(context RunContext) error {
 	// Run the filter
 	if len(f.Settings) == 0 {
-		err := RunSubProcess(
-			"dotnet",
+		err := RunSubProcessContext(
+			context.cancelContext(), "dotnet",
 			append(
 				[]string{
 					context.AbsoluteLocation + string(os.PathSeparator) +
@@ -57,8 +57,8 @@ func (f *DotNetFilter) run(context RunContext) error {
 		}
 	} else {
 		jsonSettings, _ := json.Marshal(f.Settings)
-		err := RunSubProcess(
-			"dotnet",
+		err := RunSubProcessContext(
+			context.cancelContext(), "dotnet",
 			append(
 				[]string{
 					context.AbsoluteLocation + string(os.PathSeparator) +
@@ -88,7 +88,7 @@ func (f *DotNetFilterDefinition) CreateFilterRunner(runConfiguration map[string]
 	return filter, nil
 }
 
-func (f *DotNetFilterDefinition) InstallDependencies(*RemoteFilterDefinition, string) error {
+func (f *DotNetFilterDefinition) InstallDependencies(*RemoteFilterDefinition, string, bool) error {
 	return nil
 }
 
@@ -1,6 +1,7 @@
 package regolith
 
 import (
+	"context"
 	"encoding/json"
 	"path/filepath"
 )
@@ -56,7 +57,7 @@ func (f *ExeFilterDefinition) CreateFilterRunner(
 }
 
 func (f *ExeFilterDefinition) InstallDependencies(
-	*RemoteFilterDefinition, string,
+	*RemoteFilterDefinition, string, bool,
 ) error {
 	return nil
 }
@@ -75,13 +76,13 @@ func (f *ExeFilter) run(
 ) error {
 	var err error = nil
 	if len(settings) == 0 {
-		err = executeExeFile(f.Id,
+		err = executeExeFile(context.cancelContext(), f.Id,
 			f.Definition.Exe,
 			f.Arguments, context.AbsoluteLocation,
 			GetAbsoluteWorkingDirectory(context.DotRegolithPath))
 	} else {
 		jsonSettings, _ := json.Marshal(settings)
-		err = executeExeFile(f.Id,
+		err = executeExeFile(context.cancelContext(), f.Id,
 			f.Definition.Exe,
 			append([]string{string(jsonSettings)}, f.Arguments...),
 			context.AbsoluteLocation, GetAbsoluteWorkingDirectory(
@@ -94,12 +95,12 @@ func (f *ExeFilter) run(
 	return nil
 }
 
-func executeExeFile(id string,
+func executeExeFile(ctx context.Context, id string,
 	exe string, args []string, filterDir string, workingDir string,
 ) error {
 	exe = filepath.Join(filterDir, exe)
 	Logger.Debugf("Running exe file %s:", exe)
-	err := RunSubProcess(exe, args, filterDir, workingDir, id)
+	err := RunSubProcessContext(ctx, exe, args, filterDir, workingDir, id)
 	if err != nil {
 		return WrapErrorf(err, runSubProcessError)
 	}
@@ -39,6 +39,11 @@ func JavaFilterDefinitionFromObject(id string, obj map[string]interface{}) (*Jav
 		}
 	}
 	filter.Script = path
+	protocol, err := filterProtocolFromObject(obj)
+	if err != nil {
+		return nil, PassError(err)
+	}
+	filter.Protocol = protocol
 	return filter, nil
 }
 func (f *JavaFilter) Run(context RunContext) (bool, error) {
@@ -50,9 +55,21 @@ func (f *JavaFilter) Run(context RunContext) (bool, error) {
 
 func (f *JavaFilter) run(context RunContext) error {
 	// Run the filter
+	if f.Definition.Protocol != noFilterProtocol {
+		err := runProtocolFilter(
+			context, f.Id, f.Settings, f.Arguments, "java",
+			[]string{
+				"-jar", context.AbsoluteLocation + string(os.PathSeparator) +
+					f.Definition.Script,
+			}, "")
+		if err != nil {
+			return WrapError(err, "Failed to run Java filter")
+		}
+		return nil
+	}
 	if len(f.Settings) == 0 {
-		err := RunSubProcess(
-			"java",
+		err := RunSubProcessContext(
+			context.cancelContext(), "java",
 			append(
 				[]string{
 					"-jar", context.AbsoluteLocation + string(os.PathSeparator) +
@@ -69,8 +86,8 @@ func (f *JavaFilter) run(context RunContext) error {
 		}
 	} else {
 		jsonSettings, _ := json.Marshal(f.Settings)
-		err := RunSubProcess(
-			"java",
+		err := RunSubProcessContext(
+			context.cancelContext(), "java",
 			append(
 				[]string{
 					"-jar", context.AbsoluteLocation + string(os.PathSeparator) +
@@ -100,7 +117,7 @@ func (f *JavaFilterDefinition) CreateFilterRunner(runConfiguration map[string]in
 	return filter, nil
 }
 
-func (f *JavaFilterDefinition) InstallDependencies(*RemoteFilterDefinition, string) error {
+func (f *JavaFilterDefinition) InstallDependencies(*RemoteFilterDefinition, string, bool) error {
 	return nil
 }
 
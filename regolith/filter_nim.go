@@ -38,8 +38,8 @@ func NimFilterDefinitionFromObject(
 func (f *NimFilter) run(context RunContext) error {
 	// Run filter
 	if len(f.Settings) == 0 {
-		err := RunSubProcess(
-			"nim",
+		err := RunSubProcessContext(
+			context.cancelContext(), "nim",
 			append([]string{
 				"-r", "c", "--hints:off", "--warnings:off",
 				context.AbsoluteLocation + string(os.PathSeparator) + f.Definition.Script},
@@ -54,8 +54,8 @@ func (f *NimFilter) run(context RunContext) error {
 		}
 	} else {
 		jsonSettings, _ := json.Marshal(f.Settings)
-		err := RunSubProcess(
-			"nim",
+		err := RunSubProcessContext(
+			context.cancelContext(), "nim",
 			append([]string{
 				"-r", "c", "--hints:off", "--warnings:off",
 				context.AbsoluteLocation + string(os.PathSeparator) +
@@ -93,7 +93,7 @@ func (f *NimFilterDefinition) CreateFilterRunner(runConfiguration map[string]int
 }
 
 func (f *NimFilterDefinition) InstallDependencies(
-	parent *RemoteFilterDefinition, dotRegolithPath string,
+	parent *RemoteFilterDefinition, dotRegolithPath string, offline bool,
 ) error {
 	installLocation := ""
 	// Install dependencies
@@ -107,7 +107,13 @@ func (f *NimFilterDefinition) InstallDependencies(
 		return WrapErrorf(err, filepathAbsError, joinedPath)
 	}
 	filterPath := filepath.Dir(scriptPath)
-	if hasNimble(filterPath) {
+	if hasNimble(filterPath) && offline {
+		// Nimble installs the packages globally, so they can be already
+		// installed
+		Logger.Warnf(
+			"Skipped installing the nim dependencies of %s in offline mode.",
+			f.Id)
+	} else if hasNimble(filterPath) {
 		Logger.Info("Installing nim dependencies...")
 		err := RunSubProcess(
 			"nimble", []string{"install"}, filterPath, filterPath, ShortFilterName(f.Id))
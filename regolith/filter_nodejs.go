@@ -31,14 +31,30 @@ func NodeJSFilterDefinitionFromObject(id string, obj map[string]interface{}) (*N
 			jsonPropertyTypeError, "script", "string")
 	}
 	filter.Script = script
+	protocol, err := filterProtocolFromObject(obj)
+	if err != nil {
+		return nil, PassError(err)
+	}
+	filter.Protocol = protocol
 	return filter, nil
 }
 
 func (f *NodeJSFilter) run(context RunContext) error {
 	// Run filter
+	if f.Definition.Protocol != noFilterProtocol {
+		err := runProtocolFilter(
+			context, f.Id, f.Settings, f.Arguments, "node",
+			[]string{
+				context.AbsoluteLocation + string(os.PathSeparator) +
+					f.Definition.Script}, "")
+		if err != nil {
+			return PassError(err)
+		}
+		return nil
+	}
 	if len(f.Settings) == 0 {
-		err := RunSubProcess(
-			"node",
+		err := RunSubProcessContext(
+			context.cancelContext(), "node",
 			append([]string{
 				context.AbsoluteLocation + string(os.PathSeparator) +
 					f.Definition.Script},
@@ -53,8 +69,8 @@ func (f *NodeJSFilter) run(context RunContext) error {
 		}
 	} else {
 		jsonSettings, _ := json.Marshal(f.Settings)
-		err := RunSubProcess(
-			"node",
+		err := RunSubProcessContext(
+			context.cancelContext(), "node",
 			append([]string{
 				context.AbsoluteLocation + string(os.PathSeparator) +
 					f.Definition.Script,
@@ -89,7 +105,9 @@ func (f *NodeJSFilterDefinition) CreateFilterRunner(runConfiguration map[string]
 	return filter, nil
 }
 
-func (f *NodeJSFilterDefinition) InstallDependencies(parent *RemoteFilterDefinition, dotRegolithPath string) error {
+func (f *NodeJSFilterDefinition) InstallDependencies(
+	parent *RemoteFilterDefinition, dotRegolithPath string, offline bool,
+) error {
 	installLocation := ""
 	// Install dependencies
 	if parent != nil {
@@ -105,7 +123,18 @@ func (f *NodeJSFilterDefinition) InstallDependencies(parent *RemoteFilterDefinit
 	filterPath := filepath.Dir(scriptPath)
 	if hasPackageJson(filterPath) {
 		Logger.Info("Installing npm dependencies...")
-		err := RunSubProcess("npm", []string{"i", "--no-fund", "--no-audit"}, filterPath, filterPath, ShortFilterName(f.Id))
+		args := []string{"i", "--no-fund", "--no-audit"}
+		if offline {
+			// Use only the packages from the cache of npm
+			args = append(args, "--offline")
+		}
+		err := RunSubProcess("npm", args, filterPath, filterPath, ShortFilterName(f.Id))
+		if err != nil && offline {
+			return WrapErrorf(
+				err, "Failed to install the npm dependencies offline. Only "+
+					"the packages from the cache of npm can be installed "+
+					"offline.\nFilter name: %s", f.Id)
+		}
 		if err != nil {
 			return WrapErrorf(
 				err, "Failed to run npm and install dependencies."+
@@ -14,26 +14,40 @@ func (f *ProfileFilter) Run(context RunContext) (bool, error) {
 		Parent:              &context,
 		interruptionChannel: context.interruptionChannel,
 		DotRegolithPath:     context.DotRegolithPath,
+		Options:             context.Options,
+		ctx:                 context.ctx,
 	})
 }
 
 func (f *ProfileFilter) Check(context RunContext) error {
+	profile, err := f.checkReference(context)
+	if err != nil {
+		return PassError(err)
+	}
+	return CheckProfileImpl(
+		profile, f.Profile, *context.Config, &context,
+		context.DotRegolithPath)
+}
+
+// checkReference checks whether the nested profile exists and whether it
+// isn't already nested in the parents of the context. It returns the nested
+// profile.
+func (f *ProfileFilter) checkReference(context RunContext) (Profile, error) {
 	// Check if the profile exists
 	profile, ok := context.Config.Profiles[f.Profile]
 	if !ok {
-		return WrappedErrorf("Profile not found.\nProfile: %s", f.Profile)
+		return profile, WrappedErrorf(
+			"Profile not found.\nProfile: %s", f.Profile)
 	}
 	// Check if the profile we're nesting wasn't already nested
 	parent := context.Parent
 	for parent != nil {
 		if parent.Profile == f.Profile {
-			return WrappedErrorf(
-				"Found circular dependency in the profile."+
+			return profile, WrappedErrorf(
+				"Found circular dependency in the profile.\n"+
 					"Profile: %s", f.Profile)
 		}
 		parent = parent.Parent
 	}
-	return CheckProfileImpl(
-		profile, f.Profile, *context.Config, &context,
-		context.DotRegolithPath)
+	return profile, nil
 }
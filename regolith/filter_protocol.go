@@ -0,0 +1,263 @@
+package regolith
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Version is the version of Regolith sent to the filters that use the
+// filter protocol. It's set by the main package.
+var Version = "unversioned"
+
+// The versions of the filter protocol. The filters that use the protocol
+// receive a JSON request on the standard input instead of the settings in
+// the command line arguments, and can send structured messages to Regolith
+// on the standard output.
+const (
+	// noFilterProtocol is the default, the settings are passed as a JSON
+	// string in the first command line argument
+	noFilterProtocol = 0
+
+	// filterProtocolV1 is the first version of the filter protocol
+	filterProtocolV1 = 1
+)
+
+// The types of the messages that the filters using the filter protocol can
+// send to Regolith.
+const (
+	filterMessageDebug   = "debug"
+	filterMessageLog     = "log"
+	filterMessageWarning = "warning"
+	filterMessageError   = "error"
+)
+
+// filterProtocolRequest is the JSON object written to the standard input of
+// the filters that use the filter protocol.
+type filterProtocolRequest struct {
+	// Protocol is the version of the filter protocol
+	Protocol int `json:"protocol"`
+
+	// RegolithVersion is the version of Regolith that runs the filter
+	RegolithVersion string `json:"regolithVersion"`
+
+	// Filter is the ID of the filter
+	Filter string `json:"filter"`
+
+	// Profile is the name of the profile that runs the filter
+	Profile string `json:"profile"`
+
+	// Settings are the settings of the filter from the config file
+	Settings map[string]interface{} `json:"settings"`
+
+	// Arguments are the arguments of the filter from the config file
+	Arguments []string `json:"arguments"`
+
+	// Paths are the absolute paths used by the filter
+	Paths filterProtocolPaths `json:"paths"`
+}
+
+// filterProtocolPaths are the absolute paths sent to the filters in the
+// requests of the filter protocol.
+type filterProtocolPaths struct {
+	// Root is the path to the project
+	Root string `json:"root"`
+
+	// Filter is the path to the directory of the filter
+	Filter string `json:"filter"`
+
+	// Tmp is the path to the tmp directory, which is the working directory
+	// of the filter
+	Tmp string `json:"tmp"`
+
+	// BehaviorPack is the path to the behavior pack in the tmp directory
+	BehaviorPack string `json:"behaviorPack"`
+
+	// ResourcePack is the path to the resource pack in the tmp directory
+	ResourcePack string `json:"resourcePack"`
+
+	// Data is the path to the data directory in the tmp directory
+	Data string `json:"data"`
+}
+
+// filterProtocolMessage is a message sent by a filter that uses the filter
+// protocol. Every message is a JSON object in a single line of the standard
+// output of the filter.
+type filterProtocolMessage struct {
+	// Type is "debug", "log", "warning" or "error"
+	Type string `json:"type"`
+
+	// Message is the text of the message
+	Message string `json:"message"`
+}
+
+// filterProtocolFromObject returns the version of the filter protocol from
+// the "protocol" property of a filter definition.
+func filterProtocolFromObject(obj map[string]interface{}) (int, error) {
+	protocolObj, ok := obj["protocol"]
+	if !ok {
+		return noFilterProtocol, nil
+	}
+	protocol, ok := protocolObj.(float64)
+	if !ok {
+		return 0, WrappedErrorf(jsonPropertyTypeError, "protocol", "integer")
+	}
+	if protocol != filterProtocolV1 {
+		return 0, WrapErrorf(
+			WrappedErrorf(
+				"Unsupported version of the filter protocol.\n"+
+					"Version: %v\nSupported versions: %d",
+				protocol, filterProtocolV1),
+			jsonPropertyParseError, "protocol")
+	}
+	return int(protocol), nil
+}
+
+// newFilterProtocolRequest creates the request of the filter protocol for
+// a filter run in the given context.
+func newFilterProtocolRequest(
+	context RunContext, id string, settings map[string]interface{},
+	arguments []string,
+) (filterProtocolRequest, error) {
+	root, err := os.Getwd()
+	if err != nil {
+		return filterProtocolRequest{}, WrapErrorf(err, osGetwdError)
+	}
+	tmp := GetAbsoluteWorkingDirectory(context.DotRegolithPath)
+	if settings == nil {
+		settings = map[string]interface{}{}
+	}
+	if arguments == nil {
+		arguments = []string{}
+	}
+	return filterProtocolRequest{
+		Protocol:        filterProtocolV1,
+		RegolithVersion: Version,
+		Filter:          id,
+		Profile:         context.Profile,
+		Settings:        settings,
+		Arguments:       arguments,
+		Paths: filterProtocolPaths{
+			Root:         root,
+			Filter:       context.AbsoluteLocation,
+			Tmp:          tmp,
+			BehaviorPack: filepath.Join(tmp, "BP"),
+			ResourcePack: filepath.Join(tmp, "RP"),
+			Data:         filepath.Join(tmp, "data"),
+		},
+	}, nil
+}
+
+// runProtocolFilter runs the process of a filter that uses the filter
+// protocol. The request with the settings and the arguments is written to
+// the standard input of the process instead of passing them as command line
+// arguments. The filter fails if it reports any errors, even if its exit
+// code is 0.
+func runProtocolFilter(
+	context RunContext, id string, settings map[string]interface{},
+	arguments []string, command string, args []string, commandLine string,
+) error {
+	request, err := newFilterProtocolRequest(context, id, settings, arguments)
+	if err != nil {
+		return WrapError(err, "Failed to create the request for the filter.")
+	}
+	requestJson, _ := json.Marshal(request) // no error
+	output := &filterProtocolOutput{label: ShortFilterName(id)}
+	err = runSubProcess(
+		context.cancelContext(), command, args, context.AbsoluteLocation,
+		GetAbsoluteWorkingDirectory(context.DotRegolithPath),
+		ShortFilterName(id), requestJson, nil, commandLine, output.log)
+	if err != nil {
+		return PassError(err)
+	}
+	if output.errors > 0 {
+		return WrappedErrorf(
+			"The filter reported errors.\nNumber of errors: %d", output.errors)
+	}
+	return nil
+}
+
+// filterProtocolOutput logs the standard output of a filter that uses the
+// filter protocol.
+type filterProtocolOutput struct {
+	// label is the name of the filter used in the logs
+	label string
+
+	// errors is the number of the error messages sent by the filter
+	errors int
+}
+
+// log logs the messages of the filter. The lines that aren't messages of
+// the filter protocol are logged like the standard output of the other
+// filters.
+func (o *filterProtocolOutput) log(in io.ReadCloser) {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := scanner.Text()
+		message, ok := parseFilterProtocolMessage(line)
+		if !ok {
+			logStdLine(line, "stdout", o.label)
+			continue
+		}
+		if message.Type == filterMessageError {
+			o.errors++
+		}
+		logFilterMessage(message, o.label)
+	}
+}
+
+// parseFilterProtocolMessage parses a line of the standard output of a
+// filter as a message of the filter protocol. It returns false if the line
+// isn't a message.
+func parseFilterProtocolMessage(line string) (filterProtocolMessage, bool) {
+	message := filterProtocolMessage{}
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "{") {
+		return message, false
+	}
+	if err := json.Unmarshal([]byte(line), &message); err != nil {
+		return message, false
+	}
+	switch message.Type {
+	case filterMessageDebug, filterMessageLog, filterMessageWarning,
+		filterMessageError:
+		return message, true
+	}
+	return message, false
+}
+
+// logFilterMessage logs a message of the filter protocol with the log level
+// matching its type.
+func logFilterMessage(message filterProtocolMessage, outputLabel string) {
+	text := fmt.Sprintf("[%s] %s", outputLabel, message.Message)
+	if IsJsonOutput() {
+		fields := []interface{}{
+			"event", filterMessageEvent, "filter", outputLabel,
+			"type", message.Type, "message", message.Message}
+		switch message.Type {
+		case filterMessageDebug:
+			Logger.Debugw(text, fields...)
+		case filterMessageWarning:
+			Logger.Warnw(text, fields...)
+		case filterMessageError:
+			Logger.Errorw(text, fields...)
+		default:
+			Logger.Infow(text, fields...)
+		}
+		return
+	}
+	switch message.Type {
+	case filterMessageDebug:
+		Logger.Debug(text)
+	case filterMessageWarning:
+		Logger.Warn(text)
+	case filterMessageError:
+		Logger.Error(text)
+	default:
+		Logger.Info(text)
+	}
+}
@@ -32,6 +32,11 @@ func PythonFilterDefinitionFromObject(id string, obj map[string]interface{}) (*P
 	}
 	filter.Script = script
 	filter.VenvSlot, _ = obj["venvSlot"].(int) // default venvSlot is 0
+	protocol, err := filterProtocolFromObject(obj)
+	if err != nil {
+		return nil, PassError(err)
+	}
+	filter.Protocol = protocol
 	return filter, nil
 }
 
@@ -51,6 +56,15 @@ func (f *PythonFilter) run(context RunContext) error {
 		pythonCommand = filepath.Join(
 			venvPath, venvScriptsPath, "python"+exeSuffix)
 	}
+	if f.Definition.Protocol != noFilterProtocol {
+		err = runProtocolFilter(
+			context, f.Id, f.Settings, f.Arguments, pythonCommand,
+			[]string{"-u", scriptPath}, "")
+		if err != nil {
+			return WrapError(err, "Failed to run Python script.")
+		}
+		return nil
+	}
 	var args []string
 	if len(f.Settings) == 0 {
 		args = append([]string{"-u", scriptPath}, f.Arguments...)
@@ -61,8 +75,8 @@ func (f *PythonFilter) run(context RunContext) error {
 			f.Arguments...,
 		)
 	}
-	err = RunSubProcess(
-		pythonCommand, args, context.AbsoluteLocation,
+	err = RunSubProcessContext(
+		context.cancelContext(), pythonCommand, args, context.AbsoluteLocation,
 		GetAbsoluteWorkingDirectory(context.DotRegolithPath),
 		ShortFilterName(f.Id))
 	if err != nil {
@@ -91,7 +105,7 @@ func (f *PythonFilterDefinition) CreateFilterRunner(runConfiguration map[string]
 }
 
 func (f *PythonFilterDefinition) InstallDependencies(
-	parent *RemoteFilterDefinition, dotRegolithPath string,
+	parent *RemoteFilterDefinition, dotRegolithPath string, offline bool,
 ) error {
 	installLocation := ""
 	// Install dependencies
@@ -124,19 +138,33 @@ func (f *PythonFilterDefinition) InstallDependencies(
 			return WrapError(err, "Failed to create venv.")
 		}
 		// Update pip of the venv
-		venvPythonCommand := filepath.Join(
-			venvPath, venvScriptsPath, "python"+exeSuffix)
-		err = RunSubProcess(
-			venvPythonCommand,
-			[]string{"-m", "pip", "install", "--upgrade", "pip"},
-			filterPath, "", ShortFilterName(f.Id))
-		if err != nil {
-			Logger.Warn("Failed to upgrade pip in venv.")
+		if !offline {
+			venvPythonCommand := filepath.Join(
+				venvPath, venvScriptsPath, "python"+exeSuffix)
+			err = RunSubProcess(
+				venvPythonCommand,
+				[]string{"-m", "pip", "install", "--upgrade", "pip"},
+				filterPath, "", ShortFilterName(f.Id))
+			if err != nil {
+				Logger.Warn("Failed to upgrade pip in venv.")
+			}
 		}
 		Logger.Info("Installing pip dependencies...")
+		args := []string{"install", "-r", "requirements.txt"}
+		if offline {
+			// Only check the packages already installed in the venv
+			args = append(args, "--no-index")
+		}
 		err = RunSubProcess(
 			filepath.Join(venvPath, venvScriptsPath, "pip"+exeSuffix),
-			[]string{"install", "-r", "requirements.txt"}, filterPath, filterPath, ShortFilterName(f.Id))
+			args, filterPath, filterPath, ShortFilterName(f.Id))
+		if err != nil && offline {
+			return WrapErrorf(
+				err, "Failed to install the pip dependencies offline. Only "+
+					"the packages already installed in the venv of the "+
+					"filter can be used offline.\nFilter name: %s\n"+
+					"Venv: %s", f.Id, venvPath)
+		}
 		if err != nil {
 			return WrapErrorf(
 				err, "Couldn't run Pip to install dependencies of %s",
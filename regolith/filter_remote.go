@@ -9,7 +9,6 @@ import (
 	"path"
 	"path/filepath"
 
-	"github.com/hashicorp/go-getter"
 	"github.com/otiai10/copy"
 )
 
@@ -69,7 +68,7 @@ func (f *RemoteFilter) run(context RunContext) error {
 				"You can try to force reinstallation fo the filter using command:"+
 				"regolith install --force %s", f.Id, f.Id)
 	}
-	if f.Definition.Version != "HEAD" && f.Definition.Version != "latest" && f.Definition.Version != *version {
+	if !f.Definition.acceptsInstalledVersion(*version) {
 		return WrappedErrorf(
 			"Filter version saved in cache doesn't match the version declared"+
 				" in the config file.\n"+
@@ -83,13 +82,18 @@ func (f *RemoteFilter) run(context RunContext) error {
 
 	path := f.GetDownloadPath(context.DotRegolithPath)
 	absolutePath, _ := filepath.Abs(path)
+	remoteFilters, err := context.enterRemoteFilter(f.Id)
+	if err != nil {
+		return PassError(err)
+	}
 	filterCollection, err := f.subfilterCollection(context.DotRegolithPath)
 	if err != nil {
 		return WrapErrorf(err, remoteFilterSubfilterCollectionError)
 	}
 	for i, filter := range filterCollection.Filters {
-		// Disabled filters are skipped
-		if filter.IsDisabled() {
+		// Disabled filters are skipped. The "when" expressions use the
+		// context of the remote filter.
+		if filter.IsDisabled(context) {
 			Logger.Infof(
 				"The %s subfilter of \"%s\" filter is disabled, skipping.",
 				nth(i), f.Id)
@@ -98,13 +102,16 @@ func (f *RemoteFilter) run(context RunContext) error {
 		// Overwrite the venvSlot with the parent value
 		// TODO - remote filters can contain multiple filters, the interruption
 		// chceck should be performed after every subfilter
-		_, err := filter.Run(RunContext{
+		_, err := runFilter(RunContext{
 			Config:           context.Config,
 			AbsoluteLocation: absolutePath,
 			Profile:          context.Profile,
 			Parent:           context.Parent,
 			DotRegolithPath:  context.DotRegolithPath,
-		})
+			Options:          context.Options,
+			ctx:              context.ctx,
+			remoteFilters:    remoteFilters,
+		}, filter)
 		if err != nil {
 			return WrapErrorf(
 				err, filterRunnerRunError,
@@ -133,39 +140,22 @@ func (f *RemoteFilterDefinition) CreateFilterRunner(runConfiguration map[string]
 	return filter, nil
 }
 
-// TODO - this code is almost a duplicate of the code in the
-// (f *RemoteFilter) SubfilterCollection()
-func (f *RemoteFilterDefinition) InstallDependencies(_ *RemoteFilterDefinition, dotRegolithPath string) error {
+// InstallDependencies installs the dependencies of the subfilters of the
+// remote filter. The remote filters used by the filter are skipped, because
+// they're installed separately, with their own dependencies, when the
+// filter is installed.
+func (f *RemoteFilterDefinition) InstallDependencies(
+	_ *RemoteFilterDefinition, dotRegolithPath string, offline bool,
+) error {
 	path := filepath.Join(f.GetDownloadPath(dotRegolithPath), "filter.json")
-	file, err := ioutil.ReadFile(path)
-
+	filters, err := f.loadSubfilterObjects(dotRegolithPath)
 	if err != nil {
-		return WrapErrorf(err, fileReadError, path)
-	}
-
-	var filterCollection map[string]interface{}
-	err = json.Unmarshal(file, &filterCollection)
-	if err != nil {
-		return WrapErrorf(err, jsonUnmarshalError, path)
-	}
-
-	// Filters
-	filtersObj, ok := filterCollection["filters"]
-	if !ok {
-		return extraFilterJsonErrorInfo(
-			path, WrappedErrorf(jsonPathMissingError, "filters"))
-	}
-	filters, ok := filtersObj.([]interface{})
-	if !ok {
-		return extraFilterJsonErrorInfo(
-			path, WrappedErrorf(jsonPathTypeError, "filters", "array"))
+		return PassError(err)
 	}
 	for i, filter := range filters {
-		filter, ok := filter.(map[string]interface{})
 		jsonPath := fmt.Sprintf("filters->%d", i) // Used for error messages
-		if !ok {
-			return extraFilterJsonErrorInfo(
-				path, WrappedErrorf(jsonPathTypeError, jsonPath, "object"))
+		if isNestedRemoteFilterObject(filter) {
+			continue
 		}
 		filterInstaller, err := FilterInstallerFromObject(
 			fmt.Sprintf("%v:subfilter%v", f.Id, i), filter)
@@ -173,7 +163,7 @@ func (f *RemoteFilterDefinition) InstallDependencies(_ *RemoteFilterDefinition,
 			return extraFilterJsonErrorInfo(
 				path, WrapErrorf(err, jsonPathParseError, jsonPath))
 		}
-		err = filterInstaller.InstallDependencies(f, dotRegolithPath)
+		err = filterInstaller.InstallDependencies(f, dotRegolithPath, offline)
 		if err != nil {
 			// This is not parsing error so extraErrorInfo is not necessary
 			return WrapErrorf(
@@ -188,6 +178,9 @@ func (f *RemoteFilterDefinition) InstallDependencies(_ *RemoteFilterDefinition,
 }
 
 func (f *RemoteFilterDefinition) Check(context RunContext) error {
+	if err := f.checkLock(context.DotRegolithPath); err != nil {
+		return PassError(err)
+	}
 	dummyFilterRunner, err := f.CreateFilterRunner(
 		map[string]interface{}{"filter": f.Id})
 	const shouldntHappenError = ("Filter name: %s\n" +
@@ -204,14 +197,20 @@ func (f *RemoteFilterDefinition) Check(context RunContext) error {
 		return WrappedErrorf(
 			"Failed to convert to RemoteFilter.\n"+shouldntHappenError, f.Id)
 	}
+	remoteFilters, err := context.enterRemoteFilter(f.Id)
+	if err != nil {
+		return PassError(err)
+	}
 	filterCollection, err := dummyFilterRunnerConverted.subfilterCollection(
 		context.DotRegolithPath)
 	if err != nil {
 		return WrapError(err, remoteFilterSubfilterCollectionError)
 	}
+	subfilterContext := context
+	subfilterContext.remoteFilters = remoteFilters
 	for i, filter := range filterCollection.Filters {
 		// Overwrite the venvSlot with the parent value
-		err := filter.Check(context)
+		err := filter.Check(subfilterContext)
 		if err != nil {
 			return WrapErrorf(
 				err, filterRunnerCheckError, NiceSubfilterName(f.Id, i))
@@ -323,10 +322,19 @@ func FilterDefinitionFromTheInternet(
 	}, nil
 }
 
-// Download
+// Download downloads the filter. If the locked filter is not nil, the filter
+// is downloaded from the commit saved in the lock file and the hash of its
+// files must match the hash from the lock file. Otherwise, the version of the
+// filter is resolved again. The function returns the entry of the lock file
+// for the downloaded filter or nil if the download was skipped.
+//
+// The filters are downloaded through the filter store shared by all of the
+// projects. In offline mode, the filter must be in the lock file and in the
+// filter store, because the version can't be resolved and the files can't
+// be downloaded.
 func (i *RemoteFilterDefinition) Download(
-	isForced bool, dotRegolithPath string,
-) error {
+	isForced, offline bool, dotRegolithPath string, locked *LockedFilter,
+) (*LockedFilter, error) {
 	if _, err := os.Stat(i.GetDownloadPath(dotRegolithPath)); err == nil {
 		if !isForced {
 			Logger.Warnf(
@@ -334,7 +342,7 @@ func (i *RemoteFilterDefinition) Download(
 					"be the case only if the filter is installed.\n"+
 					"    Skipped the download. You can force the it by "+
 					"passing the \"-force\" flag.", i.Id)
-			return nil
+			return nil, nil
 		} else {
 			i.Uninstall(dotRegolithPath)
 		}
@@ -342,28 +350,44 @@ func (i *RemoteFilterDefinition) Download(
 
 	Logger.Infof("Downloading filter %s...", i.Id)
 
-	// Download the filter using Git Getter
-	if !hasGit() {
-		return WrappedError(gitNotInstalledWarning)
-	}
-	repoVersion, err := GetRemoteFilterDownloadRef(i.Url, i.Id, i.Version)
-	if err != nil {
-		return WrapErrorf(
-			err, getRemoteFilterDownloadRefError, i.Url, i.Id, i.Version)
+	var repoVersion, sha string
+	var err error
+	if locked != nil {
+		Logger.Debugf(
+			"Using the version of filter %q from %s: %s (%s).",
+			i.Id, LockfilePath, locked.Ref, locked.Sha)
+		repoVersion, sha = locked.Ref, locked.Sha
+	} else if offline {
+		return nil, WrappedErrorf(
+			"The filter is not in %s, so its version can't be resolved in "+
+				"offline mode.\nFilter: %s\n"+
+				"You can install the filter without the \"--offline\" flag "+
+				"to add it to the lock file.", LockfilePath, i.Id)
+	} else {
+		repoVersion, err = GetRemoteFilterDownloadRef(i.Url, i.Id, i.Version)
+		if err != nil {
+			return nil, WrapErrorf(
+				err, getRemoteFilterDownloadRefError, i.Url, i.Id, i.Version)
+		}
+		sha, err = GetRemoteFilterRefSha(i.Url, repoVersion)
+		if err != nil {
+			return nil, WrapErrorf(
+				err, "Failed to get the commit SHA of the filter.\n"+
+					"Filter: %s\nRef: %s", i.Id, repoVersion)
+		}
 	}
-	url := fmt.Sprintf("%s//%s?ref=%s", i.Url, i.Id, repoVersion)
 	downloadPath := i.GetDownloadPath(dotRegolithPath)
 
 	_, err = os.Stat(downloadPath)
 	downloadPathIsNew := os.IsNotExist(err)
-	err = getter.Get(downloadPath, url)
+	err = downloadStoredFilter(i.Url, i.Id, sha, downloadPath, offline)
 	if err != nil {
-		if downloadPathIsNew { // Remove the path created by getter
-			os.Remove(downloadPath)
+		if downloadPathIsNew { // Remove the path created by the download
+			os.RemoveAll(downloadPath)
 		}
-		return WrapErrorf(
+		return nil, WrapErrorf(
 			err, "Could not download filter from %s.\n"+
-				"Does that filter exist?", url)
+				"Does that filter exist?", i.Url)
 	}
 	// Save the version of the filter we downloaded
 	i.SaveVerssionInfo(trimFilterPrefix(repoVersion, i.Id), dotRegolithPath)
@@ -372,9 +396,32 @@ func (i *RemoteFilterDefinition) Download(
 	if _, err := os.Stat(testFolder); err == nil {
 		os.RemoveAll(testFolder)
 	}
+	hash, err := hashFilterFiles(downloadPath)
+	if err != nil {
+		return nil, PassError(err)
+	}
+	if locked != nil && hash != locked.Hash {
+		i.Uninstall(dotRegolithPath)
+		return nil, WrappedErrorf(
+			"The files of the downloaded filter don't match the hash from "+
+				"%s.\n"+
+				"Filter: %s\n"+
+				"Commit: %s\n"+
+				"Expected hash: %s\n"+
+				"Actual hash: %s\n"+
+				"If you trust the new files, you can update the lock file "+
+				"using command:\nregolith update %s",
+			LockfilePath, i.Id, sha, locked.Hash, hash, i.Id)
+	}
 
 	Logger.Infof("Filter \"%s\" downloaded successfully.", i.Id)
-	return nil
+	return &LockedFilter{
+		Url:     i.Url,
+		Version: i.Version,
+		Ref:     repoVersion,
+		Sha:     sha,
+		Hash:    hash,
+	}, nil
 }
 
 // SaveVersionInfo saves puts the specified version string into the
@@ -426,7 +473,12 @@ func (f *RemoteFilterDefinition) InstalledVersion(dotRegolithPath string) (strin
 	return versionStr, nil
 }
 
-func (f *RemoteFilterDefinition) Update(dotRegolithPath string) error {
+// Update updates the filter to the newest version that matches the version
+// from the config file. It returns the entry of the lock file for the
+// downloaded filter or nil if the filter is already up to date.
+func (f *RemoteFilterDefinition) Update(
+	dotRegolithPath string,
+) (*LockedFilter, error) {
 	installedVersion, err := f.InstalledVersion(dotRegolithPath)
 	installedVersion = trimFilterPrefix(installedVersion, f.Id)
 	if err != nil {
@@ -434,7 +486,7 @@ func (f *RemoteFilterDefinition) Update(dotRegolithPath string) error {
 	}
 	version, err := GetRemoteFilterDownloadRef(f.Url, f.Id, f.Version)
 	if err != nil {
-		return WrapErrorf(
+		return nil, WrapErrorf(
 			err, getRemoteFilterDownloadRefError, f.Url, f.Id, f.Version)
 	}
 	version = trimFilterPrefix(version, f.Id)
@@ -442,21 +494,21 @@ func (f *RemoteFilterDefinition) Update(dotRegolithPath string) error {
 		Logger.Infof(
 			"Updating filter %q to new version: %q->%q.",
 			f.Id, installedVersion, version)
-		err = f.Download(true, dotRegolithPath)
+		locked, err := f.Download(true, false, dotRegolithPath, nil)
 		if err != nil {
-			return PassError(err)
+			return nil, PassError(err)
 		}
-		err = f.InstallDependencies(f, dotRegolithPath)
+		err = f.InstallDependencies(f, dotRegolithPath, false)
 		if err != nil {
-			return PassError(err)
+			return nil, PassError(err)
 		}
 		Logger.Infof("Filter %q updated successfully.", f.Id)
-	} else {
-		Logger.Infof(
-			"Filter %q is up to date. Installed version: %q.",
-			f.Id, installedVersion)
+		return locked, nil
 	}
-	return nil
+	Logger.Infof(
+		"Filter %q is up to date. Installed version: %q.",
+		f.Id, installedVersion)
+	return nil, nil
 }
 
 // GetDownloadPath returns the path location where the filter can be found.
@@ -0,0 +1,396 @@
+package regolith
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// The remote filters can use other remote filters as their subfilters. The
+// subfilter that references a remote filter doesn't have the "runWith"
+// property. Its "filter" property is the name of the referenced filter and
+// the "url" and "version" properties work like in the filter definitions of
+// the config file. The referenced filters are installed next to the other
+// remote filters of the project, so every filter can be installed only in
+// one version.
+
+// isNestedRemoteFilterObject returns true if the subfilter from filter.json
+// of a remote filter references another remote filter.
+func isNestedRemoteFilterObject(obj map[string]interface{}) bool {
+	runWith, _ := obj["runWith"].(string)
+	return runWith == ""
+}
+
+// nestedRemoteFilterFromObject creates the definition of the remote filter
+// referenced by a subfilter from filter.json of another remote filter.
+func nestedRemoteFilterFromObject(
+	obj map[string]interface{},
+) (*RemoteFilterDefinition, error) {
+	nameObj, ok := obj["filter"]
+	if !ok {
+		return nil, WrappedErrorf(jsonPropertyMissingError, "filter")
+	}
+	name, ok := nameObj.(string)
+	if !ok {
+		return nil, WrappedErrorf(jsonPropertyTypeError, "filter", "string")
+	}
+	filter, err := RemoteFilterDefinitionFromObject(name, obj)
+	if err != nil {
+		return nil, WrapErrorf(
+			err, "Unable to create remote filter from %q filter definition.",
+			name)
+	}
+	return filter, nil
+}
+
+// loadSubfilterObjects loads the list of the subfilters from the filter.json
+// file of the remote filter.
+func (f *RemoteFilterDefinition) loadSubfilterObjects(
+	dotRegolithPath string,
+) ([]map[string]interface{}, error) {
+	path := filepath.Join(f.GetDownloadPath(dotRegolithPath), "filter.json")
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, WrapErrorf(err, fileReadError, path)
+	}
+	var filterCollection map[string]interface{}
+	err = json.Unmarshal(file, &filterCollection)
+	if err != nil {
+		return nil, WrapErrorf(err, jsonUnmarshalError, path)
+	}
+	filtersObj, ok := filterCollection["filters"]
+	if !ok {
+		return nil, extraFilterJsonErrorInfo(
+			path, WrappedErrorf(jsonPathMissingError, "filters"))
+	}
+	filters, ok := filtersObj.([]interface{})
+	if !ok {
+		return nil, extraFilterJsonErrorInfo(
+			path, WrappedErrorf(jsonPathTypeError, "filters", "array"))
+	}
+	result := make([]map[string]interface{}, len(filters))
+	for i, filter := range filters {
+		filter, ok := filter.(map[string]interface{})
+		if !ok {
+			return nil, extraFilterJsonErrorInfo(
+				path, WrappedErrorf(
+					jsonPathTypeError, fmt.Sprintf("filters->%d", i), "object"))
+		}
+		result[i] = filter
+	}
+	return result, nil
+}
+
+// nestedRemoteFilters returns the remote filters referenced by the
+// subfilters of the installed remote filter.
+func (f *RemoteFilterDefinition) nestedRemoteFilters(
+	dotRegolithPath string,
+) ([]*RemoteFilterDefinition, error) {
+	filters, err := f.loadSubfilterObjects(dotRegolithPath)
+	if err != nil {
+		return nil, PassError(err)
+	}
+	result := []*RemoteFilterDefinition{}
+	for i, filter := range filters {
+		if !isNestedRemoteFilterObject(filter) {
+			continue
+		}
+		nestedFilter, err := nestedRemoteFilterFromObject(filter)
+		if err != nil {
+			path := filepath.Join(
+				f.GetDownloadPath(dotRegolithPath), "filter.json")
+			return nil, extraFilterJsonErrorInfo(
+				path, WrapErrorf(
+					err, jsonPathParseError, fmt.Sprintf("filters->%d", i)))
+		}
+		result = append(result, nestedFilter)
+	}
+	return result, nil
+}
+
+// acceptsInstalledVersion returns true if the installed version of the
+// filter matches the version from its definition. Any installed version
+// that satisfies a semver range is accepted.
+func (f *RemoteFilterDefinition) acceptsInstalledVersion(version string) bool {
+	return versionAccepts(f.Version, version)
+}
+
+// versionAccepts returns true if the installed version of a remote filter
+// matches the required version.
+func versionAccepts(required, version string) bool {
+	if isVersionRange(required) {
+		return versionRangeMatches(required, version)
+	}
+	return required == "HEAD" || required == "latest" || required == version
+}
+
+// remoteFilterChain formats the list of the names of the remote filters,
+// in which every filter uses the next one, for the error messages.
+func remoteFilterChain(chain []string) string {
+	return strings.Join(chain, " -> ")
+}
+
+// remoteFilterRequirement is a remote filter required by the project or by
+// another remote filter.
+type remoteFilterRequirement struct {
+	// url is the URL of the repository of the filter
+	url string
+
+	// version is the required version of the filter
+	version string
+
+	// chain is the list of the names of the filters that lead to the
+	// filter. It starts with the filter from the config file and ends with
+	// the filter itself.
+	chain []string
+}
+
+// remoteFilterResolver installs or updates the remote filters used by other
+// remote filters. It detects the cycles of the filters and the conflicts
+// between the filters that require different versions of the same filter.
+type remoteFilterResolver struct {
+	// update is true if the filters should be updated instead of installed
+	update bool
+
+	// force forces reinstalling the filters that are already installed
+	force bool
+
+	// offline installs the filters only from the lock file and the filter
+	// store
+	offline bool
+
+	dataPath        string
+	dotRegolithPath string
+	lockfile        *Lockfile
+
+	// roots are the filters from the config file that are being installed
+	// or updated
+	roots map[string]FilterInstaller
+
+	// required are the remote filters required by the project, by their
+	// names
+	required map[string]remoteFilterRequirement
+}
+
+// newRemoteFilterResolver creates a resolver for installing or updating the
+// filters from the roots list. The filters from the lock file that aren't
+// installed by the roots are treated as required, so the installed filters
+// can't conflict with them.
+func newRemoteFilterResolver(
+	roots map[string]FilterInstaller, dotRegolithPath string,
+	lockfile *Lockfile,
+) *remoteFilterResolver {
+	r := &remoteFilterResolver{
+		dotRegolithPath: dotRegolithPath,
+		lockfile:        lockfile,
+		roots:           roots,
+		required:        map[string]remoteFilterRequirement{},
+	}
+	for name, locked := range lockfile.Filters {
+		chain := append(append([]string{}, locked.RequiredBy...), name)
+		if _, ok := roots[chain[0]]; ok {
+			continue // Resolved again
+		}
+		r.required[name] = remoteFilterRequirement{
+			url: locked.Url, version: locked.Version, chain: chain}
+	}
+	for name, filter := range roots {
+		if remoteFilter, ok := filter.(*RemoteFilterDefinition); ok {
+			r.required[name] = remoteFilterRequirement{
+				url:     remoteFilter.Url,
+				version: remoteFilter.Version,
+				chain:   []string{name},
+			}
+		}
+	}
+	return r
+}
+
+// resolveNested installs or updates the remote filters used by the remote
+// filter, and the filters used by them. The chain is the list of the names
+// of the filters that lead to the parent filter, including the parent.
+func (r *remoteFilterResolver) resolveNested(
+	parent *RemoteFilterDefinition, chain []string,
+) error {
+	nestedFilters, err := parent.nestedRemoteFilters(r.dotRegolithPath)
+	if err != nil {
+		return WrapErrorf(
+			err, "Failed to find the remote filters used by the filter.\n"+
+				"Filter chain: %s", remoteFilterChain(chain))
+	}
+	for _, filter := range nestedFilters {
+		filterChain := append(append([]string{}, chain...), filter.Id)
+		for _, name := range chain {
+			if name == filter.Id {
+				return WrappedErrorf(
+					"Detected a cycle of remote filters that use each "+
+						"other.\nFilter chain: %s",
+					remoteFilterChain(filterChain))
+			}
+		}
+		if required, ok := r.required[filter.Id]; ok {
+			compatible := required.url == filter.Url
+			if compatible && required.version != filter.Version {
+				compatible, err = r.reconcile(filter, required)
+				if err != nil {
+					return WrapErrorf(
+						err, "Failed to find a version of the filter required "+
+							"by multiple filters.\nFilter: %s", filter.Id)
+				}
+			}
+			if !compatible {
+				return WrappedErrorf(
+					"Two filters require different versions of the same "+
+						"remote filter.\n"+
+						"Filter: %s\n"+
+						"First filter chain: %s\n"+
+						"First URL: %s\n"+
+						"First version: %s\n"+
+						"Second filter chain: %s\n"+
+						"Second URL: %s\n"+
+						"Second version: %s",
+					filter.Id,
+					remoteFilterChain(required.chain), required.url,
+					required.version,
+					remoteFilterChain(filterChain), filter.Url,
+					filter.Version)
+			}
+			continue // Already installed
+		}
+		r.required[filter.Id] = remoteFilterRequirement{
+			url: filter.Url, version: filter.Version, chain: filterChain}
+		err := r.resolve(filter, filterChain)
+		if err != nil {
+			return WrapErrorf(
+				err, "Failed to install the remote filter used by another "+
+					"remote filter.\nFilter chain: %s",
+				remoteFilterChain(filterChain))
+		}
+	}
+	return nil
+}
+
+// reconcile checks if a single version of the filter satisfies both the
+// requirement registered earlier and the version required by the filter
+// definition. If the installed version satisfies both, nothing changes.
+// Otherwise, if both of the versions are semver constraints, the filter is
+// installed again in the highest version that satisfies both of them. It
+// returns false if there is no such version.
+func (r *remoteFilterResolver) reconcile(
+	filter *RemoteFilterDefinition, required remoteFilterRequirement,
+) (bool, error) {
+	installedVersion, err := filter.InstalledVersion(r.dotRegolithPath)
+	installedVersion = trimFilterPrefix(installedVersion, filter.Id)
+	if err == nil && versionAccepts(required.version, installedVersion) &&
+		versionAccepts(filter.Version, installedVersion) {
+		return true, nil
+	}
+	if r.offline || !isSemverConstraint(required.version) ||
+		!isSemverConstraint(filter.Version) {
+		return false, nil
+	}
+	tags, err := ListRemoteFilterTags(filter.Url, filter.Id)
+	if err != nil {
+		return false, PassError(err)
+	}
+	combined := intersectVersionRanges(required.version, filter.Version)
+	if _, ok := highestMatchingTag(tags, filter.Id, combined); !ok {
+		return false, nil
+	}
+	Logger.Infof(
+		"Installing filter %q in a version that satisfies multiple filters: "+
+			"%q.", filter.Id, combined)
+	required.version = combined
+	r.required[filter.Id] = required
+	combinedFilter := *filter
+	combinedFilter.Version = combined
+	err = r.resolve(&combinedFilter, required.chain)
+	if err != nil {
+		return false, PassError(err)
+	}
+	return true, nil
+}
+
+// rootFilter returns the definition of the remote filter from the config
+// file that should be installed. If the filter is also used by other remote
+// filters, its version can be narrowed down to the versions that satisfy
+// all of them.
+func (r *remoteFilterResolver) rootFilter(
+	name string, filter *RemoteFilterDefinition,
+) *RemoteFilterDefinition {
+	required, ok := r.required[name]
+	if !ok || required.version == filter.Version {
+		return filter
+	}
+	result := *filter
+	result.Version = required.version
+	return &result
+}
+
+// resolve installs or updates a remote filter used by another remote filter
+// and the filters used by it.
+func (r *remoteFilterResolver) resolve(
+	filter *RemoteFilterDefinition, chain []string,
+) error {
+	var locked *LockedFilter
+	var err error
+	if r.update {
+		locked, err = filter.Update(r.dotRegolithPath)
+		if err != nil {
+			return PassError(err)
+		}
+	} else {
+		force := r.force
+		installedVersion, err := filter.InstalledVersion(r.dotRegolithPath)
+		if err == nil && !filter.acceptsInstalledVersion(
+			trimFilterPrefix(installedVersion, filter.Id)) {
+			force = true // Installed in a different version
+		}
+		lockedFilter, _ := r.lockfile.lockedFilter(filter)
+		locked, err = filter.Download(
+			force, r.offline, r.dotRegolithPath, lockedFilter)
+		if err != nil {
+			return PassError(err)
+		}
+		filter.CopyFilterData(r.dataPath, r.dotRegolithPath)
+	}
+	requiredBy := append([]string{}, chain[:len(chain)-1]...)
+	if locked != nil {
+		locked.RequiredBy = requiredBy
+		r.lockfile.Filters[filter.Id] = *locked
+	} else if locked, ok := r.lockfile.Filters[filter.Id]; ok {
+		locked.RequiredBy = requiredBy
+		r.lockfile.Filters[filter.Id] = locked
+	}
+	err = r.resolveNested(filter, chain)
+	if err != nil {
+		return PassError(err)
+	}
+	if !r.update { // Update installs the dependencies itself
+		err = filter.InstallDependencies(nil, r.dotRegolithPath, r.offline)
+		if err != nil {
+			return WrapErrorf(
+				err, "Failed to install dependencies of the filter.\n"+
+					"Filter: %s", filter.Id)
+		}
+	}
+	return nil
+}
+
+// pruneLockfile removes the entries of the filters used by the resolved
+// filters from the lock file, if they're no longer used.
+func (r *remoteFilterResolver) pruneLockfile() {
+	for name, locked := range r.lockfile.Filters {
+		if len(locked.RequiredBy) == 0 {
+			continue
+		}
+		if _, ok := r.roots[locked.RequiredBy[0]]; !ok {
+			continue
+		}
+		if _, ok := r.required[name]; !ok {
+			delete(r.lockfile.Filters, name)
+		}
+	}
+}
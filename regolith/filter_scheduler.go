@@ -0,0 +1,235 @@
+package regolith
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// filterLabel returns a name of the filter used in the error messages about
+// the dependencies between the filters. The filters don't have to have
+// unique IDs (and nested profiles don't have them at all) so the label also
+// includes the position of the filter in the profile.
+func filterLabel(filter FilterRunner, index int) string {
+	if profileFilter, ok := filter.(*ProfileFilter); ok {
+		return fmt.Sprintf("filters->%d (profile %s)", index, profileFilter.Profile)
+	}
+	return fmt.Sprintf("filters->%d (%s)", index, filter.GetId())
+}
+
+// filterDependencyGraph resolves the "dependsOn" properties of the filters.
+// It returns a list with the indices of the filters that must finish before
+// each filter can run. If the ID of a dependency is used by multiple filters,
+// the filter depends on all of them. The function returns an error if a
+// dependency can't be found or if the dependencies are circular.
+func filterDependencyGraph(filters []FilterRunner) ([][]int, error) {
+	filterIndices := map[string][]int{}
+	for i, filter := range filters {
+		if filter.GetId() != "" {
+			filterIndices[filter.GetId()] = append(
+				filterIndices[filter.GetId()], i)
+		}
+	}
+	result := make([][]int, len(filters))
+	for i, filter := range filters {
+		for _, dependency := range filter.GetDependsOn() {
+			found := false
+			for _, j := range filterIndices[dependency] {
+				if j == i {
+					continue
+				}
+				result[i] = append(result[i], j)
+				found = true
+			}
+			if !found {
+				return nil, WrappedErrorf(
+					"Filter depends on a filter that is not a part of the "+
+						"profile.\nFilter: %s\nDependency: %s",
+					filterLabel(filter, i), dependency)
+			}
+		}
+	}
+	// Find cycles with depth-first search
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(filters))
+	var path []int
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			// The cycle starts where the filter appears in the path. Every
+			// filter in the chain depends on the next one.
+			start := 0
+			for path[start] != i {
+				start++
+			}
+			cycle := []string{}
+			for _, j := range path[start:] {
+				cycle = append(cycle, filterLabel(filters[j], j))
+			}
+			cycle = append(cycle, filterLabel(filters[i], i))
+			return WrappedErrorf(
+				"Found circular dependency between the filters.\n"+
+					"Dependency chain: %s", strings.Join(cycle, " -> "))
+		}
+		state[i] = visiting
+		path = append(path, i)
+		for _, j := range result[i] {
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		return nil
+	}
+	for i := range filters {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// filterResult is the result of a filter executed by runFiltersInParallel.
+type filterResult struct {
+	index       int
+	interrupted bool
+	err         error
+}
+
+// runFiltersInParallel runs the filters of the profile in the order defined by
+// their dependencies. A filter starts as soon as all of the filters from its
+// "dependsOn" list are finished and there is a free worker. The number of
+// workers is limited by the MaxParallelFilters property of the profile.
+// If a filter fails, no new filters are started but the function waits for
+// the running filters to finish. All of the errors are reported together.
+// If the execution is interrupted, the running filters are stopped and the
+// function returns true. The selected list tells which filters should run
+// (nil means all of them, see selectFilters).
+func runFiltersInParallel(
+	context RunContext, profile Profile, selected []bool,
+) (bool, error) {
+	filters := profile.Filters
+	dependencies, err := filterDependencyGraph(filters)
+	if err != nil {
+		return false, WrapErrorf(err, filterDependenciesError, context.Profile)
+	}
+	// The output of a filter can't be cached when other filters modify the
+	// files at the same time
+	for _, filter := range filters {
+		if len(filter.GetInputs()) > 0 {
+			Logger.Warnf(
+				"The outputs of the filters are not cached in profiles with "+
+					"\"parallel\" enabled. The \"inputs\" properties of the "+
+					"filters are ignored.\nProfile: %s", context.Profile)
+			break
+		}
+	}
+	// Used for stopping the running filters after an interruption
+	context, stopFilters := context.withCancel()
+	defer stopFilters()
+	maxWorkers := profile.MaxParallelFilters
+	if maxWorkers <= 0 {
+		maxWorkers = runtime.NumCPU()
+	}
+	// The number of unfinished dependencies of every filter and the list of
+	// the filters that depend on every filter
+	remaining := make([]int, len(filters))
+	dependents := make([][]int, len(filters))
+	ready := []int{}
+	for i, filterDependencies := range dependencies {
+		remaining[i] = len(filterDependencies)
+		for _, j := range filterDependencies {
+			dependents[j] = append(dependents[j], i)
+		}
+		if remaining[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	// finish marks the filter as finished and schedules the filters that
+	// were waiting for it
+	finish := func(i int) {
+		for _, j := range dependents[i] {
+			remaining[j]--
+			if remaining[j] == 0 {
+				ready = append(ready, j)
+			}
+		}
+	}
+	results := make(chan filterResult)
+	running := 0
+	interrupted := false
+	var errs []error
+	for {
+		for len(ready) > 0 && running < maxWorkers &&
+			!interrupted && len(errs) == 0 {
+			i := ready[0]
+			ready = ready[1:]
+			filter := filters[i]
+			// The filters excluded by the --filter, --from and --until
+			// options are skipped like the disabled filters
+			if selected != nil && !selected[i] {
+				Logger.Debugf("Filter \"%s\" is not selected, skipping.", filter.GetId())
+				finish(i)
+				continue
+			}
+			// Disabled filters are skipped but the filters that depend on
+			// them can still run
+			if filter.IsDisabled(context) {
+				Logger.Infof("Filter \"%s\" is disabled, skipping.", filter.GetId())
+				finish(i)
+				continue
+			}
+			running++
+			go func(i int, filter FilterRunner) {
+				logFilterStarted(context, filter)
+				start := time.Now()
+				interrupted, err := runFilter(context, filter)
+				logFilterFinished(context, filter, time.Since(start), err)
+				results <- filterResult{
+					index: i, interrupted: interrupted, err: err}
+			}(i, filter)
+		}
+		if running == 0 {
+			break
+		}
+		result := <-results
+		running--
+		if interrupted {
+			// The errors of the stopped filters don't matter
+			continue
+		}
+		if result.err != nil {
+			errs = append(errs, WrapErrorf(
+				result.err, filterRunnerRunError,
+				filters[result.index].GetId()))
+			continue
+		}
+		if result.interrupted {
+			interrupted = true
+			stopFilters()
+			continue
+		}
+		finish(result.index)
+	}
+	if len(errs) > 0 && !interrupted {
+		err := errs[0]
+		if len(errs) > 1 {
+			err = WrapErrorsf(errs, parallelFiltersRunError, len(errs))
+		}
+		err1 := ClearCachedStates() // Just to be safe clear cached states
+		if err1 != nil {
+			err = WrapError(err1, clearCachedStatesError)
+		}
+		return false, PassError(err)
+	}
+	return interrupted, nil
+}
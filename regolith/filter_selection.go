@@ -0,0 +1,73 @@
+package regolith
+
+// hasFilterSelection returns true if the options run only a part of the
+// filters of the profile.
+func (o RunOptions) hasFilterSelection() bool {
+	return len(o.Filters) > 0 || o.From != "" || o.Until != ""
+}
+
+// selectFilters returns a list which tells which filters of the profile
+// should run based on the Filters, From and Until options. It returns nil if
+// the options don't select any filters, which means that all of the filters
+// run. The names of the filters that don't exist in the profile are reported
+// as errors.
+func selectFilters(profile Profile, options RunOptions) ([]bool, error) {
+	if !options.hasFilterSelection() {
+		return nil, nil
+	}
+	filters := profile.Filters
+	indexOf := func(id string, start int) int {
+		for i := start; i < len(filters); i++ {
+			if filters[i].GetId() == id {
+				return i
+			}
+		}
+		return -1
+	}
+	from, until := 0, len(filters)-1
+	if options.From != "" {
+		from = indexOf(options.From, 0)
+		if from == -1 {
+			return nil, WrappedErrorf(
+				"The profile doesn't have the filter used by the \"--from\" "+
+					"option.\nFilter: %s", options.From)
+		}
+	}
+	if options.Until != "" {
+		until = indexOf(options.Until, from)
+		if until == -1 {
+			return nil, WrappedErrorf(
+				"The profile doesn't have the filter used by the \"--until\" "+
+					"option after the first filter that runs.\nFilter: %s",
+				options.Until)
+		}
+	}
+	names := map[string]bool{}
+	for _, name := range options.Filters {
+		if indexOf(name, 0) == -1 {
+			return nil, WrappedErrorf(
+				"The profile doesn't have the filter used by the \"--filter\" "+
+					"option.\nFilter: %s", name)
+		}
+		names[name] = true
+	}
+	result := make([]bool, len(filters))
+	for i := from; i <= until; i++ {
+		result[i] = len(names) == 0 || names[filters[i].GetId()]
+	}
+	return result, nil
+}
+
+// firstSelectedFilter returns the index of the first filter that runs, or
+// the number of the filters if none of them run.
+func firstSelectedFilter(selected []bool, filtersCount int) int {
+	if selected == nil {
+		return 0
+	}
+	for i, isSelected := range selected {
+		if isSelected {
+			return i
+		}
+	}
+	return filtersCount
+}
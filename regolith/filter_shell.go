@@ -1,16 +1,43 @@
 package regolith
 
 import (
+	"context"
 	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"regexp"
 	"strings"
 )
 
 type ShellFilterDefinition struct {
 	FilterDefinition
 	Command string `json:"command,omitempty"`
+
+	// Shell is the name of the shell that runs the command ("powershell",
+	// "cmd", "bash" or "sh"). If it's empty, the first shell available on
+	// the system is used.
+	Shell string `json:"shell,omitempty"`
+
+	// PassSettings is the way of passing the settings to the command:
+	// "argument" (default), "env" or "file".
+	PassSettings string `json:"passSettings,omitempty"`
 }
 
+// The ways of passing the settings to the commands of the shell filters.
+const (
+	// The settings are the first argument of the command
+	passSettingsArgument = "argument"
+
+	// The settings are in the FILTER_SETTINGS environment variable
+	passSettingsEnv = "env"
+
+	// The settings are saved to a temporary file with the path in the
+	// FILTER_SETTINGS_FILE environment variable
+	passSettingsFile = "file"
+)
+
 type ShellFilter struct {
 	Filter
 	Definition ShellFilterDefinition `json:"definition,omitempty"`
@@ -30,6 +57,41 @@ func ShellFilterDefinitionFromObject(
 		return nil, WrappedErrorf(jsonPropertyTypeError, "command", "string")
 	}
 	filter.Command = command
+	// Shell
+	if shellObj, ok := obj["shell"]; ok {
+		shell, ok := shellObj.(string)
+		if !ok {
+			return nil, WrappedErrorf(jsonPropertyTypeError, "shell", "string")
+		}
+		if _, ok := shellCommandArgument(shell); !ok {
+			return nil, WrappedErrorf(
+				"Unknown shell.\nShell: %s\n"+
+					"Valid values: powershell, cmd, bash, sh", shell)
+		}
+		filter.Shell = shell
+	}
+	// PassSettings
+	if passSettingsObj, ok := obj["passSettings"]; ok {
+		passSettings, ok := passSettingsObj.(string)
+		if !ok {
+			return nil, WrappedErrorf(
+				jsonPropertyTypeError, "passSettings", "string")
+		}
+		switch passSettings {
+		case passSettingsArgument, passSettingsEnv, passSettingsFile:
+		default:
+			return nil, WrappedErrorf(
+				"Invalid value of the \"passSettings\" property.\n"+
+					"Value: %s\nValid values: argument, env, file",
+				passSettings)
+		}
+		filter.PassSettings = passSettings
+	}
+	protocol, err := filterProtocolFromObject(obj)
+	if err != nil {
+		return nil, PassError(err)
+	}
+	filter.Protocol = protocol
 	return filter, nil
 }
 
@@ -54,12 +116,12 @@ func (f *ShellFilterDefinition) CreateFilterRunner(
 	return filter, nil
 }
 
-func (f *ShellFilterDefinition) InstallDependencies(*RemoteFilterDefinition, string) error {
+func (f *ShellFilterDefinition) InstallDependencies(*RemoteFilterDefinition, string, bool) error {
 	return nil
 }
 
 func (f *ShellFilterDefinition) Check(context RunContext) error {
-	shell, _, err := findShell()
+	shell, _, err := f.findShell()
 	if err != nil {
 		return WrapError(err, "Shell requirements check failed")
 	}
@@ -78,42 +140,114 @@ func (f *ShellFilter) run(
 	settings map[string]interface{},
 	context RunContext,
 ) error {
-	var err error = nil
-	if len(settings) == 0 {
-		err = executeCommand(f.Id,
-			f.Definition.Command,
-			f.Arguments, context.AbsoluteLocation,
-			GetAbsoluteWorkingDirectory(context.DotRegolithPath))
-	} else {
+	shell, shellArg, err := f.Definition.findShell()
+	if err != nil {
+		return WrapError(err, "Unable to find a valid shell.")
+	}
+	if f.Definition.Protocol != noFilterProtocol {
+		err = executeProtocolCommand(
+			context, f.Id, shell, shellArg, f.Definition.Command, settings,
+			f.Arguments)
+		if err != nil {
+			return WrapError(err, "Failed to run shell command.")
+		}
+		return nil
+	}
+	args := f.Arguments
+	var env []string
+	if len(settings) != 0 {
 		jsonSettings, _ := json.Marshal(settings)
-		err = executeCommand(f.Id,
-			f.Definition.Command,
-			append([]string{string(jsonSettings)}, f.Arguments...),
-			context.AbsoluteLocation,
-			GetAbsoluteWorkingDirectory(context.DotRegolithPath))
+		switch f.Definition.PassSettings {
+		case passSettingsEnv:
+			env = []string{"FILTER_SETTINGS=" + string(jsonSettings)}
+		case passSettingsFile:
+			path, err := writeSettingsFile(jsonSettings)
+			if err != nil {
+				return WrapError(err, "Failed to save the settings of the filter.")
+			}
+			defer os.Remove(path)
+			env = []string{"FILTER_SETTINGS_FILE=" + path}
+		default:
+			args = append([]string{string(jsonSettings)}, args...)
+		}
 	}
+	err = executeCommand(context.cancelContext(), f.Id, shell, shellArg,
+		f.Definition.Command, args, env, context.AbsoluteLocation,
+		GetAbsoluteWorkingDirectory(context.DotRegolithPath))
 	if err != nil {
 		return WrapError(err, "Failed to run shell command.")
 	}
 	return nil
 }
 
-func executeCommand(id string,
-	command string, args []string, filterDir string, workingDir string,
+// writeSettingsFile saves the settings of a filter to a temporary file and
+// returns its path.
+func writeSettingsFile(jsonSettings []byte) (string, error) {
+	file, err := ioutil.TempFile("", "regolith-settings-*.json")
+	if err != nil {
+		return "", WrapError(err, "Failed to create a temporary file.")
+	}
+	_, err = file.Write(jsonSettings)
+	if err := firstErr(err, file.Close()); err != nil {
+		os.Remove(file.Name())
+		return "", WrapErrorf(err, fileWriteError, file.Name())
+	}
+	return file.Name(), nil
+}
+
+// executeCommand executes the command with the shell. The arguments are
+// quoted for the shell and appended to the command. The env are additional
+// environment variables of the command in the "NAME=value" format.
+func executeCommand(ctx context.Context, id string,
+	shell, shellArg, command string, args []string, env []string,
+	filterDir string, workingDir string,
 ) error {
-	joined := strings.Join(append([]string{command}, args...), " ")
+	joined := joinShellCommand(shell, command, args)
 	Logger.Debugf("Executing command: %s", joined)
-	shell, arg, err := findShell()
+	err := runSubProcess(
+		ctx, shell, []string{shellArg, joined}, filterDir, workingDir,
+		ShortFilterName(id), nil, env,
+		ShellCommandLine(shell, shellArg, command, args),
+		func(in io.ReadCloser) { go LogStd(in, "stdout", ShortFilterName(id)) })
 	if err != nil {
-		return WrapError(err, "Unable to find a valid shell.")
+		return WrapError(err, runSubProcessError)
 	}
-	err = RunSubProcess(shell, []string{arg, joined}, filterDir, workingDir, ShortFilterName(id))
+	return nil
+}
+
+// executeProtocolCommand executes the command of a shell filter that uses
+// the filter protocol. The settings and the arguments are sent in the
+// request of the protocol instead of being appended to the command.
+func executeProtocolCommand(
+	context RunContext, id, shell, shellArg, command string,
+	settings map[string]interface{}, arguments []string,
+) error {
+	Logger.Debugf("Executing command: %s", command)
+	err := runProtocolFilter(
+		context, id, settings, arguments, shell, []string{shellArg, command},
+		ShellCommandLine(shell, shellArg, command, nil))
 	if err != nil {
 		return WrapError(err, runSubProcessError)
 	}
 	return nil
 }
 
+// findShell returns the shell selected by the "shell" property of the filter
+// definition and the argument that makes it execute a command. If the
+// property isn't set, it returns the first shell available on the system.
+func (f *ShellFilterDefinition) findShell() (string, string, error) {
+	if f.Shell == "" {
+		return findShell()
+	}
+	if _, err := exec.LookPath(f.Shell); err != nil {
+		return "", "", WrapErrorf(
+			err, "The shell of the filter is not available.\nShell: %s",
+			f.Shell)
+	}
+	arg, _ := shellCommandArgument(f.Shell)
+	return f.Shell, arg, nil
+}
+
 func findShell() (string, string, error) {
 	for _, shell := range shells {
 		_, err := exec.LookPath(shell[0])
@@ -123,3 +257,116 @@ func findShell() (string, string, error) {
 	}
 	return "", "", WrappedError("Unable to find a valid shell.")
 }
+
+// shellCommandArgument returns the argument that makes the shell execute a
+// command. It returns false if the shell isn't supported.
+func shellCommandArgument(shell string) (string, bool) {
+	for _, s := range shells {
+		if s[0] == shell {
+			return s[1], true
+		}
+	}
+	return "", false
+}
+
+// joinShellCommand appends the arguments quoted for the shell to the
+// command.
+func joinShellCommand(shell, command string, args []string) string {
+	joined := command
+	for _, arg := range args {
+		joined += " " + quoteShellArgument(shell, arg)
+	}
+	return joined
+}
+
+// ShellCommandLine returns the command line of the shell process that runs
+// the command with the arguments. It's used on Windows, where the arguments
+// of a process are passed in a single command line. The default escaping of
+// the arguments of the processes uses backslashes, which cmd doesn't
+// understand, so the command line of the shell is built manually.
+func ShellCommandLine(shell, shellArg, command string, args []string) string {
+	joined := joinShellCommand(shell, command, args)
+	if shell == "cmd" {
+		// With "/s", cmd removes the first and the last quote and runs the
+		// rest of the command line without any changes. The special
+		// characters of the arguments are already escaped with "^".
+		return shell + " /s " + shellArg + " \"" + joined + "\""
+	}
+	// PowerShell and the other shells parse their command lines using the
+	// rules of CommandLineToArgvW
+	return shell + " " + shellArg + " " + escapeWindowsArgument(joined, true)
+}
+
+// shellSafeArgumentPattern matches the arguments that don't need quoting in
+// any of the supported shells.
+var shellSafeArgumentPattern = regexp.MustCompile(`^[A-Za-z0-9_+=:./-]+$`)
+
+// quoteShellArgument quotes the argument, so the shell passes it to the
+// command as a single argument without changing it.
+func quoteShellArgument(shell, arg string) string {
+	if shellSafeArgumentPattern.MatchString(arg) {
+		return arg
+	}
+	switch shell {
+	case "powershell":
+		// PowerShell doesn't expand anything in single quotes, but it
+		// doesn't escape the double quotes when it passes the arguments to
+		// the other programs, so they have to be escaped for the parsing
+		// of the command line of the program.
+		return "'" + strings.ReplaceAll(
+			escapeWindowsArgument(arg, false), "'", "''") + "'"
+	case "cmd":
+		// The argument is quoted for the parsing of the command line of the
+		// program and the special characters of cmd are escaped with "^".
+		// Escaping "%" with "^" breaks the names of the variables, so they
+		// aren't expanded.
+		quoted := escapeWindowsArgument(arg, true)
+		var result strings.Builder
+		for _, c := range quoted {
+			if strings.ContainsRune("()%!^\"<>&|", c) {
+				result.WriteRune('^')
+			}
+			result.WriteRune(c)
+		}
+		return result.String()
+	}
+	// POSIX shells don't expand anything in single quotes. The single quotes
+	// are closed, escaped and opened again.
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// escapeWindowsArgument escapes the argument for the parsing of the command
+// line of the Windows programs (the rules of CommandLineToArgvW). The double
+// quotes and the backslashes before them are escaped with backslashes. If
+// the wrap is true, the result is also wrapped in double quotes. Otherwise,
+// the backslashes at the end of the argument are escaped if it has
+// whitespace, because the program that passes it is expected to wrap it in
+// double quotes.
+func escapeWindowsArgument(arg string, wrap bool) string {
+	var result strings.Builder
+	if wrap {
+		result.WriteByte('"')
+	}
+	backslashes := 0
+	for _, c := range arg {
+		switch c {
+		case '\\':
+			backslashes++
+			continue
+		case '"':
+			result.WriteString(strings.Repeat("\\", 2*backslashes+1))
+		default:
+			result.WriteString(strings.Repeat("\\", backslashes))
+		}
+		backslashes = 0
+		result.WriteRune(c)
+	}
+	if wrap || strings.ContainsAny(arg, " \t") {
+		backslashes *= 2
+	}
+	result.WriteString(strings.Repeat("\\", backslashes))
+	if wrap {
+		result.WriteByte('"')
+	}
+	return result.String()
+}
@@ -0,0 +1,424 @@
+package regolith
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/bgentry/go-netrc/netrc"
+	"github.com/hashicorp/go-getter"
+	"github.com/otiai10/copy"
+)
+
+// localFilterSourceVersion is the only version of the remote filters from
+// the sources without versions (local directories and archives).
+const localFilterSourceVersion = "HEAD"
+
+// filterSource is the source of the remote filters, chosen based on the
+// scheme of their URL. It finds the versions of the filters and downloads
+// their files.
+type filterSource interface {
+	// tags returns the names of all of the tags of the source
+	tags() ([]string, error)
+
+	// headSha returns the SHA of the newest commit of the source
+	headSha() (string, error)
+
+	// refSha returns the SHA of the commit that the reference (a tag, a
+	// branch or a commit SHA) points to
+	refSha(ref string) (string, error)
+
+	// download downloads the files of the filter with the name from the
+	// commit with the SHA to the path
+	download(name, sha, path string) error
+}
+
+// filterSourceKind is a kind of the sources of the remote filters.
+type filterSourceKind struct {
+	// matches returns true if the URL uses this kind of the source
+	matches func(url string) bool
+
+	// create creates the source for the URL
+	create func(url string) filterSource
+}
+
+// filterSourceKinds are the kinds of the sources of the remote filters in
+// the order in which they're matched with the URLs. The git repositories are
+// the last because they also match the URLs without a scheme.
+var filterSourceKinds = []filterSourceKind{
+	{matches: isArchiveFilterUrl, create: newArchiveFilterSource},
+	{matches: isLocalFilterUrl, create: newDirFilterSource},
+	{
+		matches: func(string) bool { return true },
+		create:  newGitFilterSource,
+	},
+}
+
+// newFilterSource returns the source of the remote filters with the URL.
+func newFilterSource(url string) filterSource {
+	for _, kind := range filterSourceKinds {
+		if kind.matches(url) {
+			return kind.create(url)
+		}
+	}
+	return nil // Unreachable, git matches all of the URLs
+}
+
+// scpLikeUrlPattern matches the SSH URLs in the scp-like syntax supported by
+// git, for example "git@gitlab.com:group/project".
+var scpLikeUrlPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+@[^/:]+:[^/]`)
+
+// windowsPathPattern matches the absolute paths on Windows.
+var windowsPathPattern = regexp.MustCompile(`^[A-Za-z]:[\\/]`)
+
+// isLocalFilterUrl returns true if the URL is a path to a local directory.
+// The relative paths must start with "./" or "../" and are relative to the
+// root of the project.
+func isLocalFilterUrl(url string) bool {
+	return url == "." || url == ".." || strings.HasPrefix(url, "./") ||
+		strings.HasPrefix(url, "../") || strings.HasPrefix(url, "/") ||
+		windowsPathPattern.MatchString(url)
+}
+
+// isArchiveFilterUrl returns true if the URL points to a zip or tar.gz
+// archive.
+func isArchiveFilterUrl(url string) bool {
+	path := strings.SplitN(url, "?", 2)[0]
+	for _, extension := range []string{".zip", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(strings.ToLower(path), extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// gitFilterSource is a git repository with the remote filters. The URL can
+// use any scheme supported by git ("https://", "ssh://", "git://",
+// "file://" or the scp-like "user@host:path" syntax). The URLs without a
+// scheme use HTTPS. The "git::" prefix is optional. The credentials are
+// handled by git, so they can come from the git credential helper, the SSH
+// agent or the .netrc file.
+type gitFilterSource struct {
+	// url is the URL from the filter definition
+	url string
+
+	// repoUrl is the URL of the repository used with the git commands
+	repoUrl string
+}
+
+func newGitFilterSource(url string) filterSource {
+	url = strings.TrimPrefix(url, "git::")
+	repoUrl := url
+	if !strings.Contains(url, "://") && !scpLikeUrlPattern.MatchString(url) {
+		repoUrl = "https://" + url
+	}
+	return &gitFilterSource{url: url, repoUrl: repoUrl}
+}
+
+// lsRemote runs the "git ls-remote" command with the URL of the repository
+// and returns its output.
+func (s *gitFilterSource) lsRemote(args ...string) (string, error) {
+	if !hasGit() {
+		return "", WrappedError(gitNotInstalledWarning)
+	}
+	commandArgs := append([]string{"ls-remote"}, args...)
+	commandArgs = append(commandArgs, s.repoUrl)
+	output, err := exec.Command("git", commandArgs...).Output()
+	if err != nil {
+		command := "git " + strings.Join(commandArgs, " ")
+		return "", WrapErrorf(err, execCommandError, command)
+	}
+	return string(output), nil
+}
+
+func (s *gitFilterSource) tags() ([]string, error) {
+	output, err := s.lsRemote("--tags")
+	if err != nil {
+		return nil, PassError(err)
+	}
+	var tags []string
+	for _, line := range strings.Split(output, "\n") {
+		// The command returns SHA and the tag name. We only want the tag name.
+		if strings.Contains(line, "refs/tags/") {
+			tags = append(tags, strings.Split(line, "refs/tags/")[1])
+		}
+	}
+	return tags, nil
+}
+
+func (s *gitFilterSource) headSha() (string, error) {
+	output, err := s.lsRemote("--symref")
+	if err != nil {
+		return "", PassError(err)
+	}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[1] == "HEAD" {
+			return fields[0], nil
+		}
+	}
+	return "", WrappedErrorf(
+		"The repository doesn't have the HEAD reference.\nRepository: %s",
+		s.url)
+}
+
+func (s *gitFilterSource) refSha(ref string) (string, error) {
+	if len(ref) == 40 && isCommitSha(ref) {
+		return ref, nil
+	}
+	output, err := s.lsRemote()
+	if err != nil {
+		return "", PassError(err)
+	}
+	// Annotated tags point to the tag objects, their commits are listed
+	// with the "^{}" suffix
+	var tagSha, peeledTagSha, branchSha string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[1] {
+		case "refs/tags/" + ref:
+			tagSha = fields[0]
+		case "refs/tags/" + ref + "^{}":
+			peeledTagSha = fields[0]
+		case "refs/heads/" + ref:
+			branchSha = fields[0]
+		}
+	}
+	for _, sha := range []string{peeledTagSha, tagSha, branchSha} {
+		if sha != "" {
+			return sha, nil
+		}
+	}
+	// Abbreviated commit SHAs can't be resolved with "ls-remote"
+	if isCommitSha(ref) {
+		return ref, nil
+	}
+	return "", WrappedErrorf(
+		"The reference doesn't exist in the repository.\n"+
+			"Repository: %s\nRef: %s", s.url, ref)
+}
+
+func (s *gitFilterSource) download(name, sha, path string) error {
+	if !hasGit() {
+		return WrappedError(gitNotInstalledWarning)
+	}
+	var source string
+	if s.repoUrl == "https://"+s.url {
+		// The URLs without a scheme are detected by go-getter
+		source = fmt.Sprintf("%s//%s?ref=%s", s.url, name, sha)
+	} else {
+		source = fmt.Sprintf(
+			"git::%s//%s?ref=%s", scpLikeToSshUrl(s.repoUrl), name, sha)
+	}
+	if err := getter.Get(path, source); err != nil {
+		return WrapErrorf(err, "Failed to download the files.\nSource: %s", source)
+	}
+	return nil
+}
+
+// scpLikeToSshUrl converts the scp-like SSH URL ("user@host:path") to the
+// "ssh://" URL, because go-getter doesn't support the scp-like syntax. Other
+// URLs are returned unchanged.
+func scpLikeToSshUrl(url string) string {
+	if !scpLikeUrlPattern.MatchString(url) {
+		return url
+	}
+	hostEnd := strings.Index(url, ":")
+	return "ssh://" + url[:hostEnd] + "/" + url[hostEnd+1:]
+}
+
+// dirFilterSource is a local directory with the remote filters. The
+// directory doesn't have versions, the filters are always copied from its
+// current state.
+type dirFilterSource struct {
+	// path is the path to the directory
+	path string
+}
+
+func newDirFilterSource(url string) filterSource {
+	return &dirFilterSource{path: filepath.FromSlash(url)}
+}
+
+func (s *dirFilterSource) tags() ([]string, error) {
+	return nil, nil
+}
+
+func (s *dirFilterSource) headSha() (string, error) {
+	return localFilterSourceVersion, nil
+}
+
+func (s *dirFilterSource) refSha(ref string) (string, error) {
+	return unversionedFilterSourceRefSha(s.path, ref)
+}
+
+func (s *dirFilterSource) download(name, _, path string) error {
+	source := filepath.Join(s.path, name)
+	stat, err := os.Stat(source)
+	if err != nil || !stat.IsDir() {
+		return WrappedErrorf(
+			"The filter directory doesn't exist.\nPath: %s", source)
+	}
+	err = copy.Copy(source, path, copy.Options{PreserveTimes: false, Sync: false})
+	if err != nil {
+		return WrapErrorf(err, osCopyError, source, path)
+	}
+	return nil
+}
+
+// archiveFilterSource is a zip or tar.gz archive with the remote filters.
+// The archive can be a local file or it can be downloaded with HTTP(S). The
+// archive doesn't have versions. The credentials for downloading the
+// archive come from the URL, from the .netrc file or from the git
+// credential helper.
+type archiveFilterSource struct {
+	// url is the URL or the path to the archive
+	url string
+}
+
+func newArchiveFilterSource(url string) filterSource {
+	return &archiveFilterSource{url: url}
+}
+
+func (s *archiveFilterSource) tags() ([]string, error) {
+	return nil, nil
+}
+
+func (s *archiveFilterSource) headSha() (string, error) {
+	return localFilterSourceVersion, nil
+}
+
+func (s *archiveFilterSource) refSha(ref string) (string, error) {
+	return unversionedFilterSourceRefSha(s.url, ref)
+}
+
+func (s *archiveFilterSource) download(name, _, path string) error {
+	source := s.url
+	if isLocalFilterUrl(source) {
+		absSource, err := filepath.Abs(filepath.FromSlash(source))
+		if err != nil {
+			return WrapErrorf(err, filepathAbsError, source)
+		}
+		source = absSource
+	} else {
+		source = urlWithCredentials(source)
+	}
+	// The query of the URL must be after the subdirectory
+	query := ""
+	if i := strings.Index(source, "?"); i != -1 {
+		source, query = source[:i], source[i:]
+	}
+	source = fmt.Sprintf("%s//%s%s", source, name, query)
+	if err := getter.Get(path, source); err != nil {
+		return WrapErrorf(
+			err, "Failed to download the files.\nSource: %s", s.url)
+	}
+	return nil
+}
+
+// unversionedFilterSourceRefSha is the refSha function of the sources
+// without versions. The only valid reference is "HEAD".
+func unversionedFilterSourceRefSha(url, ref string) (string, error) {
+	if ref != localFilterSourceVersion {
+		return "", WrappedErrorf(
+			"The filters from local directories and archives don't have "+
+				"versions. Use the \"HEAD\" version.\nURL: %s\nVersion: %s",
+			url, ref)
+	}
+	return localFilterSourceVersion, nil
+}
+
+// urlWithCredentials adds the user name and the password to the HTTP(S)
+// URL, if it doesn't have them already. The credentials come from the
+// .netrc file or from the git credential helper. If there are no
+// credentials, the URL is returned unchanged.
+func urlWithCredentials(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.User != nil ||
+		(u.Scheme != "http" && u.Scheme != "https") {
+		return rawUrl
+	}
+	login, password, ok := netrcCredentials(u.Hostname())
+	if !ok {
+		login, password, ok = gitCredentials(u)
+	}
+	if !ok {
+		return rawUrl
+	}
+	u.User = url.UserPassword(login, password)
+	return u.String()
+}
+
+// netrcCredentials returns the login and the password for the host from the
+// .netrc file. The path to the file can be changed with the NETRC
+// environment variable.
+func netrcCredentials(host string) (string, string, bool) {
+	path := os.Getenv("NETRC")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", false
+		}
+		name := ".netrc"
+		if runtime.GOOS == "windows" {
+			name = "_netrc"
+		}
+		path = filepath.Join(home, name)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", "", false
+	}
+	machine, err := netrc.FindMachine(path, host)
+	if err != nil {
+		Logger.Debugf("Failed to read the .netrc file: %s", err)
+		return "", "", false
+	}
+	if machine == nil || machine.Login == "" {
+		return "", "", false
+	}
+	return machine.Login, machine.Password, true
+}
+
+// gitCredentials returns the user name and the password for the URL from
+// the git credential helper. Git doesn't ask for the credentials in the
+// terminal if the helper doesn't have them.
+func gitCredentials(u *url.URL) (string, string, bool) {
+	if !hasGit() {
+		return "", "", false
+	}
+	input := fmt.Sprintf(
+		"protocol=%s\nhost=%s\npath=%s\n\n",
+		u.Scheme, u.Host, strings.TrimPrefix(u.Path, "/"))
+	cmd := exec.Command("git", "credential", "fill")
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", "", false
+	}
+	var username, password string
+	for _, line := range bytes.Split(output, []byte("\n")) {
+		key, value, ok := strings.Cut(string(line), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "username":
+			username = value
+		case "password":
+			password = value
+		}
+	}
+	if username == "" {
+		return "", "", false
+	}
+	return username, password, true
+}
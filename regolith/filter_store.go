@@ -0,0 +1,318 @@
+package regolith
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/otiai10/copy"
+)
+
+// filterStorePath is the path to the filter store relative to the user's
+// cache directory, next to the app data cache of the projects.
+const filterStorePath = "regolith/filter-store"
+
+// The names of the files and directories in the filter store.
+const (
+	// filterStoreFilesDir is the directory with the files of the filter in
+	// an entry of the store
+	filterStoreFilesDir = "files"
+
+	// filterStoreEntryInfoFile is the file with the information about an
+	// entry of the store
+	filterStoreEntryInfoFile = "entry.json"
+
+	// filterStoreProjectsFile is the file with the list of the projects
+	// that installed the filters from the store
+	filterStoreProjectsFile = "projects.json"
+
+	// filterStoreTmpPrefix is the prefix of the directories of the entries
+	// that are still being downloaded
+	filterStoreTmpPrefix = ".tmp-"
+)
+
+// filterStore is the store of the downloaded remote filters shared by all of
+// the projects of the user. The entries of the store are addressed by the
+// URL of the repository, the name of the filter and the SHA of the commit,
+// so every version of a filter is downloaded only once. The projects copy
+// the filters from the store to their own cache.
+type filterStore struct {
+	// path is the path to the root of the store
+	path string
+}
+
+// filterStoreEntry is the information about an entry of the filter store,
+// saved in its directory.
+type filterStoreEntry struct {
+	// Url is the URL of the repository of the filter
+	Url string `json:"url"`
+
+	// Name is the name of the filter
+	Name string `json:"name"`
+
+	// Sha is the SHA of the commit of the filter
+	Sha string `json:"sha"`
+}
+
+// filterStoreProjects is the list of the projects that installed the
+// filters from the store. It's used to find the unused entries.
+type filterStoreProjects struct {
+	// Projects are the absolute paths to the roots of the projects
+	Projects []string `json:"projects"`
+}
+
+// openFilterStore returns the filter store in the user's cache directory.
+func openFilterStore() (*filterStore, error) {
+	userCache, err := os.UserCacheDir()
+	if err != nil {
+		return nil, WrappedError(osUserCacheDirError)
+	}
+	return &filterStore{path: filepath.Join(userCache, filterStorePath)}, nil
+}
+
+// isStorableFilterSha returns true if the filter downloaded from the commit
+// with the SHA can be saved in the filter store. The filters from the
+// sources without versions (local directories and archives) are always
+// downloaded again because their files can change.
+func isStorableFilterSha(sha string) bool {
+	return isCommitSha(sha)
+}
+
+// filterStoreKey returns the name of the directory of the entry of the
+// store for the filter.
+func filterStoreKey(url, name, sha string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{url, name, sha}, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// entryPath returns the path to the directory of the entry of the store.
+func (s *filterStore) entryPath(url, name, sha string) string {
+	return filepath.Join(s.path, filterStoreKey(url, name, sha))
+}
+
+// has returns true if the filter is saved in the store.
+func (s *filterStore) has(url, name, sha string) bool {
+	stat, err := os.Stat(
+		filepath.Join(s.entryPath(url, name, sha), filterStoreFilesDir))
+	return err == nil && stat.IsDir()
+}
+
+// add downloads the filter to the store using the download function. The
+// filter is downloaded to a temporary directory first and moved to its
+// entry when the download is complete, so the store never contains
+// partially downloaded filters.
+func (s *filterStore) add(
+	url, name, sha string, download func(path string) error,
+) error {
+	err := os.MkdirAll(s.path, 0755)
+	if err != nil {
+		return WrapErrorf(err, osMkdirError, s.path)
+	}
+	tmpPath, err := ioutil.TempDir(s.path, filterStoreTmpPrefix)
+	if err != nil {
+		return WrapErrorf(err, osMkdirError, s.path)
+	}
+	defer os.RemoveAll(tmpPath)
+	err = download(filepath.Join(tmpPath, filterStoreFilesDir))
+	if err != nil {
+		return PassError(err)
+	}
+	entryJson, _ := json.MarshalIndent(filterStoreEntry{
+		Url: url, Name: name, Sha: sha}, "", "\t") // no error
+	entryInfoPath := filepath.Join(tmpPath, filterStoreEntryInfoFile)
+	err = ioutil.WriteFile(entryInfoPath, entryJson, 0644)
+	if err != nil {
+		return WrapErrorf(err, fileWriteError, entryInfoPath)
+	}
+	entryPath := s.entryPath(url, name, sha)
+	err = os.Rename(tmpPath, entryPath)
+	if err != nil && !s.has(url, name, sha) {
+		return WrapErrorf(err, osRenameError, tmpPath, entryPath)
+	}
+	// If the rename failed, the entry has been added by another process
+	return nil
+}
+
+// copyTo copies the files of the filter from the store to the path. The
+// files are copied and not linked because the installed filters are
+// modified (the version is saved in their filter.json files).
+func (s *filterStore) copyTo(url, name, sha, path string) error {
+	source := filepath.Join(s.entryPath(url, name, sha), filterStoreFilesDir)
+	err := copy.Copy(
+		source, path, copy.Options{PreserveTimes: false, Sync: false})
+	if err != nil {
+		return WrapErrorf(err, osCopyError, source, path)
+	}
+	return nil
+}
+
+// loadProjects loads the list of the projects that use the store. If the
+// list doesn't exist, it returns an empty list.
+func (s *filterStore) loadProjects() (*filterStoreProjects, error) {
+	result := &filterStoreProjects{}
+	path := filepath.Join(s.path, filterStoreProjectsFile)
+	file, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, WrapErrorf(err, fileReadError, path)
+	}
+	err = json.Unmarshal(file, result)
+	if err != nil {
+		return nil, WrapErrorf(err, jsonUnmarshalError, path)
+	}
+	return result, nil
+}
+
+// saveProjects saves the list of the projects that use the store.
+func (s *filterStore) saveProjects(projects *filterStoreProjects) error {
+	err := os.MkdirAll(s.path, 0755)
+	if err != nil {
+		return WrapErrorf(err, osMkdirError, s.path)
+	}
+	path := filepath.Join(s.path, filterStoreProjectsFile)
+	projectsJson, _ := json.MarshalIndent(projects, "", "\t") // no error
+	err = ioutil.WriteFile(path, projectsJson, 0644)
+	if err != nil {
+		return WrapErrorf(err, fileWriteError, path)
+	}
+	return nil
+}
+
+// addProject adds the project to the list of the projects that use the
+// store. The entries locked by the lock files of these projects are kept
+// when the store is pruned.
+func (s *filterStore) addProject(projectRoot string) error {
+	absoluteProjectRoot, err := filepath.Abs(projectRoot)
+	if err != nil {
+		return WrapErrorf(err, filepathAbsError, projectRoot)
+	}
+	projects, err := s.loadProjects()
+	if err != nil {
+		return PassError(err)
+	}
+	for _, project := range projects.Projects {
+		if project == absoluteProjectRoot {
+			return nil
+		}
+	}
+	projects.Projects = append(projects.Projects, absoluteProjectRoot)
+	sort.Strings(projects.Projects)
+	err = s.saveProjects(projects)
+	if err != nil {
+		return PassError(err)
+	}
+	return nil
+}
+
+// prune removes the entries of the store that aren't locked in the lock
+// file of any of the projects that use the store, and the projects that no
+// longer exist from the list of the projects. It returns the removed
+// entries.
+func (s *filterStore) prune() ([]filterStoreEntry, error) {
+	projects, err := s.loadProjects()
+	if err != nil {
+		return nil, PassError(err)
+	}
+	usedKeys := map[string]bool{}
+	existingProjects := []string{}
+	for _, project := range projects.Projects {
+		if _, err := os.Stat(filepath.Join(project, ConfigFilePath)); err != nil {
+			Logger.Debugf("Project %q no longer exists.", project)
+			continue
+		}
+		lockfile, err := loadLockfile(filepath.Join(project, LockfilePath))
+		if err != nil {
+			return nil, WrapErrorf(
+				err, "Failed to load the lock file of the project.\n"+
+					"Project: %s", project)
+		}
+		existingProjects = append(existingProjects, project)
+		for name, locked := range lockfile.Filters {
+			usedKeys[filterStoreKey(locked.Url, name, locked.Sha)] = true
+		}
+	}
+	dirs, err := ioutil.ReadDir(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, WrapErrorf(err, osReadDirError, s.path)
+	}
+	removed := []filterStoreEntry{}
+	for _, dir := range dirs {
+		if !dir.IsDir() || usedKeys[dir.Name()] {
+			continue
+		}
+		entryPath := filepath.Join(s.path, dir.Name())
+		entry := filterStoreEntry{}
+		if !strings.HasPrefix(dir.Name(), filterStoreTmpPrefix) {
+			entryInfoPath := filepath.Join(entryPath, filterStoreEntryInfoFile)
+			entryJson, err := ioutil.ReadFile(entryInfoPath)
+			if err == nil {
+				json.Unmarshal(entryJson, &entry)
+			}
+		}
+		err = os.RemoveAll(entryPath)
+		if err != nil {
+			return removed, WrapErrorf(err, osRemoveError, entryPath)
+		}
+		removed = append(removed, entry)
+	}
+	projects.Projects = existingProjects
+	err = s.saveProjects(projects)
+	if err != nil {
+		return removed, PassError(err)
+	}
+	return removed, nil
+}
+
+// downloadStoredFilter downloads the filter to the path through the filter
+// store. If the filter is already in the store, it's copied from there.
+// Otherwise, it's downloaded to the store first. In offline mode, the
+// filters that aren't in the store can't be downloaded. The filters that
+// can't be saved in the store are downloaded directly.
+func downloadStoredFilter(url, name, sha, path string, offline bool) error {
+	source := newFilterSource(url)
+	if !isStorableFilterSha(sha) {
+		return source.download(name, sha, path)
+	}
+	store, err := openFilterStore()
+	if err != nil {
+		return WrapError(err, "Failed to open the filter store.")
+	}
+	if store.has(url, name, sha) {
+		Logger.Debugf(
+			"Using filter %q from the filter store: %s",
+			name, store.entryPath(url, name, sha))
+	} else if offline {
+		return WrappedErrorf(
+			"The filter is not in the filter store and it can't be "+
+				"downloaded in offline mode.\nURL: %s\nFilter: %s\nCommit: %s",
+			url, name, sha)
+	} else {
+		err = store.add(url, name, sha, func(storePath string) error {
+			return source.download(name, sha, storePath)
+		})
+		if err != nil {
+			return WrapError(err, "Failed to add the filter to the filter store.")
+		}
+	}
+	err = store.copyTo(url, name, sha, path)
+	if err != nil {
+		return PassError(err)
+	}
+	err = store.addProject(".")
+	if err != nil {
+		Logger.Warnf(
+			"Failed to add the project to the list of the projects that "+
+				"use the filter store.\n%s", err.Error())
+	}
+	return nil
+}
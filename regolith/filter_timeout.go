@@ -0,0 +1,119 @@
+package regolith
+
+import (
+	"context"
+	"time"
+)
+
+// parseFilterTimeout parses the "timeout" property of a filter. The timeout
+// uses the format of Go durations, for example "30s", "5m" or "1h30m". An
+// empty string means no timeout.
+func parseFilterTimeout(timeout string) (time.Duration, error) {
+	if timeout == "" {
+		return 0, nil
+	}
+	result, err := time.ParseDuration(timeout)
+	if err != nil {
+		return 0, WrapErrorf(
+			err, "Invalid timeout. Use values like \"30s\", \"5m\" or "+
+				"\"1h30m\".\nTimeout: %s", timeout)
+	}
+	if result <= 0 {
+		return 0, WrappedErrorf(
+			"The timeout must be greater than zero.\nTimeout: %s", timeout)
+	}
+	return result, nil
+}
+
+// filterStopReason is the reason why the subprocesses of a filter were
+// killed.
+type filterStopReason int
+
+const (
+	// The filter wasn't stopped by startFilter (but it could be stopped by
+	// a parent context)
+	filterNotStopped filterStopReason = iota
+
+	// The filter didn't finish before its timeout
+	filterTimedOut
+
+	// The source files changed while the filter was running in the watch
+	// mode
+	filterInterrupted
+)
+
+// startFilter returns a copy of the RunContext for running a single filter.
+// The subprocesses of the filter are killed when it reaches the timeout
+// (unless the timeout is zero) or when the source files change in the watch
+// mode. The returned function must be called when the filter finishes. It
+// returns the reason why the filter was stopped.
+func (c *RunContext) startFilter(
+	timeout time.Duration,
+) (RunContext, func() filterStopReason) {
+	result := *c
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(c.cancelContext(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(c.cancelContext())
+	}
+	result.ctx = ctx
+	// The interruption is received here and not by the IsInterrupted
+	// function of the filter, because the filter can't check for the
+	// interruptions while its subprocess is running.
+	interrupted := make(chan bool, 1)
+	done := make(chan struct{})
+	if c.interruptionChannel != nil {
+		go func() {
+			select {
+			case <-c.interruptionChannel:
+				cancel()
+				interrupted <- true
+			case <-done:
+				interrupted <- false
+			}
+		}()
+	} else {
+		interrupted <- false
+	}
+	stop := func() filterStopReason {
+		close(done)
+		wasInterrupted := <-interrupted
+		timedOut := ctx.Err() == context.DeadlineExceeded &&
+			c.cancelContext().Err() == nil
+		cancel()
+		if wasInterrupted {
+			return filterInterrupted
+		}
+		if timedOut {
+			return filterTimedOut
+		}
+		return filterNotStopped
+	}
+	return result, stop
+}
+
+// runFilter runs the filter with its timeout. If the filter reaches the
+// timeout, its subprocesses are killed and an error is returned. In the
+// watch mode, the filter is also stopped when the source files change, in
+// which case the function returns true, like after any other interruption.
+func runFilter(context RunContext, filter FilterRunner) (bool, error) {
+	timeout := filter.GetTimeout()
+	filterContext, stop := context.startFilter(timeout)
+	interrupted, err := filter.Run(filterContext)
+	switch stop() {
+	case filterTimedOut:
+		// The filter could finish just before the timeout
+		if err != nil {
+			return false, WrapErrorf(
+				err, filterTimeoutError, filter.GetId(), timeout)
+		}
+	case filterInterrupted:
+		Logger.Warnf(
+			"Stopped filter %s because the source files changed.",
+			filter.GetId())
+		return true, nil
+	}
+	return interrupted, err
+}
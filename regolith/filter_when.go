@@ -0,0 +1,308 @@
+package regolith
+
+import (
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// The variables of the "when" expressions of the filters that are set by
+// Regolith. The other variables come from the "-v name=value" flags of the
+// "regolith run" and "regolith watch" commands. The environment variables
+// are available with the "env." prefix, for example "env.CI".
+const (
+	// The operating system (runtime.GOOS), like "windows", "linux" or
+	// "darwin"
+	whenOsVariable = "os"
+
+	// The architecture of the processor (runtime.GOARCH)
+	whenArchVariable = "arch"
+
+	// The name of the profile that runs the filter
+	whenProfileVariable = "profile"
+
+	// "true" in the watch mode, otherwise "false"
+	whenWatchVariable = "watch"
+
+	// The prefix of the environment variables
+	whenEnvPrefix = "env."
+)
+
+// whenVariableNamePattern matches the names of the variables that can be set
+// with the "-v" flag.
+var whenVariableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// whenExpression is a parsed "when" expression of a filter. It returns the
+// value of the expression for the variables from the RunContext.
+type whenExpression func(context RunContext) string
+
+// ParseRunVariables parses the "name=value" pairs from the "-v" flags of the
+// "regolith run" and "regolith watch" commands into a map of the variables
+// used by the "when" expressions of the filters.
+func ParseRunVariables(variables []string) (map[string]string, error) {
+	result := make(map[string]string, len(variables))
+	for _, variable := range variables {
+		name, value, ok := strings.Cut(variable, "=")
+		if !ok {
+			return nil, WrappedErrorf(
+				"Variables must use the \"name=value\" format.\n"+
+					"Variable: %s", variable)
+		}
+		if !whenVariableNamePattern.MatchString(name) {
+			return nil, WrappedErrorf(
+				"Invalid variable name. The names can only use letters, "+
+					"digits and underscores.\nVariable: %s", name)
+		}
+		switch name {
+		case whenOsVariable, whenArchVariable, whenProfileVariable,
+			whenWatchVariable, "env", "true", "false":
+			return nil, WrappedErrorf(
+				"The name of the variable is reserved by Regolith.\n"+
+					"Variable: %s", name)
+		}
+		result[name] = value
+	}
+	return result, nil
+}
+
+// whenVariable returns the value of a variable of the "when" expressions.
+// Variables that aren't set are empty strings.
+func (c *RunContext) whenVariable(name string) string {
+	switch name {
+	case whenOsVariable:
+		return runtime.GOOS
+	case whenArchVariable:
+		return runtime.GOARCH
+	case whenProfileVariable:
+		return c.Profile
+	case whenWatchVariable:
+		return strconv.FormatBool(c.IsInWatchMode())
+	}
+	if strings.HasPrefix(name, whenEnvPrefix) {
+		return os.Getenv(strings.TrimPrefix(name, whenEnvPrefix))
+	}
+	return c.Options.Variables[name]
+}
+
+// isWhenValueTrue converts a value of a "when" expression to a boolean.
+// Empty strings, "false" and "0" are false, other values are true.
+func isWhenValueTrue(value string) bool {
+	return value != "" && value != "false" && value != "0"
+}
+
+// whenBool converts a boolean to a value of a "when" expression.
+func whenBool(value bool) string {
+	return strconv.FormatBool(value)
+}
+
+// parseWhenExpression parses the "when" expression of a filter. The
+// expressions use the variables, the string literals in single or double
+// quotes, the "true" and "false" literals, the "==", "!=", "!", "&&" and "||"
+// operators and the parentheses, for example:
+// "release && os == 'windows' || !watch"
+func parseWhenExpression(expression string) (whenExpression, error) {
+	tokens, err := tokenizeWhenExpression(expression)
+	if err != nil {
+		return nil, PassError(err)
+	}
+	p := &whenParser{tokens: tokens}
+	result, err := p.parseOr()
+	if err != nil {
+		return nil, PassError(err)
+	}
+	if p.pos < len(p.tokens) {
+		return nil, WrappedErrorf(
+			"Unexpected token in the expression.\nToken: %s",
+			p.tokens[p.pos].text)
+	}
+	return result, nil
+}
+
+// whenTokenKind is the kind of a token of a "when" expression.
+type whenTokenKind int
+
+const (
+	whenOperatorToken whenTokenKind = iota
+	whenIdentifierToken
+	whenStringToken
+)
+
+// whenToken is a token of a "when" expression.
+type whenToken struct {
+	kind whenTokenKind
+	text string
+}
+
+// whenIdentifierPattern matches the names of the variables in the "when"
+// expressions, including the environment variables like "env.CI".
+var whenIdentifierPattern = regexp.MustCompile(
+	`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z0-9_]+)*`)
+
+// tokenizeWhenExpression splits a "when" expression into tokens.
+func tokenizeWhenExpression(expression string) ([]whenToken, error) {
+	result := []whenToken{}
+	text := expression
+	for {
+		text = strings.TrimLeft(text, " \t\r\n")
+		if text == "" {
+			return result, nil
+		}
+		switch {
+		case strings.HasPrefix(text, "=="), strings.HasPrefix(text, "!="),
+			strings.HasPrefix(text, "&&"), strings.HasPrefix(text, "||"):
+			result = append(result, whenToken{whenOperatorToken, text[:2]})
+			text = text[2:]
+		case text[0] == '!' || text[0] == '(' || text[0] == ')':
+			result = append(result, whenToken{whenOperatorToken, text[:1]})
+			text = text[1:]
+		case text[0] == '\'' || text[0] == '"':
+			end := strings.IndexByte(text[1:], text[0])
+			if end == -1 {
+				return nil, WrappedErrorf(
+					"Unclosed string in the expression.\nString: %s", text)
+			}
+			result = append(
+				result, whenToken{whenStringToken, text[1 : end+1]})
+			text = text[end+2:]
+		default:
+			identifier := whenIdentifierPattern.FindString(text)
+			if identifier == "" {
+				return nil, WrappedErrorf(
+					"Unexpected character in the expression.\nText: %s",
+					text)
+			}
+			result = append(
+				result, whenToken{whenIdentifierToken, identifier})
+			text = text[len(identifier):]
+		}
+	}
+}
+
+// whenParser is a recursive descent parser of the "when" expressions.
+type whenParser struct {
+	tokens []whenToken
+	pos    int
+}
+
+// acceptOperator moves to the next token if the current token is the
+// operator and returns true in that case.
+func (p *whenParser) acceptOperator(operator string) bool {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == whenOperatorToken &&
+		p.tokens[p.pos].text == operator {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// parseOr parses the expressions joined with the "||" operator.
+func (p *whenParser) parseOr() (whenExpression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, PassError(err)
+	}
+	for p.acceptOperator("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, PassError(err)
+		}
+		left = func(left, right whenExpression) whenExpression {
+			return func(context RunContext) string {
+				return whenBool(isWhenValueTrue(left(context)) ||
+					isWhenValueTrue(right(context)))
+			}
+		}(left, right)
+	}
+	return left, nil
+}
+
+// parseAnd parses the expressions joined with the "&&" operator.
+func (p *whenParser) parseAnd() (whenExpression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, PassError(err)
+	}
+	for p.acceptOperator("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, PassError(err)
+		}
+		left = func(left, right whenExpression) whenExpression {
+			return func(context RunContext) string {
+				return whenBool(isWhenValueTrue(left(context)) &&
+					isWhenValueTrue(right(context)))
+			}
+		}(left, right)
+	}
+	return left, nil
+}
+
+// parseUnary parses the expressions negated with the "!" operator.
+func (p *whenParser) parseUnary() (whenExpression, error) {
+	if p.acceptOperator("!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, PassError(err)
+		}
+		return func(context RunContext) string {
+			return whenBool(!isWhenValueTrue(operand(context)))
+		}, nil
+	}
+	return p.parseComparison()
+}
+
+// parseComparison parses the comparisons with the "==" and "!=" operators.
+func (p *whenParser) parseComparison() (whenExpression, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, PassError(err)
+	}
+	equal := p.acceptOperator("==")
+	if !equal && !p.acceptOperator("!=") {
+		return left, nil
+	}
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, PassError(err)
+	}
+	return func(context RunContext) string {
+		return whenBool((left(context) == right(context)) == equal)
+	}, nil
+}
+
+// parsePrimary parses the variables, the literals and the expressions in
+// parentheses.
+func (p *whenParser) parsePrimary() (whenExpression, error) {
+	if p.acceptOperator("(") {
+		result, err := p.parseOr()
+		if err != nil {
+			return nil, PassError(err)
+		}
+		if !p.acceptOperator(")") {
+			return nil, WrappedError(
+				"Missing closing parenthesis in the expression.")
+		}
+		return result, nil
+	}
+	if p.pos >= len(p.tokens) {
+		return nil, WrappedError("Unexpected end of the expression.")
+	}
+	token := p.tokens[p.pos]
+	switch token.kind {
+	case whenStringToken:
+		p.pos++
+		return func(RunContext) string { return token.text }, nil
+	case whenIdentifierToken:
+		p.pos++
+		if token.text == "true" || token.text == "false" {
+			return func(RunContext) string { return token.text }, nil
+		}
+		return func(context RunContext) string {
+			return context.whenVariable(token.text)
+		}, nil
+	}
+	return nil, WrappedErrorf(
+		"Unexpected token in the expression.\nToken: %s", token.text)
+}
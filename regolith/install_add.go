@@ -2,8 +2,8 @@
 package regolith
 
 import (
-	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"golang.org/x/mod/semver"
@@ -22,10 +22,13 @@ type parsedInstallFilterArg struct {
 
 // installFilters installs the filters from the list and their dependencies,
 // and copies their data to the data path. If the filter is already installed,
-// it returns an error unless the force flag is set.
+// it returns an error unless the force flag is set. The remote filters are
+// downloaded from the commits saved in the lock file if possible, and the
+// lock file is updated with the downloaded filters. In offline mode, the
+// remote filters are installed only from the lock file and the filter store.
 func installFilters(
-	filterDefinitions map[string]FilterInstaller, force bool,
-	dataPath, dotRegolithPath string,
+	filterDefinitions map[string]FilterInstaller, force, offline bool,
+	dataPath, dotRegolithPath string, lockfile *Lockfile,
 ) error {
 	joinedPath := filepath.Join(dotRegolithPath, "cache/filters")
 	err := CreateDirectoryIfNotExists(joinedPath, true)
@@ -39,12 +42,16 @@ func installFilters(
 	}
 
 	// Download all of the remote filters
+	resolver := newRemoteFilterResolver(
+		filterDefinitions, dotRegolithPath, lockfile)
+	resolver.force, resolver.offline = force, offline
+	resolver.dataPath = dataPath
 	resolverUpdated := false
 	for name, filterDefinition := range filterDefinitions {
 		Logger.Infof("Downloading %q filter...", name)
 		if remoteFilter, ok := filterDefinition.(*RemoteFilterDefinition); ok {
 			// Download resolver once if remote filter is found
-			if !resolverUpdated {
+			if !resolverUpdated && !offline {
 				err = DownloadResolverMap()
 				if err != nil {
 					Logger.Warn("Failed to download resolver map.")
@@ -52,16 +59,39 @@ func installFilters(
 				resolverUpdated = true
 			}
 			// Download the remote filter
-			err := remoteFilter.Download(force, dotRegolithPath)
+			remoteFilter = resolver.rootFilter(name, remoteFilter)
+			locked, _ := lockfile.lockedFilter(remoteFilter)
+			newLocked, err := remoteFilter.Download(
+				force, offline, dotRegolithPath, locked)
 			if err != nil {
 				return WrapErrorf(err, remoteFilterDownloadError, name)
 			}
+			if newLocked != nil {
+				lockfile.Filters[name] = *newLocked
+			} else if locked == nil {
+				Logger.Warnf(
+					"Filter %q is installed but it's not in %s. You can "+
+						"add it to the lock file by reinstalling the filter "+
+						"with the \"--force\" flag.", name, LockfilePath)
+			} else if len(locked.RequiredBy) > 0 {
+				// Used to be installed only for another remote filter
+				locked.RequiredBy = nil
+				lockfile.Filters[name] = *locked
+			}
 			// Copy the data of the remote filter to the data path
 			remoteFilter.CopyFilterData(dataPath, dotRegolithPath)
+			// Install the remote filters used by the filter
+			err = resolver.resolveNested(remoteFilter, []string{name})
+			if err != nil {
+				return WrapErrorf(
+					err, "Failed to install the remote filters used by the "+
+						"filter.\nFilter: %s", name)
+			}
 		}
 		// Install the dependencies of the filter
 		Logger.Infof("Installing %q filter dependencies...", name)
-		err = filterDefinition.InstallDependencies(nil, dotRegolithPath)
+		err = filterDefinition.InstallDependencies(
+			nil, dotRegolithPath, offline)
 		if err != nil {
 			return WrapErrorf(
 				err,
@@ -69,12 +99,18 @@ func installFilters(
 				name)
 		}
 	}
+	resolver.pruneLockfile()
 	return nil
 }
 
-// updateFilters updates the filters from the list.
+// updateFilters updates the filters from the list and saves their new
+// versions in the lock file. The filters with semver ranges are updated to
+// the highest version in the range, unless "major" is true. In that case,
+// the ranges that don't include the latest version of the filter are
+// changed to include it.
 func updateFilters(
 	remoteFilterDefinitions map[string]FilterInstaller, dotRegolithPath string,
+	lockfile *Lockfile, major bool,
 ) error {
 	joinedPath := filepath.Join(dotRegolithPath, "cache/filters")
 	err := CreateDirectoryIfNotExists(joinedPath, true)
@@ -86,6 +122,23 @@ func updateFilters(
 	if err != nil {
 		return WrapErrorf(err, osMkdirError, joinedPath)
 	}
+	if major {
+		for name, filterDefinition := range remoteFilterDefinitions {
+			remoteFilter, ok := filterDefinition.(*RemoteFilterDefinition)
+			if !ok || !isVersionRange(remoteFilter.Version) {
+				continue
+			}
+			_, err := remoteFilter.widenVersionRange()
+			if err != nil {
+				return WrapErrorf(
+					err, "Failed to find the latest version of the filter.\n"+
+						"Filter: %s", name)
+			}
+		}
+	}
+	resolver := newRemoteFilterResolver(
+		remoteFilterDefinitions, dotRegolithPath, lockfile)
+	resolver.update = true
 	resolverUpdated := false
 	// Download all of the remote filters
 	for name, filterDefinition := range remoteFilterDefinitions {
@@ -100,13 +153,36 @@ func updateFilters(
 				resolverUpdated = true
 			}
 			// Update the filter
-			err := remoteFilter.Update(dotRegolithPath)
+			remoteFilter = resolver.rootFilter(name, remoteFilter)
+			locked, err := remoteFilter.Update(dotRegolithPath)
+			if err != nil {
+				return WrapErrorf(
+					err, "Failed to update filter.\nFilter: %s", name)
+			}
+			if locked != nil {
+				lockfile.Filters[name] = *locked
+			} else if locked, ok := lockfile.Filters[name]; ok &&
+				locked.Url == remoteFilter.Url {
+				// The filter didn't change but the version in the config
+				// could be changed to a keyword that resolves to the
+				// same version (e.g. "1.0.0" -> "latest")
+				installedVersion, err := remoteFilter.InstalledVersion(
+					dotRegolithPath)
+				if err == nil &&
+					trimFilterPrefix(locked.Ref, name) == installedVersion {
+					locked.Version = remoteFilter.Version
+					lockfile.Filters[name] = locked
+				}
+			}
+			// Update the remote filters used by the filter
+			err = resolver.resolveNested(remoteFilter, []string{name})
 			if err != nil {
 				return WrapErrorf(
 					err, "Failed to update filter.\nFilter: %s", name)
 			}
 		}
 	}
+	resolver.pruneLockfile()
 	return nil
 }
 
@@ -200,6 +276,8 @@ func GetRemoteFilterDownloadRef(url, name, version string) (string, error) {
 		versionGetters = vg{GetLatestRemoteFilterTag}
 	} else if version == "HEAD" {
 		versionGetters = vg{GetHeadSha}
+	} else if isVersionRange(version) {
+		return GetMatchingRemoteFilterTag(url, name, version)
 	} else {
 		if semver.IsValid("v" + version) {
 			version = name + "-" + version
@@ -235,28 +313,26 @@ func GetLatestRemoteFilterTag(url, name string) (string, error) {
 // ListRemoteFilterTags returns the list tags of the remote filter specified by the
 // filter name and URL.
 func ListRemoteFilterTags(url, name string) ([]string, error) {
-	commandArgs := []string{"ls-remote", "--tags", "https://" + url}
-	output, err := exec.Command("git", commandArgs...).Output()
+	allTags, err := newFilterSource(url).tags()
 	if err != nil {
-		command := "git " + strings.Join(commandArgs, " ")
-		return nil, WrapErrorf(err, execCommandError, command)
+		return nil, PassError(err)
 	}
-	// Go line by line though the output
 	var tags []string
-	for _, line := range strings.Split(string(output), "\n") {
-		// The command returns SHA and the tag name. We only want the tag name.
-		if strings.Contains(line, "refs/tags/") {
-			tag := strings.Split(line, "refs/tags/")[1]
-			if !strings.HasPrefix(tag, name+"-") {
-				continue
-			}
-			strippedTag := tag[len(name)+1:]
-			if semver.IsValid("v" + strippedTag) {
-				tags = append(tags, tag)
-			}
+	for _, tag := range allTags {
+		if !strings.HasPrefix(tag, name+"-") {
+			continue
+		}
+		strippedTag := tag[len(name)+1:]
+		if semver.IsValid("v" + strippedTag) {
+			tags = append(tags, tag)
 		}
 	}
-	semver.Sort(tags)
+	// The tags must be sorted by their versions, without the name prefix
+	sort.SliceStable(tags, func(i, j int) bool {
+		return semver.Compare(
+			"v"+trimFilterPrefix(tags[i], name),
+			"v"+trimFilterPrefix(tags[j], name)) < 0
+	})
 	return tags, nil
 }
 
@@ -264,18 +340,38 @@ func ListRemoteFilterTags(url, name string) ([]string, error) {
 // filter URL. This function does not check whether the filter actually exists
 // in the repository.
 func GetHeadSha(url, name string) (string, error) {
-	commandArgs := []string{
-		"ls-remote", "--symref", "https://" + url, "HEAD"}
-	output, err := exec.Command("git", commandArgs...).Output()
+	sha, err := newFilterSource(url).headSha()
+	if err != nil {
+		return "", PassError(err)
+	}
+	return sha, nil
+}
+
+// GetRemoteFilterRefSha returns the SHA of the commit that the git reference
+// points to in the repository specified by the filter URL. The reference can
+// be a tag, a branch or a commit SHA.
+func GetRemoteFilterRefSha(url, ref string) (string, error) {
+	sha, err := newFilterSource(url).refSha(ref)
 	if err != nil {
-		return "", WrapErrorf(err, execCommandError, name)
+		return "", PassError(err)
 	}
-	// The result is on the second line.
-	lines := strings.Split(string(output), "\n")
-	sha := strings.Split(lines[1], "\t")[0]
 	return sha, nil
 }
 
+// isCommitSha returns true if the string looks like a SHA-1 of a git commit
+// (full or abbreviated).
+func isCommitSha(ref string) bool {
+	if len(ref) < 7 || len(ref) > 40 {
+		return false
+	}
+	for _, c := range ref {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
 // trimFilterPrefix removes the prefix of the filter name from versionTag if
 // versionTag follows the pattern <filterName>-<version>, otherwise it returns
 // the same string.
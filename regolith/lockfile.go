@@ -0,0 +1,241 @@
+package regolith
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LockfilePath is the path to the lock file of the remote filters, relative
+// to the root of the project.
+const LockfilePath = "regolith.lock"
+
+// lockfileHashPrefix is the prefix of the hashes of the filter files saved in
+// the lock file. It identifies the hashing algorithm.
+const lockfileHashPrefix = "sha256:"
+
+// Lockfile is the content of the regolith.lock file. It records the exact
+// versions of the remote filters, so they can be reinstalled on other
+// machines, and the hashes of their files, so the changes in the installed
+// filters can be detected.
+type Lockfile struct {
+	Filters map[string]LockedFilter `json:"filters"`
+}
+
+// LockedFilter is an entry of the lock file for a single remote filter.
+type LockedFilter struct {
+	// Url is the URL of the repository of the filter
+	Url string `json:"url"`
+
+	// Version is the version of the filter from the config file, which can
+	// be a keyword like "latest" or "HEAD"
+	Version string `json:"version"`
+
+	// Ref is the git reference resolved from the version (a tag or a
+	// commit SHA)
+	Ref string `json:"ref"`
+
+	// Sha is the SHA of the commit of the filter
+	Sha string `json:"sha"`
+
+	// Hash is the hash of the files of the downloaded filter
+	Hash string `json:"hash"`
+
+	// RequiredBy is the list of the names of the remote filters that lead
+	// to this filter, if it's used by another remote filter instead of
+	// being defined in the config file. It starts with the filter from the
+	// config file and ends with the filter that uses this filter directly.
+	RequiredBy []string `json:"requiredBy,omitempty"`
+}
+
+// LoadLockfile loads the lock file from the root of the project. If the file
+// doesn't exist, it returns an empty lock file.
+func LoadLockfile() (*Lockfile, error) {
+	return loadLockfile(LockfilePath)
+}
+
+// loadLockfile loads the lock file from the path. If the file doesn't exist,
+// it returns an empty lock file.
+func loadLockfile(path string) (*Lockfile, error) {
+	result := &Lockfile{Filters: map[string]LockedFilter{}}
+	file, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, WrapErrorf(err, fileReadError, path)
+	}
+	err = json.Unmarshal(file, result)
+	if err != nil {
+		return nil, WrapErrorf(err, jsonUnmarshalError, path)
+	}
+	if result.Filters == nil {
+		result.Filters = map[string]LockedFilter{}
+	}
+	return result, nil
+}
+
+// Save saves the lock file in the root of the project.
+func (l *Lockfile) Save() error {
+	lockfileJson, _ := json.MarshalIndent(l, "", "  ") // no error
+	err := ioutil.WriteFile(
+		LockfilePath, append(lockfileJson, '\n'), 0644)
+	if err != nil {
+		return WrapErrorf(err, fileWriteError, LockfilePath)
+	}
+	return nil
+}
+
+// lockedFilter returns the entry of the lock file for the filter definition.
+// The entry is returned only if it has the same URL and version as the
+// definition, otherwise it's outdated. If the version of the definition is
+// a semver range, the entry of any version that satisfies it is returned.
+func (l *Lockfile) lockedFilter(
+	definition *RemoteFilterDefinition,
+) (*LockedFilter, bool) {
+	locked, ok := l.Filters[definition.Id]
+	if !ok || locked.Url != definition.Url {
+		return nil, false
+	}
+	// The locked version can be narrowed down from the range, if the
+	// filter is required by multiple filters
+	if locked.Version != definition.Version && !(isVersionRange(
+		definition.Version) && versionRangeMatches(
+		definition.Version, trimFilterPrefix(locked.Ref, definition.Id))) {
+		return nil, false
+	}
+	return &locked, true
+}
+
+// prune removes the entries of the filters that are not on the list of the
+// filter definitions. The entries of the filters used by other remote
+// filters are kept if the filter from the config file that uses them is on
+// the list.
+func (l *Lockfile) prune(filterDefinitions map[string]FilterInstaller) {
+	for name, locked := range l.Filters {
+		root := name
+		if len(locked.RequiredBy) > 0 {
+			root = locked.RequiredBy[0]
+		}
+		if _, ok := filterDefinitions[root].(*RemoteFilterDefinition); !ok {
+			delete(l.Filters, name)
+		}
+	}
+}
+
+// isGeneratedFilterPath returns true if the path inside of the directory of
+// a filter is created by installing the dependencies or by running the filter
+// and shouldn't be a part of the hash of the filter.
+func isGeneratedFilterPath(path string, d fs.DirEntry) bool {
+	if d.IsDir() {
+		return d.Name() == "node_modules" || d.Name() == "__pycache__"
+	}
+	// Nim filters are compiled to executables next to their scripts
+	ext := filepath.Ext(path)
+	if ext == exeSuffix {
+		nimScript := strings.TrimSuffix(path, ext) + ".nim"
+		if _, err := os.Stat(nimScript); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// hashFilterFiles returns the hash of the files of a downloaded filter. The
+// hash includes the paths and the contents of the files, but it skips the
+// files generated when the filter is installed or executed.
+func hashFilterFiles(filterPath string) (string, error) {
+	lines := []string{}
+	err := filepath.WalkDir(
+		filterPath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path == filterPath {
+				return nil
+			}
+			if isGeneratedFilterPath(path, d) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			relPath, err := filepath.Rel(filterPath, path)
+			if err != nil {
+				return WrapErrorf(err, filepathRelError, filterPath, path)
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return WrapErrorf(err, fileReadError, path)
+			}
+			lines = append(lines, fmt.Sprintf(
+				"%s %s", hashBytes(data), filepath.ToSlash(relPath)))
+			return nil
+		})
+	if err != nil {
+		return "", WrapErrorf(
+			err, "Failed to hash the files of the filter.\nPath: %s",
+			filterPath)
+	}
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return lockfileHashPrefix + hex.EncodeToString(sum[:]), nil
+}
+
+// checkLock compares the files of the installed filter with the hash saved
+// in the lock file. It returns an error if the files were modified after
+// the installation. Filters that aren't in the lock file are not checked.
+func (f *RemoteFilterDefinition) checkLock(dotRegolithPath string) error {
+	downloadPath := f.GetDownloadPath(dotRegolithPath)
+	if _, err := os.Stat(downloadPath); err != nil {
+		return nil // Not installed, reported by other checks
+	}
+	lockfile, err := LoadLockfile()
+	if err != nil {
+		return WrapError(err, "Failed to load the lock file.")
+	}
+	locked, ok := lockfile.lockedFilter(f)
+	if !ok {
+		if _, ok := lockfile.Filters[f.Id]; ok {
+			Logger.Warnf(
+				"The version of the filter in %s doesn't match the config "+
+					"file. The files of the filter are not checked.\n"+
+					"Filter: %s\n"+
+					"You can update the lock file by reinstalling the "+
+					"filter:\nregolith install-all --force",
+				LockfilePath, f.Id)
+		} else {
+			Logger.Debugf(
+				"Filter %q is not in %s, skipping the hash check.",
+				f.Id, LockfilePath)
+		}
+		return nil
+	}
+	hash, err := hashFilterFiles(downloadPath)
+	if err != nil {
+		return PassError(err)
+	}
+	if hash != locked.Hash {
+		return WrappedErrorf(
+			"The files of the filter were modified after the installation "+
+				"and don't match the hash from %s.\n"+
+				"Filter: %s\n"+
+				"Path: %s\n"+
+				"Expected hash: %s\n"+
+				"Actual hash: %s\n"+
+				"You can reinstall the filter using command:\n"+
+				"regolith install-all --force",
+			LockfilePath, f.Id, downloadPath, locked.Hash, hash)
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/fatih/color"
@@ -13,9 +14,44 @@ import (
 
 var printStackTraces = true
 
+// The output formats that can be selected with SetOutputFormat
+const (
+	// TextOutputFormat is the default, human-readable output format
+	TextOutputFormat = "text"
+
+	// JsonOutputFormat prints every message as a JSON object in a separate
+	// line (newline-delimited JSON). It's meant for the tools that
+	// integrate with Regolith.
+	JsonOutputFormat = "json"
+)
+
+// outputFormat is the output format used by the Logger
+var outputFormat = TextOutputFormat
+
+// SetOutputFormat sets the output format of the Logger. It must be called
+// before InitLogging.
+func SetOutputFormat(format string) error {
+	switch format {
+	case TextOutputFormat, JsonOutputFormat:
+		outputFormat = format
+		return nil
+	}
+	return WrappedErrorf(
+		"Invalid output format.\nFormat: %s\nValid formats: %s, %s",
+		format, TextOutputFormat, JsonOutputFormat)
+}
+
+// IsJsonOutput returns true if Regolith prints its output as JSON.
+func IsJsonOutput() bool {
+	return outputFormat == JsonOutputFormat
+}
+
 var Logger *zap.SugaredLogger
 var LoggerLevel zap.AtomicLevel
 
+// registerColorSink registers the "color" sink used by the Logger
+var registerColorSink sync.Once
+
 type colorWriter struct {
 	io.Writer
 }
@@ -32,19 +68,27 @@ func InitLogging(dev bool) {
 		return
 	}
 	printStackTraces = dev // Our custom stack traces
-	err := zap.RegisterSink("color", func(url *url.URL) (zap.Sink, error) {
-		if url.Host == "stderr" {
+	// The sink can be registered only once, but the Logger can be
+	// initialized again after resetting it
+	registerColorSink.Do(func() {
+		err := zap.RegisterSink("color", func(url *url.URL) (zap.Sink, error) {
+			if url.Host == "stderr" {
+				return colorWriter{color.Output}, nil
+			}
 			return colorWriter{color.Output}, nil
+		})
+		if err != nil {
+			fmt.Printf("%s", err.Error())
 		}
-		return colorWriter{color.Output}, nil
 	})
-	if err != nil {
-		fmt.Printf("%s", err.Error())
-	}
 	LoggerLevel = zap.NewAtomicLevelAt(zap.InfoLevel)
 	if dev {
 		LoggerLevel.SetLevel(zap.DebugLevel)
 	}
+	if IsJsonOutput() {
+		initJsonLogging(dev)
+		return
+	}
 	logger, _ := zap.Config{
 		Development:       dev,
 		Level:             LoggerLevel,
@@ -96,3 +140,34 @@ func InitLogging(dev bool) {
 	defer logger.Sync() // flushes buffer, if any
 	Logger = logger.Sugar()
 }
+
+// initJsonLogging initializes the Logger for the JSON output format. Every
+// message is printed as a JSON object in a separate line.
+func initJsonLogging(dev bool) {
+	// The colors would break the JSON strings
+	color.NoColor = true
+	logger, _ := zap.Config{
+		Development:       dev,
+		Level:             LoggerLevel,
+		Encoding:          "json",
+		OutputPaths:       []string{"stdout"},
+		ErrorOutputPaths:  []string{"stderr"},
+		DisableStacktrace: true,
+		DisableCaller:     true,
+		EncoderConfig: zapcore.EncoderConfig{
+			TimeKey:        "time",
+			LevelKey:       "level",
+			MessageKey:     "msg",
+			NameKey:        zapcore.OmitKey,
+			CallerKey:      zapcore.OmitKey,
+			FunctionKey:    zapcore.OmitKey,
+			StacktraceKey:  zapcore.OmitKey,
+			LineEnding:     zapcore.DefaultLineEnding,
+			EncodeLevel:    zapcore.LowercaseLevelEncoder,
+			EncodeTime:     zapcore.ISO8601TimeEncoder,
+			EncodeDuration: zapcore.MillisDurationEncoder,
+		},
+	}.Build()
+	defer logger.Sync() // flushes buffer, if any
+	Logger = logger.Sugar()
+}
@@ -2,9 +2,12 @@ package regolith
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+
+	"go.uber.org/zap/zapcore"
 )
 
 // Install handles the "regolith install" command. It installs specific filters
@@ -36,12 +39,22 @@ func Install(filters []string, force, debug bool) error {
 	if err != nil {
 		return WrapError(err, "Failed to parse arguments.")
 	}
-	config, err := LoadConfigAsMap()
+	// The new filters are saved to the config file, so it's modified without
+	// merging the local config and replacing the placeholders
+	config, err := loadConfigFileAsMap()
 	if err != nil {
 		return WrapError(err, "Unable to load config file.")
 	}
+	localConfig, err := LoadConfigAsMap()
+	if err != nil {
+		return WrapError(err, "Unable to load config file.")
+	}
+	localConfig, problems := interpolateConfig(localConfig)
+	if len(problems) > 0 {
+		return WrapError(problems[0].Err, "Unable to load config file.")
+	}
 	// Get parts of config file required for installation
-	dataPath, err := dataPathFromConfigMap(config)
+	dataPath, err := dataPathFromConfigMap(localConfig)
 	if err != nil {
 		return WrapError(err, "Failed to get data path from config file.")
 	}
@@ -51,7 +64,7 @@ func Install(filters []string, force, debug bool) error {
 			err,
 			"Failed to get the list of filter definitions from config file.")
 	}
-	useAppData, err := useAppDataFromConfigMap(config)
+	useAppData, err := useAppDataFromConfigMap(localConfig)
 	if err != nil {
 		return WrapError(
 			err, "Failed to get the value of useAppData property from the "+
@@ -101,7 +114,15 @@ func Install(filters []string, force, debug bool) error {
 			err, "Unable to get the path to regolith cache folder.")
 	}
 	// Download the filter definitions
-	err = installFilters(filterInstallers, force, dataPath, dotRegolithPath)
+	lockfile, err := LoadLockfile()
+	if err != nil {
+		return WrapError(err, "Failed to load the lock file.")
+	}
+	err = installFilters(
+		filterInstallers, force, false, dataPath, dotRegolithPath, lockfile)
+	if err1 := lockfile.Save(); err1 != nil && err == nil {
+		err = err1
+	}
 	if err != nil {
 		return WrapError(err, "Failed to install filters.")
 	}
@@ -132,12 +153,16 @@ func Install(filters []string, force, debug bool) error {
 // The "force" parameter is a boolean that determines if the installation
 // should be forced even if the filter is already installed.
 //
+// The "offline" parameter is a boolean that determines if the filters should
+// be installed without accessing the network, using only the versions from
+// the lock file and the files from the filter store.
+//
 // The "debug" parameter is a boolean that determines if the debug messages
 // should be printed.
-func InstallAll(force, debug bool) error {
+func InstallAll(force, offline, debug bool) error {
 	InitLogging(debug)
 	Logger.Info("Installing filters...")
-	if !hasGit() {
+	if !hasGit() && !offline {
 		Logger.Warn(gitNotInstalledWarning)
 	}
 	configMap, err1 := LoadConfigAsMap()
@@ -152,8 +177,17 @@ func InstallAll(force, debug bool) error {
 		return WrapError(
 			err, "Unable to get the path to regolith cache folder.")
 	}
+	lockfile, err := LoadLockfile()
+	if err != nil {
+		return WrapError(err, "Failed to load the lock file.")
+	}
+	lockfile.prune(config.FilterDefinitions)
 	err = installFilters(
-		config.FilterDefinitions, force, config.DataPath, dotRegolithPath)
+		config.FilterDefinitions, force, offline, config.DataPath,
+		dotRegolithPath, lockfile)
+	if err1 := lockfile.Save(); err1 != nil && err == nil {
+		err = err1
+	}
 	if err != nil {
 		return WrapError(err, "Could not install filters.")
 	}
@@ -201,7 +235,14 @@ func Update(filters []string, debug bool) error {
 			err, "Unable to get the path to regolith cache folder.")
 	}
 	// Update the filters from the list
-	err = updateFilters(filterInstallers, dotRegolithPath)
+	lockfile, err := LoadLockfile()
+	if err != nil {
+		return WrapError(err, "Failed to load the lock file.")
+	}
+	err = updateFilters(filterInstallers, dotRegolithPath, lockfile, false)
+	if err1 := lockfile.Save(); err1 != nil && err == nil {
+		err = err1
+	}
 	if err != nil {
 		return WrapError(err, "Could not update filters.")
 	}
@@ -211,11 +252,16 @@ func Update(filters []string, debug bool) error {
 
 // UpdateAll handles the "regolith update-all" command. It updates all of the
 // filters from the filtersDefinitions list in the config.json file which
-// aren't version locked.
+// aren't version locked. The filters with semver ranges are updated within
+// their ranges.
+//
+// The "major" parameter allows updating the filters with semver ranges to
+// the versions outside of their ranges. The new ranges are saved in the
+// config file.
 //
 // The "debug" parameter is a boolean that determines if the debug messages
 // should be printed.
-func UpdateAll(debug bool) error {
+func UpdateAll(major, debug bool) error {
 	InitLogging(debug)
 	Logger.Info("Updating filters...")
 	if !hasGit() {
@@ -233,19 +279,132 @@ func UpdateAll(debug bool) error {
 		return WrapError(
 			err, "Unable to get the path to regolith cache folder.")
 	}
-	err = updateFilters(config.FilterDefinitions, dotRegolithPath)
+	lockfile, err := LoadLockfile()
+	if err != nil {
+		return WrapError(err, "Failed to load the lock file.")
+	}
+	lockfile.prune(config.FilterDefinitions)
+	err = updateFilters(
+		config.FilterDefinitions, dotRegolithPath, lockfile, major)
+	if err1 := lockfile.Save(); err1 != nil && err == nil {
+		err = err1
+	}
 	if err != nil {
 		return WrapError(err, "Could not install filters.")
 	}
+	if major {
+		err = saveWidenedVersionRanges(config.FilterDefinitions)
+		if err != nil {
+			return WrapError(
+				err, "Successfully updated the filters but failed to save "+
+					"their new version ranges in the config file.")
+		}
+	}
 	Logger.Info("Successfully installed the filters.")
 	return nil
 }
 
+// Outdated handles the "regolith outdated" command. It prints the installed,
+// pinned, latest and HEAD versions of the remote filters from the
+// filtersDefinitions list in the config.json file, without downloading
+// them. It returns an error if updates are available for any of the
+// filters.
+//
+// The "debug" parameter is a boolean that determines if the debug messages
+// should be printed.
+func Outdated(debug bool) error {
+	InitLogging(debug)
+	if !hasGit() {
+		Logger.Warn(gitNotInstalledWarning)
+	}
+	configMap, err1 := LoadConfigAsMap()
+	config, err2 := ConfigFromObject(configMap)
+	if err := firstErr(err1, err2); err != nil {
+		return WrapError(err, "Failed to load config.json.")
+	}
+	dotRegolithPath, err := GetDotRegolith(
+		config.RegolithProject.UseAppData, true, ".")
+	if err != nil {
+		return WrapError(
+			err, "Unable to get the path to regolith cache folder.")
+	}
+	filters, err := checkOutdatedFilters(
+		config.FilterDefinitions, dotRegolithPath)
+	if err != nil {
+		return PassError(err)
+	}
+	outdated := 0
+	for _, filter := range filters {
+		if filter.Outdated {
+			outdated++
+		}
+	}
+	if IsJsonOutput() {
+		for _, f := range filters {
+			Logger.Infow(
+				fmt.Sprintf("Filter %q: %s", f.Name, f.status()),
+				"event", filterVersionsEvent, "filter", f.Name,
+				"url", f.Url, "pinned", f.Pinned, "installed", f.Installed,
+				"latest", f.Latest, "head", f.Head, "outdated", f.Outdated)
+		}
+	} else if len(filters) > 0 {
+		printOutdatedTable(os.Stdout, filters)
+	}
+	if outdated > 0 {
+		return WrappedErrorf(
+			"Updates are available for %d filter(s).\n"+
+				"You can update the filters using command:\n"+
+				"regolith update-all", outdated)
+	}
+	Logger.Info("No updates are available for the remote filters.")
+	return nil
+}
+
+// RunOptions are the options of the 'regolith run' and 'regolith watch'
+// commands that change how the profile is executed.
+type RunOptions struct {
+	// ManifestVersion is the version applied to the manifests of the packs.
+	// It overrides the "manifest->version" property of the profile.
+	ManifestVersion string
+
+	// Variables are the variables of the "when" expressions of the filters,
+	// set with the "-v name=value" flags
+	Variables map[string]string
+
+	// Filters are the names of the filters of the profile that should run.
+	// If it's empty, all of the filters run.
+	Filters []string
+
+	// From is the name of the filter of the profile from which the
+	// execution starts. The filters before it are skipped.
+	From string
+
+	// Until is the name of the filter of the profile after which the
+	// execution stops. The filters after it are skipped.
+	Until string
+
+	// SaveSnapshots saves a copy of the tmp directory after every filter of
+	// the profile, so it can be reused with the ReuseSnapshot option
+	SaveSnapshots bool
+
+	// ReuseSnapshot restores the tmp directory from the snapshot saved
+	// before the first filter that runs, instead of copying the source
+	// files
+	ReuseSnapshot bool
+
+	// Trace saves the state of the tmp directory after every filter of the
+	// profile, so the changes of the filters can be inspected with the
+	// "regolith trace" command
+	Trace bool
+}
+
 // runOrWatch handles both 'regolith run' and 'regolith watch' commands based
 // on the 'watch' parameter. It runs/watches the profile named after
 // 'profileName' parameter. The 'debug' argument determines if the debug
 // messages should be printed or not.
-func runOrWatch(profileName string, recycled, debug, watch bool) error {
+func runOrWatch(
+	profileName string, recycled, debug, watch bool, options RunOptions,
+) error {
 	InitLogging(debug)
 	// Select the run profile function based on the recycled flag
 	rp := RunProfile
@@ -269,6 +428,26 @@ func runOrWatch(profileName string, recycled, debug, watch bool) error {
 		return WrappedErrorf(
 			"Profile %q does not exist in the configuration.", profileName)
 	}
+	if options.ManifestVersion != "" &&
+		options.ManifestVersion != gitTagManifestVersion {
+		_, err := parseManifestVersion(options.ManifestVersion)
+		if err != nil {
+			return WrapError(err, "Invalid manifest version.")
+		}
+	}
+	if _, err := selectFilters(profile, options); err != nil {
+		return WrapError(err, "Invalid filter selection.")
+	}
+	if profile.Parallel && (options.SaveSnapshots || options.ReuseSnapshot) {
+		return WrappedErrorf(
+			"The snapshots can't be used with the profiles that run their "+
+				"filters in parallel.\nProfile: %s", profileName)
+	}
+	if profile.Parallel && options.Trace {
+		return WrappedErrorf(
+			"The trace can't be used with the profiles that run their "+
+				"filters in parallel.\nProfile: %s", profileName)
+	}
 	// Get dotRegolithPath
 	dotRegolithPath, err := GetDotRegolith(
 		config.RegolithProject.UseAppData, false, ".")
@@ -281,6 +460,10 @@ func runOrWatch(profileName string, recycled, debug, watch bool) error {
 	if err != nil {
 		return err
 	}
+	logEvent(
+		zapcore.DebugLevel, runStartedEvent,
+		fmt.Sprintf("Running profile %q.", profileName),
+		"profile", profileName, "watch", watch)
 	path, _ := filepath.Abs(".")
 	context := RunContext{
 		AbsoluteLocation: path,
@@ -288,11 +471,21 @@ func runOrWatch(profileName string, recycled, debug, watch bool) error {
 		Parent:           nil,
 		Profile:          profileName,
 		DotRegolithPath:  dotRegolithPath,
+		Options:          options,
 	}
+	stopHandlingSignal := context.handleInterruptSignal()
+	defer stopHandlingSignal()
 	if watch { // Loop until program termination (CTRL+C)
-		context.StartWatchingSrouceFiles()
+		err = context.StartWatchingSrouceFiles()
+		if err != nil {
+			return WrapError(err, "Failed to start watching the source files.")
+		}
 		for {
 			err = rp(context)
+			if context.isStopped() {
+				Logger.Info("Stopped watching.")
+				return nil
+			}
 			if err != nil {
 				Logger.Errorf(
 					"Failed to run profile %q: %s",
@@ -302,11 +495,18 @@ func runOrWatch(profileName string, recycled, debug, watch bool) error {
 			}
 			Logger.Info("Press Ctrl+C to stop watching.")
 			context.AwaitInterruption()
+			if context.isStopped() {
+				Logger.Info("Stopped watching.")
+				return nil
+			}
 			Logger.Warn("Restarting...")
 		}
 		// return nil // Unreachable code
 	}
 	err = rp(context)
+	if context.isStopped() {
+		return WrappedErrorf("Stopped running profile %q.", profileName)
+	}
 	if err != nil {
 		return WrapErrorf(err, "Failed to run profile %q", profileName)
 	}
@@ -317,14 +517,275 @@ func runOrWatch(profileName string, recycled, debug, watch bool) error {
 // Run handles the "regolith run" command. It runs selected profile and exports
 // created resource pack and behvaiour pack to the target destination.
 func Run(profileName string, recycled, debug bool) error {
-	return runOrWatch(profileName, recycled, debug, false)
+	return runOrWatch(profileName, recycled, debug, false, RunOptions{})
+}
+
+// RunWithOptions is the same as Run, but it allows to change the options of
+// the execution of the profile.
+func RunWithOptions(
+	profileName string, recycled, debug bool, options RunOptions,
+) error {
+	return runOrWatch(profileName, recycled, debug, false, options)
 }
 
 // Watch handles the "regolith watch" command. It watches the project
 // directories and it runs selected profile and exports created resource pack
 // and behvaiour pack to the target destination when the project changes.
 func Watch(profileName string, recycled, debug bool) error {
-	return runOrWatch(profileName, recycled, debug, true)
+	return runOrWatch(profileName, recycled, debug, true, RunOptions{})
+}
+
+// WatchWithOptions is the same as Watch, but it allows to change the options
+// of the execution of the profile.
+func WatchWithOptions(
+	profileName string, recycled, debug bool, options RunOptions,
+) error {
+	return runOrWatch(profileName, recycled, debug, true, options)
+}
+
+// Validate handles the "regolith validate" command. It checks the config
+// file and prints all of the problems found in it. It returns an error if
+// there are any problems.
+//
+// The "debug" parameter is a boolean that determines if the debug messages
+// should be printed.
+func Validate(debug bool) error {
+	InitLogging(debug)
+	configJson, err := LoadConfigAsMap()
+	if err != nil {
+		return WrapError(err, "Could not load \"config.json\".")
+	}
+	problems := ValidateConfig(configJson)
+	for _, problem := range problems {
+		if IsJsonOutput() {
+			chain := ErrorChain(problem.Err)
+			Logger.Errorw(
+				chain[0], "event", configProblemEvent,
+				"jsonPath", problem.JsonPath, "chain", chain)
+			continue
+		}
+		Logger.Errorf(
+			"JSON path: %s\n%s", problem.JsonPath, problem.Err.Error())
+	}
+	if len(problems) > 0 {
+		return WrappedErrorf(
+			"Found %d problem(s) in %q.", len(problems), ConfigFilePath)
+	}
+	Logger.Infof("No problems found in %q.", ConfigFilePath)
+	return nil
+}
+
+// ConfigShow handles the "regolith config show" command. It prints the
+// effective configuration of the profile in the JSON format, with the
+// "extends" property resolved.
+//
+// The "debug" parameter is a boolean that determines if the debug messages
+// should be printed.
+func ConfigShow(profileName string, debug bool) error {
+	InitLogging(debug)
+	if profileName == "" {
+		profileName = "default"
+	}
+	configJson, err := LoadConfigAsMap()
+	if err != nil {
+		return WrapError(err, "Could not load \"config.json\".")
+	}
+	// Make sure that the whole config is valid
+	config, err := ConfigFromObject(configJson)
+	if err != nil {
+		return WrapError(err, "Could not load \"config.json\".")
+	}
+	if _, ok := config.Profiles[profileName]; !ok {
+		return WrappedErrorf(
+			"Profile %q does not exist in the configuration.", profileName)
+	}
+	// ConfigFromObject already checked the types and the placeholders
+	configJson, _ = interpolateConfig(configJson)
+	regolith := configJson["regolith"].(map[string]interface{})
+	profiles := regolith["profiles"].(map[string]interface{})
+	profile, err := resolveProfile(profileName, profiles)
+	if err != nil {
+		return PassError(err)
+	}
+	if IsJsonOutput() {
+		Logger.Infow(
+			fmt.Sprintf("Profile %s", profileName),
+			"event", configProfileEvent, "profile", profileName,
+			"config", profile)
+		return nil
+	}
+	profileJson, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return WrapErrorf(
+			err, "Failed to encode the profile.\nProfile: %s", profileName)
+	}
+	fmt.Println(string(profileJson))
+	return nil
+}
+
+// projectDotRegolithPath returns the path to the .regolith directory of the
+// project in the current directory.
+func projectDotRegolithPath() (string, error) {
+	configMap, err := LoadConfigAsMap()
+	if err != nil {
+		return "", WrapError(err, "Could not load \"config.json\".")
+	}
+	useAppData, err := useAppDataFromConfigMap(configMap)
+	if err != nil {
+		return "", WrapError(
+			err, "Failed to get the value of useAppData property from the "+
+				"config file.",
+		)
+	}
+	dotRegolithPath, err := GetDotRegolith(useAppData, false, ".")
+	if err != nil {
+		return "", WrapError(
+			err, "Unable to get the path to regolith cache folder.")
+	}
+	return dotRegolithPath, nil
+}
+
+// Trace handles the "regolith trace" command. It prints the stages of the
+// trace saved by the last run with the "--trace" flag.
+//
+// The "debug" parameter is a boolean that determines if the debug messages
+// should be printed.
+func Trace(debug bool) error {
+	InitLogging(debug)
+	dotRegolithPath, err := projectDotRegolithPath()
+	if err != nil {
+		return PassError(err)
+	}
+	info, err := loadTraceInfo(dotRegolithPath)
+	if err != nil {
+		return PassError(err)
+	}
+	if IsJsonOutput() {
+		for i, stage := range info.Stages {
+			Logger.Infow(
+				fmt.Sprintf("Stage %s", info.stageName(i)),
+				"event", traceStageEvent, "profile", info.Profile,
+				"stage", i, "name", stage.Name, "filter", stage.Filter)
+		}
+		return nil
+	}
+	fmt.Printf("Profile: %s\n", info.Profile)
+	for i := range info.Stages {
+		fmt.Println(info.stageName(i))
+	}
+	return nil
+}
+
+// TraceFile handles the "regolith trace file" command. It prints the stages
+// of the trace that created, modified or deleted the file. The path of the
+// file is relative to the tmp directory, for example "BP/manifest.json".
+//
+// The "debug" parameter is a boolean that determines if the debug messages
+// should be printed.
+func TraceFile(path string, debug bool) error {
+	InitLogging(debug)
+	if path == "" {
+		return WrappedError("The path of the file is required.")
+	}
+	dotRegolithPath, err := projectDotRegolithPath()
+	if err != nil {
+		return PassError(err)
+	}
+	info, err := loadTraceInfo(dotRegolithPath)
+	if err != nil {
+		return PassError(err)
+	}
+	history, err := traceFileHistory(
+		info, dotRegolithPath, filepath.FromSlash(path))
+	if err != nil {
+		return WrapErrorf(
+			err, "Failed to get the history of the file.\nFile: %s", path)
+	}
+	if len(history) == 0 {
+		if IsJsonOutput() {
+			Logger.Infof("The file doesn't exist in any stage: %s", path)
+		} else {
+			fmt.Printf("The file doesn't exist in any stage: %s\n", path)
+		}
+		return nil
+	}
+	for _, entry := range history {
+		if IsJsonOutput() {
+			Logger.Infow(
+				entry.description(info),
+				"event", traceFileHistoryEvent, "file", path,
+				"stage", entry.stage, "name", info.Stages[entry.stage].Name,
+				"change", string(entry.change))
+		} else {
+			fmt.Println(entry.description(info))
+		}
+	}
+	return nil
+}
+
+// TraceDiff handles the "regolith trace diff" command. It prints the files
+// changed between two stages of the trace, or the differences of the file
+// if the path isn't empty. The stages are identified by their indices or by
+// the names of their filters.
+//
+// The "debug" parameter is a boolean that determines if the debug messages
+// should be printed.
+func TraceDiff(from, to, path string, debug bool) error {
+	InitLogging(debug)
+	if from == "" || to == "" {
+		return WrappedError("Two stages are required.")
+	}
+	dotRegolithPath, err := projectDotRegolithPath()
+	if err != nil {
+		return PassError(err)
+	}
+	info, err := loadTraceInfo(dotRegolithPath)
+	if err != nil {
+		return PassError(err)
+	}
+	fromStage, err := info.findStage(from)
+	if err != nil {
+		return PassError(err)
+	}
+	toStage, err := info.findStage(to)
+	if err != nil {
+		return PassError(err)
+	}
+	fromPath := info.stagePath(dotRegolithPath, fromStage)
+	toPath := info.stagePath(dotRegolithPath, toStage)
+	if path != "" {
+		diff, err := diffFiles(
+			filepath.Join(fromPath, filepath.FromSlash(path)),
+			filepath.Join(toPath, filepath.FromSlash(path)))
+		if err != nil {
+			return WrapErrorf(
+				err, "Failed to compare the file.\nFile: %s", path)
+		}
+		if IsJsonOutput() {
+			Logger.Infow(
+				fmt.Sprintf("Differences of the file: %s", path),
+				"event", traceDiffEvent, "from", fromStage, "to", toStage,
+				"path", path, "diff", diff)
+		} else {
+			fmt.Print(diff)
+		}
+		return nil
+	}
+	paths, changes, err := compareStages(fromPath, toPath)
+	if err != nil {
+		return WrapError(err, "Failed to compare the stages.")
+	}
+	for _, path := range paths {
+		if IsJsonOutput() {
+			Logger.Infow(
+				fmt.Sprintf("%s: %s", changes[path], path),
+				"event", traceChangeEvent, "from", fromStage, "to", toStage,
+				"path", filepath.ToSlash(path), "change", string(changes[path]))
+		} else {
+			fmt.Printf("%s: %s\n", changes[path], path)
+		}
+	}
+	return nil
 }
 
 // Init handles the "regolith init" command. It initializes a new Regolith
@@ -367,10 +828,10 @@ func Init(debug bool) error {
 					FilterCollection: FilterCollection{
 						Filters: []FilterRunner{},
 					},
-					ExportTarget: ExportTarget{
+					ExportTargets: ExportTargets{{
 						Target:   "development",
 						ReadOnly: false,
-					},
+					}},
 				},
 			},
 		},
@@ -513,6 +974,37 @@ func Clean(debug, userCache, cachedStatesOnly bool) error {
 	}
 }
 
+// CachePrune handles the "regolith cache prune" command. It removes the
+// filters from the filter store shared by the projects, that aren't used by
+// any of the projects. The filters are used if they're in the lock files of
+// the projects that installed them.
+//
+// The "debug" parameter is a boolean that determines if the debug messages
+// should be printed.
+func CachePrune(debug bool) error {
+	InitLogging(debug)
+	store, err := openFilterStore()
+	if err != nil {
+		return WrapError(err, "Failed to open the filter store.")
+	}
+	Logger.Infof("Pruning the filter store in:\n\t%s", store.path)
+	removed, err := store.prune()
+	for _, entry := range removed {
+		if entry.Name == "" {
+			Logger.Debug("Removed an incomplete entry of the filter store.")
+			continue
+		}
+		Logger.Infof(
+			"Removed filter %q from the filter store.\nURL: %s\nCommit: %s",
+			entry.Name, entry.Url, entry.Sha)
+	}
+	if err != nil {
+		return WrapError(err, "Failed to prune the filter store.")
+	}
+	Logger.Infof("Removed %d unused entries from the filter store.", len(removed))
+	return nil
+}
+
 // Unlock handles the "regolith unlock". It unlocks safe mode, by signing the
 // machine ID into lockfile.txt.
 //
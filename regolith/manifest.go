@@ -0,0 +1,338 @@
+package regolith
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// gitTagManifestVersion is the value of the "version" property of the
+// manifest options which uses the latest git tag of the project as the
+// version.
+const gitTagManifestVersion = "gitTag"
+
+// ManifestOptions is a part of the profile that describes how Regolith
+// updates the manifest.json files of the packs before exporting them.
+type ManifestOptions struct {
+	// Version is the version applied to the headers and the modules of the
+	// packs, or "gitTag" to use the latest git tag of the project
+	Version string `json:"version,omitempty"`
+
+	// NewUuids replaces the UUIDs of the packs and their modules with UUIDs
+	// generated from the original ones and the name of the profile
+	NewUuids bool `json:"newUuids,omitempty"`
+}
+
+// ManifestOptionsFromObject creates a "ManifestOptions" object from
+// map[string]interface{}
+func ManifestOptionsFromObject(
+	obj map[string]interface{},
+) (*ManifestOptions, error) {
+	result := &ManifestOptions{}
+	// Version
+	if version, ok := obj["version"]; ok {
+		result.Version, ok = version.(string)
+		if !ok {
+			return nil, WrappedErrorf(jsonPropertyTypeError, "version", "string")
+		}
+		if result.Version != gitTagManifestVersion {
+			_, err := parseManifestVersion(result.Version)
+			if err != nil {
+				return nil, WrapErrorf(err, jsonPropertyParseError, "version")
+			}
+		}
+	}
+	// NewUuids
+	if newUuids, ok := obj["newUuids"]; ok {
+		result.NewUuids, ok = newUuids.(bool)
+		if !ok {
+			return nil, WrappedErrorf(
+				jsonPropertyTypeError, "newUuids", "boolean")
+		}
+	}
+	return result, nil
+}
+
+// loadManifest loads the manifest.json file of a pack.
+func loadManifest(packPath string) (map[string]interface{}, error) {
+	manifestPath := filepath.Join(packPath, "manifest.json")
+	file, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return nil, WrapErrorf(err, fileReadError, manifestPath)
+	}
+	var manifest map[string]interface{}
+	err = json.Unmarshal(file, &manifest)
+	if err != nil {
+		return nil, WrapErrorf(err, jsonUnmarshalError, manifestPath)
+	}
+	return manifest, nil
+}
+
+// manifestVersionString converts a version from a manifest to a string. The
+// versions are usually arrays of three numbers (like [1, 0, 0]) but the
+// newer formats also allow strings.
+func manifestVersionString(version interface{}) (string, error) {
+	switch version := version.(type) {
+	case string:
+		return version, nil
+	case []interface{}:
+		parts := make([]string, len(version))
+		for i, part := range version {
+			number, ok := part.(float64)
+			if !ok {
+				return "", WrappedErrorf(
+					"Invalid version number.\nVersion: %v", version)
+			}
+			parts[i] = fmt.Sprint(number)
+		}
+		return strings.Join(parts, "."), nil
+	}
+	return "", WrappedErrorf("Invalid version.\nVersion: %v", version)
+}
+
+// manifestHeader returns the "header" object of the manifest of a pack.
+func manifestHeader(packPath string) (map[string]interface{}, error) {
+	manifest, err := loadManifest(packPath)
+	if err != nil {
+		return nil, PassError(err)
+	}
+	header, ok := manifest["header"].(map[string]interface{})
+	if !ok {
+		return nil, WrappedErrorf(jsonPathTypeError, "header", "object")
+	}
+	return header, nil
+}
+
+// manifestHeaderVersion returns the "header->version" property of the
+// manifest of a pack as a string.
+func manifestHeaderVersion(packPath string) (string, error) {
+	header, err := manifestHeader(packPath)
+	if err != nil {
+		return "", PassError(err)
+	}
+	versionObj, ok := header["version"]
+	if !ok {
+		return "", WrappedErrorf(jsonPathMissingError, "header->version")
+	}
+	version, err := manifestVersionString(versionObj)
+	if err != nil {
+		return "", WrapErrorf(err, jsonPathParseError, "header->version")
+	}
+	return version, nil
+}
+
+// manifestPackReference returns the UUID and the version of a pack in the
+// format used by the world_behavior_packs.json and world_resource_packs.json
+// files of the worlds. The version is copied from the manifest without
+// changing its format.
+func manifestPackReference(packPath string) (map[string]interface{}, error) {
+	header, err := manifestHeader(packPath)
+	if err != nil {
+		return nil, PassError(err)
+	}
+	uuid, ok := header["uuid"].(string)
+	if !ok {
+		return nil, WrappedErrorf(jsonPathTypeError, "header->uuid", "string")
+	}
+	version, ok := header["version"]
+	if !ok {
+		return nil, WrappedErrorf(jsonPathMissingError, "header->version")
+	}
+	return map[string]interface{}{"pack_id": uuid, "version": version}, nil
+}
+
+// parseManifestVersion parses a version in the "major.minor.patch" format
+// (optionally with the "v" prefix) into an array of three numbers.
+func parseManifestVersion(version string) ([3]int, error) {
+	result := [3]int{}
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) != 3 {
+		return result, WrappedErrorf(
+			"The version must have the \"major.minor.patch\" format.\n"+
+				"Version: %s", version)
+	}
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return result, WrappedErrorf(
+				"The version must have the \"major.minor.patch\" format.\n"+
+					"Version: %s", version)
+		}
+		result[i] = number
+	}
+	return result, nil
+}
+
+// gitTagVersion returns the latest git tag of the project, which is used as
+// the version of the packs.
+func gitTagVersion() (string, error) {
+	commandArgs := []string{"describe", "--tags", "--abbrev=0"}
+	output, err := exec.Command("git", commandArgs...).Output()
+	if err != nil {
+		command := "git " + strings.Join(commandArgs, " ")
+		return "", WrapErrorf(err, execCommandError, command)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// manifestVersionValue returns the version in the format of the oldVersion
+// from a manifest. The versions in the newer formats of the manifest can be
+// strings, otherwise they're arrays of three numbers.
+func manifestVersionValue(version [3]int, oldVersion interface{}) interface{} {
+	if _, ok := oldVersion.(string); ok {
+		return fmt.Sprintf("%d.%d.%d", version[0], version[1], version[2])
+	}
+	return []interface{}{version[0], version[1], version[2]}
+}
+
+// profileUuid generates a UUID for the profile from the original UUID of a
+// pack or a module. It's a version 5 UUID which uses the original UUID as the
+// namespace and the name of the profile as the name, so the same profile
+// always gets the same UUIDs.
+func profileUuid(uuid, profileName string) (string, error) {
+	namespace, err := hex.DecodeString(strings.ReplaceAll(uuid, "-", ""))
+	if err != nil || len(namespace) != 16 {
+		return "", WrappedErrorf("Invalid UUID.\nUUID: %s", uuid)
+	}
+	hash := sha1.Sum(append(namespace, []byte(profileName)...))
+	result := hash[:16]
+	result[6] = (result[6] & 0x0f) | 0x50 // Version 5
+	result[8] = (result[8] & 0x3f) | 0x80 // RFC 4122 variant
+	text := hex.EncodeToString(result)
+	return fmt.Sprintf(
+		"%s-%s-%s-%s-%s",
+		text[0:8], text[8:12], text[12:16], text[16:20], text[20:32]), nil
+}
+
+// UpdateManifests applies the manifest options of the profile to the
+// manifest.json files of the packs in the tmp directory. It can change the
+// versions and the UUIDs of the packs and their modules. The dependencies of
+// the packs on each other are updated to match the new UUIDs and versions.
+// The version from the options of the RunContext overrides the version from
+// the profile.
+func UpdateManifests(context RunContext, profile Profile) error {
+	options := ManifestOptions{}
+	if profile.Manifest != nil {
+		options = *profile.Manifest
+	}
+	if context.Options.ManifestVersion != "" {
+		options.Version = context.Options.ManifestVersion
+	}
+	if options.Version == "" && !options.NewUuids {
+		return nil
+	}
+	var version [3]int
+	if options.Version != "" {
+		versionText := options.Version
+		if versionText == gitTagManifestVersion {
+			var err error
+			versionText, err = gitTagVersion()
+			if err != nil {
+				return WrapError(
+					err, "Failed to get the latest git tag of the project.")
+			}
+		}
+		var err error
+		version, err = parseManifestVersion(versionText)
+		if err != nil {
+			return PassError(err)
+		}
+	}
+	// Load the manifests
+	type packManifest struct {
+		path     string
+		manifest map[string]interface{}
+		header   map[string]interface{}
+	}
+	packs := []packManifest{}
+	for _, pack := range []string{"tmp/BP", "tmp/RP"} {
+		packPath := filepath.Join(context.DotRegolithPath, pack)
+		_, err := os.Stat(filepath.Join(packPath, "manifest.json"))
+		if os.IsNotExist(err) {
+			Logger.Debugf("Skipping the pack without manifest: %s", packPath)
+			continue
+		}
+		manifest, err := loadManifest(packPath)
+		if err != nil {
+			return PassError(err)
+		}
+		header, ok := manifest["header"].(map[string]interface{})
+		if !ok {
+			return WrapErrorf(
+				WrappedErrorf(jsonPathTypeError, "header", "object"),
+				"Invalid manifest.\nPath: %s", packPath)
+		}
+		packs = append(packs, packManifest{
+			path: packPath, manifest: manifest, header: header})
+	}
+	// Update the headers and the modules. The new UUIDs of the packs are
+	// saved to update the dependencies.
+	newUuids := map[string]string{}
+	for _, pack := range packs {
+		objects := []map[string]interface{}{pack.header}
+		modules, _ := pack.manifest["modules"].([]interface{})
+		for _, module := range modules {
+			if module, ok := module.(map[string]interface{}); ok {
+				objects = append(objects, module)
+			}
+		}
+		for i, object := range objects {
+			if options.Version != "" {
+				object["version"] = manifestVersionValue(
+					version, object["version"])
+			}
+			if !options.NewUuids {
+				continue
+			}
+			uuid, _ := object["uuid"].(string)
+			newUuid, err := profileUuid(uuid, context.Profile)
+			if err != nil {
+				return WrapErrorf(
+					err, "Failed to generate a new UUID for the pack.\n"+
+						"Path: %s", pack.path)
+			}
+			object["uuid"] = newUuid
+			if i == 0 {
+				newUuids[uuid] = newUuid
+			}
+		}
+	}
+	// Update the dependencies on the other packs
+	for _, pack := range packs {
+		dependencies, _ := pack.manifest["dependencies"].([]interface{})
+		for _, dependency := range dependencies {
+			dependency, ok := dependency.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			uuid, _ := dependency["uuid"].(string)
+			if newUuid, ok := newUuids[uuid]; ok {
+				dependency["uuid"] = newUuid
+				uuid = newUuid
+			}
+			for _, other := range packs {
+				if other.path != pack.path && other.header["uuid"] == uuid {
+					dependency["version"] = other.header["version"]
+				}
+			}
+		}
+	}
+	// Save the manifests
+	for _, pack := range packs {
+		manifestPath := filepath.Join(pack.path, "manifest.json")
+		manifestJson, _ := json.MarshalIndent(
+			pack.manifest, "", "    ") // no error
+		err := ioutil.WriteFile(manifestPath, manifestJson, 0644)
+		if err != nil {
+			return WrapErrorf(err, fileWriteError, manifestPath)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package regolith
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"golang.org/x/mod/semver"
+)
+
+// filterVersions are the versions of a remote filter compared by the
+// "regolith outdated" command.
+type filterVersions struct {
+	// Name is the name of the filter
+	Name string
+
+	// Url is the URL of the repository of the filter
+	Url string
+
+	// Pinned is the version of the filter from the config file
+	Pinned string
+
+	// Installed is the installed version of the filter or an empty string
+	// if the filter is not installed
+	Installed string
+
+	// Latest is the newest version of the filter with a semver tag or an
+	// empty string if the filter doesn't have any
+	Latest string
+
+	// Head is the SHA of the newest commit of the repository of the filter
+	Head string
+
+	// Outdated is true if an update of the filter is available
+	Outdated bool
+
+	// wanted is the highest version that satisfies the semver range from
+	// the config file, if the pinned version is a range
+	wanted string
+}
+
+// checkFilterVersions finds the versions of the remote filter. It doesn't
+// download or change anything.
+func checkFilterVersions(
+	f *RemoteFilterDefinition, dotRegolithPath string,
+) (filterVersions, error) {
+	result := filterVersions{Name: f.Id, Url: f.Url, Pinned: f.Version}
+	if installed, err := f.InstalledVersion(dotRegolithPath); err == nil {
+		result.Installed = trimFilterPrefix(installed, f.Id)
+	}
+	tags, err := ListRemoteFilterTags(f.Url, f.Id)
+	if err != nil {
+		return result, WrapErrorf(
+			err, "Failed to list the versions of the filter.\nURL: %s", f.Url)
+	}
+	if len(tags) > 0 {
+		result.Latest = trimFilterPrefix(tags[len(tags)-1], f.Id)
+	}
+	if isVersionRange(f.Version) {
+		if tag, ok := highestMatchingTag(tags, f.Id, f.Version); ok {
+			result.wanted = trimFilterPrefix(tag, f.Id)
+		}
+	}
+	result.Head, err = GetHeadSha(f.Url, f.Id)
+	if err != nil {
+		return result, WrapErrorf(
+			err, "Failed to get the SHA of the newest commit of the "+
+				"filter.\nURL: %s", f.Url)
+	}
+	result.Outdated = result.isOutdated()
+	return result, nil
+}
+
+// isOutdated returns true if "regolith update" would install a different
+// version of the filter than the installed one, or if there is a newer
+// version of the filter than the installed or the pinned one. For the
+// semver ranges, the versions outside of the range are also updates.
+func (v filterVersions) isOutdated() bool {
+	if isVersionRange(v.Pinned) {
+		if v.wanted != "" && v.Installed != "" && v.Installed != v.wanted {
+			return true
+		}
+		return v.Latest != "" && v.Latest != v.wanted
+	}
+	switch v.Pinned {
+	case "HEAD":
+		return v.Installed != "" && v.Installed != v.Head
+	case "latest":
+		wanted := v.Latest
+		if wanted == "" {
+			wanted = v.Head
+		}
+		return v.Installed != "" && v.Installed != wanted
+	}
+	if v.Installed != "" && v.Installed != v.Pinned {
+		return true
+	}
+	return v.Latest != "" && semver.IsValid("v"+v.Pinned) &&
+		semver.Compare("v"+v.Latest, "v"+v.Pinned) > 0
+}
+
+// status returns the description of the state of the filter for the table
+// printed by "regolith outdated".
+func (v filterVersions) status() string {
+	if v.Outdated {
+		return "update available"
+	}
+	if v.Installed == "" {
+		return "not installed"
+	}
+	return "up to date"
+}
+
+// checkOutdatedFilters finds the versions of all of the remote filters
+// from the filter definitions, sorted by their names.
+func checkOutdatedFilters(
+	filterDefinitions map[string]FilterInstaller, dotRegolithPath string,
+) ([]filterVersions, error) {
+	names := make([]string, 0, len(filterDefinitions))
+	for name, filter := range filterDefinitions {
+		if _, ok := filter.(*RemoteFilterDefinition); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	result := make([]filterVersions, 0, len(names))
+	for _, name := range names {
+		Logger.Debugf("Checking the versions of filter %q...", name)
+		versions, err := checkFilterVersions(
+			filterDefinitions[name].(*RemoteFilterDefinition),
+			dotRegolithPath)
+		if err != nil {
+			return nil, WrapErrorf(
+				err, "Failed to check the versions of the filter.\n"+
+					"Filter: %s", name)
+		}
+		result = append(result, versions)
+	}
+	return result, nil
+}
+
+// printOutdatedTable prints the versions of the filters as a table.
+func printOutdatedTable(out io.Writer, filters []filterVersions) {
+	orDash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILTER\tPINNED\tINSTALLED\tLATEST\tHEAD\tSTATUS")
+	for _, f := range filters {
+		head := f.Head
+		if isCommitSha(head) && len(head) > 7 {
+			head = head[:7]
+		}
+		fmt.Fprintf(
+			w, "%s\t%s\t%s\t%s\t%s\t%s\n", f.Name, f.Pinned,
+			orDash(f.Installed), orDash(f.Latest), orDash(head), f.status())
+	}
+	w.Flush()
+}
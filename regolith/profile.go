@@ -21,11 +21,12 @@ func RecycledSetupTmpFiles(config Config, profile Profile, dotRegolithPath strin
 	if err != nil {
 		return WrapErrorf(err, osMkdirError, tmpPath)
 	}
+	packs, dataPath := config.profileSources(profile)
 	// Copy the contents of the 'regolith' folder to '[dotRegolith]/tmp'
-	if config.ResourceFolder != "" {
+	if packs.ResourceFolder != "" {
 		Logger.Debugf("Copying project files to \"%s\"", tmpPath)
 		err = FullRecycledMoveOrCopy(
-			config.ResourceFolder, filepath.Join(tmpPath, "RP"),
+			packs.ResourceFolder, filepath.Join(tmpPath, "RP"),
 			RecycledMoveOrCopySettings{
 				canMove:                 false,
 				saveSourceHashes:        false,
@@ -38,9 +39,9 @@ func RecycledSetupTmpFiles(config Config, profile Profile, dotRegolithPath strin
 				err, "Failed to setup RP folder in the temporary directory.")
 		}
 	}
-	if config.BehaviorFolder != "" {
+	if packs.BehaviorFolder != "" {
 		err = FullRecycledMoveOrCopy(
-			config.BehaviorFolder, filepath.Join(tmpPath, "BP"),
+			packs.BehaviorFolder, filepath.Join(tmpPath, "BP"),
 			RecycledMoveOrCopySettings{
 				canMove:                 false,
 				saveSourceHashes:        false,
@@ -53,9 +54,9 @@ func RecycledSetupTmpFiles(config Config, profile Profile, dotRegolithPath strin
 				err, "Failed to setup BP folder in the temporary directory.")
 		}
 	}
-	if config.DataPath != "" {
+	if dataPath != "" {
 		err = FullRecycledMoveOrCopy(
-			config.DataPath, filepath.Join(tmpPath, "data"),
+			dataPath, filepath.Join(tmpPath, "data"),
 			RecycledMoveOrCopySettings{
 				canMove:                 false,
 				saveSourceHashes:        false,
@@ -68,6 +69,11 @@ func RecycledSetupTmpFiles(config Config, profile Profile, dotRegolithPath strin
 				err, "Failed to setup data folder in the temporary directory.")
 		}
 	}
+	err = copyExtraPacks(profile, tmpPath)
+	if err != nil {
+		return WrapError(
+			err, "Failed to copy the extra packs to the temporary directory.")
+	}
 
 	Logger.Debug("Setup done in ", time.Since(start))
 	return nil
@@ -128,21 +134,27 @@ func SetupTmpFiles(config Config, profile Profile, dotRegolithPath string) error
 		return nil
 	}
 
-	err = setup_tmp_directory(config.ResourceFolder, "RP", "resource folder")
+	packs, dataPath := config.profileSources(profile)
+	err = setup_tmp_directory(packs.ResourceFolder, "RP", "resource folder")
 	if err != nil {
 		return WrapErrorf(
 			err, "Failed to setup RP folder in the temporary directory.")
 	}
-	err = setup_tmp_directory(config.BehaviorFolder, "BP", "behavior folder")
+	err = setup_tmp_directory(packs.BehaviorFolder, "BP", "behavior folder")
 	if err != nil {
 		return WrapErrorf(
 			err, "Failed to setup BP folder in the temporary directory.")
 	}
-	err = setup_tmp_directory(config.DataPath, "data", "data folder")
+	err = setup_tmp_directory(dataPath, "data", "data folder")
 	if err != nil {
 		return WrapErrorf(
 			err, "Failed to setup data folder in the temporary directory.")
 	}
+	err = copyExtraPacks(profile, tmpPath)
+	if err != nil {
+		return WrapError(
+			err, "Failed to copy the extra packs to the temporary directory.")
+	}
 
 	Logger.Debug("Setup done in ", time.Since(start))
 	return nil
@@ -164,6 +176,34 @@ func CheckProfileImpl(
 			return WrapErrorf(err, filterRunnerCheckError, f.GetId())
 		}
 	}
+	err := checkFilterDependencies(profile, profileName)
+	if err != nil {
+		return PassError(err)
+	}
+	return nil
+}
+
+// checkFilterDependencies checks whether the "dependsOn" properties of the
+// filters of the profile are valid. They can be used only in the profiles
+// with "parallel" enabled, they must reference the filters from the same
+// profile and they can't be circular.
+func checkFilterDependencies(profile Profile, profileName string) error {
+	if profile.Parallel {
+		_, err := filterDependencyGraph(profile.Filters)
+		if err != nil {
+			return WrapErrorf(err, filterDependenciesError, profileName)
+		}
+		return nil
+	}
+	for i, f := range profile.Filters {
+		if len(f.GetDependsOn()) > 0 {
+			return WrappedErrorf(
+				"The \"dependsOn\" property can only be used in "+
+					"profiles with \"parallel\" enabled.\n"+
+					"Profile: %s\nJSON path: filters->%d",
+				profileName, i)
+		}
+	}
 	return nil
 }
 
@@ -197,7 +237,20 @@ start:
 	if err != nil {
 		return WrapErrorf(err, runContextGetProfileError)
 	}
-	err = RecycledSetupTmpFiles(*context.Config, profile, context.DotRegolithPath)
+	restored, err := context.setupTmpFromSnapshot(profile)
+	if err != nil {
+		return PassError(err)
+	}
+	if restored {
+		// The cached states don't match the restored files
+		err = ClearCachedStates()
+		if err != nil {
+			err = WrapError(err, clearCachedStatesError)
+		}
+	} else {
+		err = RecycledSetupTmpFiles(
+			*context.Config, profile, context.DotRegolithPath)
+	}
 	if err != nil {
 		err1 := ClearCachedStates() // Just to be safe clear cached states
 		if err1 != nil {
@@ -222,11 +275,20 @@ start:
 		}
 		goto start
 	}
+	err = UpdateManifests(context, profile)
+	if err != nil {
+		err1 := ClearCachedStates() // Just to be safe clear cached states
+		if err1 != nil {
+			err = WrapError(err1, clearCachedStatesError)
+		}
+		return WrapError(err, updateManifestsError)
+	}
 	// Export files
 	Logger.Info("Moving files to target directory.")
 	start := time.Now()
+	_, dataPath := context.Config.profileSources(profile)
 	err = RecycledExportProject(
-		profile, context.Config.Name, context.Config.DataPath, context.DotRegolithPath)
+		profile, context.Config.Name, dataPath, context.DotRegolithPath)
 	if err != nil {
 		err1 := ClearCachedStates() // Just to be safe clear cached states
 		if err1 != nil {
@@ -257,9 +319,15 @@ start:
 	if err != nil {
 		return WrapErrorf(err, runContextGetProfileError)
 	}
-	err = SetupTmpFiles(*context.Config, profile, context.DotRegolithPath)
+	restored, err := context.setupTmpFromSnapshot(profile)
 	if err != nil {
-		return WrapErrorf(err, setupTmpFilesError, context.DotRegolithPath)
+		return PassError(err)
+	}
+	if !restored {
+		err = SetupTmpFiles(*context.Config, profile, context.DotRegolithPath)
+		if err != nil {
+			return WrapErrorf(err, setupTmpFilesError, context.DotRegolithPath)
+		}
 	}
 	if context.IsInterrupted() {
 		goto start
@@ -272,11 +340,16 @@ start:
 	if interrupted {
 		goto start
 	}
+	err = UpdateManifests(context, profile)
+	if err != nil {
+		return WrapError(err, updateManifestsError)
+	}
 	// Export files
 	Logger.Info("Moving files to target directory.")
 	start := time.Now()
+	_, dataPath := context.Config.profileSources(profile)
 	err = ExportProject(
-		profile, context.Config.Name, context.Config.DataPath, context.DotRegolithPath)
+		profile, context.Config.Name, dataPath, context.DotRegolithPath)
 	if err != nil {
 		return WrapError(err, exportProjectError)
 	}
@@ -294,22 +367,39 @@ func WatchProfileImpl(context RunContext) (bool, error) {
 	if err != nil {
 		return false, WrapErrorf(err, runContextGetProfileError)
 	}
+	// The filters selected by the options are used only in the main profile
+	var selected []bool
+	if context.Parent == nil {
+		selected, err = selectFilters(profile, context.Options)
+		if err != nil {
+			return false, PassError(err)
+		}
+	}
+	if profile.Parallel {
+		return runFiltersInParallel(context, profile, selected)
+	}
+	if context.Parent == nil && context.Options.Trace {
+		if err := context.startTrace(); err != nil {
+			return false, WrapError(err, "Failed to start the trace.")
+		}
+	}
 	// Run the filters!
-	for filter := range profile.Filters {
-		filter := profile.Filters[filter]
+	for i := range profile.Filters {
+		filter := profile.Filters[i]
+		if selected != nil && !selected[i] {
+			Logger.Debugf("Filter \"%s\" is not selected, skipping.", filter.GetId())
+			continue
+		}
 		// Disabled filters are skipped
-		if filter.IsDisabled() {
+		if filter.IsDisabled(context) {
 			Logger.Infof("Filter \"%s\" is disabled, skipping.", filter.GetId())
 			continue
 		}
-		// Skip printing if the filter ID is empty (most likely a nested profile)
-		if filter.GetId() != "" {
-			Logger.Infof("Running filter %s", filter.GetId())
-		}
+		logFilterStarted(context, filter)
 		// Run the filter in watch mode
 		start := time.Now()
-		interrupted, err := filter.Run(context)
-		Logger.Debugf("Executed in %s", time.Since(start))
+		interrupted, err := runFilterWithCache(context, filter, i)
+		logFilterFinished(context, filter, time.Since(start), err)
 		if err != nil {
 			err1 := ClearCachedStates() // Just to be safe clear cached states
 			if err1 != nil {
@@ -321,6 +411,21 @@ func WatchProfileImpl(context RunContext) (bool, error) {
 		if interrupted {
 			return true, nil
 		}
+		if context.Parent == nil && context.Options.SaveSnapshots {
+			err = saveSnapshot(context.DotRegolithPath, context.Profile, i)
+			if err != nil {
+				return false, WrapErrorf(
+					err, "Failed to save the snapshot of the tmp directory "+
+						"after the filter.\nFilter: %s", filter.GetId())
+			}
+		}
+		if context.Parent == nil && context.Options.Trace {
+			if err := context.traceFilter(filter, i); err != nil {
+				return false, WrapErrorf(
+					err, "Failed to trace the filter.\nFilter: %s",
+					filter.GetId())
+			}
+		}
 	}
 	return false, nil
 }
@@ -368,17 +473,24 @@ func (f *RemoteFilter) subfilterCollection(dotRegolithPath string) (*FilterColle
 		}
 		// Using the same JSON data to create both the filter
 		// definiton (installer) and the filter (runner)
-		filterId := fmt.Sprintf("%v:subfilter%v", f.Id, i)
-		filterInstaller, err := FilterInstallerFromObject(filterId, filter)
+		var filterInstaller FilterInstaller
+		if isNestedRemoteFilterObject(filter) {
+			// The "filter" key of the remote filters is the name of the
+			// filter, which is also its ID
+			filterInstaller, err = nestedRemoteFilterFromObject(filter)
+		} else {
+			filterId := fmt.Sprintf("%v:subfilter%v", f.Id, i)
+			filterInstaller, err = FilterInstallerFromObject(filterId, filter)
+			// The subfilters don't have the "filter" key but this would break
+			// the code as it's required by local filters. Adding it here to
+			// make the code work.
+			// TODO - this is a hack, fix it!
+			filter["filter"] = filterId
+		}
 		if err != nil {
 			return nil, extraFilterJsonErrorInfo(
 				path, WrapErrorf(err, jsonPathParseError, jsonPath))
 		}
-		// Remote filters don't have the "filter" key but this would break the
-		// code as it's required by local filters. Adding it here to make the
-		// code work.
-		// TODO - this is a hack, fix it!
-		filter["filter"] = filterId
 		filterRunner, err := filterInstaller.CreateFilterRunner(filter)
 		if err != nil {
 			// TODO - better filterName?
@@ -386,17 +498,6 @@ func (f *RemoteFilter) subfilterCollection(dotRegolithPath string) (*FilterColle
 			return nil, WrapErrorf(
 				err, createFilterRunnerError, filterName)
 		}
-		if _, ok := filterRunner.(*RemoteFilter); ok {
-			// TODO - we could possibly implement recursive filters here
-			return nil, WrappedErrorf(
-				"Regolith detected a reference to a remote filter inside "+
-					"another remote filter.\n"+
-					"This feature is not supported.\n"+
-					"Filter name: %s"+
-					"Filter configuration file: %s\n"+
-					"JSON path to remote filter reference: filters->%d",
-				f.Id, path, i)
-		}
 		filterRunner.CopyArguments(f)
 		result.Filters = append(result.Filters, filterRunner)
 	}
@@ -410,7 +511,33 @@ type FilterCollection struct {
 
 type Profile struct {
 	FilterCollection
-	ExportTarget ExportTarget `json:"export,omitempty"`
+	ExportTargets ExportTargets `json:"export,omitempty"`
+
+	// Parallel enables running the filters of the profile in parallel. The
+	// order of the filters is defined by their "dependsOn" properties instead
+	// of their order in the list.
+	Parallel bool `json:"parallel,omitempty"`
+
+	// MaxParallelFilters is the maximal number of filters that can run at the
+	// same time in the parallel mode. Zero means the number of CPUs.
+	MaxParallelFilters int `json:"maxParallelFilters,omitempty"`
+
+	// Manifest describes how Regolith updates the manifest.json files of
+	// the packs before exporting them. If it's nil, the manifests are not
+	// changed.
+	Manifest *ManifestOptions `json:"manifest,omitempty"`
+
+	// Packs overrides the source folders of the packs from the config. The
+	// empty fields use the folders from the config.
+	Packs Packs `json:"packs,omitempty"`
+
+	// DataPath overrides the data path from the config.
+	DataPath string `json:"dataPath,omitempty"`
+
+	// ExtraPacks is a list of additional source folders of the packs. Their
+	// files are copied in order on top of the files of the main source
+	// folders, replacing the files with the same paths.
+	ExtraPacks []Packs `json:"extraPacks,omitempty"`
 }
 
 func ProfileFromObject(
@@ -439,18 +566,172 @@ func ProfileFromObject(
 		}
 		result.Filters = append(result.Filters, filterRunner)
 	}
-	// ExportTarget
+	// ExportTargets
 	if _, ok := obj["export"]; !ok {
 		return result, WrappedErrorf(jsonPathMissingError, "export")
 	}
-	export, ok := obj["export"].(map[string]interface{})
-	if !ok {
-		return result, WrappedErrorf(jsonPathTypeError, "export", "object")
-	}
-	exportTarget, err := ExportTargetFromObject(export)
+	exportTargets, err := ExportTargetsFromObject(obj["export"])
 	if err != nil {
 		return result, WrapErrorf(err, jsonPathParseError, "export")
 	}
-	result.ExportTarget = exportTarget
+	result.ExportTargets = exportTargets
+	err = profileOptionsFromObject(obj, &result)
+	if err != nil {
+		return result, PassError(err)
+	}
+	return result, nil
+}
+
+// profileOptionsFromObject parses the optional properties of the profile
+// which don't need to know about the filters or the export target.
+func profileOptionsFromObject(obj map[string]interface{}, profile *Profile) error {
+	// Parallel
+	if parallel, ok := obj["parallel"]; ok {
+		profile.Parallel, ok = parallel.(bool)
+		if !ok {
+			return WrappedErrorf(jsonPathTypeError, "parallel", "boolean")
+		}
+	}
+	// MaxParallelFilters
+	if maxParallelFilters, ok := obj["maxParallelFilters"]; ok {
+		value, ok := maxParallelFilters.(float64)
+		if !ok || value < 1 || value != float64(int(value)) {
+			return WrappedErrorf(
+				jsonPathTypeError, "maxParallelFilters", "positive integer")
+		}
+		profile.MaxParallelFilters = int(value)
+	}
+	// Manifest
+	if manifest, ok := obj["manifest"]; ok {
+		manifest, ok := manifest.(map[string]interface{})
+		if !ok {
+			return WrappedErrorf(jsonPathTypeError, "manifest", "object")
+		}
+		manifestOptions, err := ManifestOptionsFromObject(manifest)
+		if err != nil {
+			return WrapErrorf(err, jsonPathParseError, "manifest")
+		}
+		profile.Manifest = manifestOptions
+	}
+	// Packs
+	if packs, ok := obj["packs"]; ok {
+		packs, ok := packs.(map[string]interface{})
+		if !ok {
+			return WrappedErrorf(jsonPathTypeError, "packs", "object")
+		}
+		result, err := profilePacksFromObject(packs)
+		if err != nil {
+			return WrapErrorf(err, jsonPathParseError, "packs")
+		}
+		profile.Packs = result
+	}
+	// DataPath
+	if dataPath, ok := obj["dataPath"]; ok {
+		profile.DataPath, ok = dataPath.(string)
+		if !ok || profile.DataPath == "" {
+			return WrappedErrorf(
+				jsonPathTypeError, "dataPath", "non-empty string")
+		}
+	}
+	// ExtraPacks
+	if extraPacks, ok := obj["extraPacks"]; ok {
+		extraPacks, ok := extraPacks.([]interface{})
+		if !ok {
+			return WrappedErrorf(jsonPathTypeError, "extraPacks", "array")
+		}
+		for i, packs := range extraPacks {
+			jsonPath := fmt.Sprintf("extraPacks->%d", i)
+			packs, ok := packs.(map[string]interface{})
+			if !ok {
+				return WrappedErrorf(jsonPathTypeError, jsonPath, "object")
+			}
+			result, err := profilePacksFromObject(packs)
+			if err != nil {
+				return WrapErrorf(err, jsonPathParseError, jsonPath)
+			}
+			if result.BehaviorFolder == "" && result.ResourceFolder == "" {
+				return WrappedErrorf(
+					"The extra packs require a \"behaviorPack\" or "+
+						"\"resourcePack\" property.\nJSON Path: %s", jsonPath)
+			}
+			profile.ExtraPacks = append(profile.ExtraPacks, result)
+		}
+	}
+	return nil
+}
+
+// profilePacksFromObject creates a "Packs" object from the "packs" or
+// "extraPacks" property of a profile. Unlike PacksFromObject, it doesn't
+// ignore the properties with invalid types.
+func profilePacksFromObject(obj map[string]interface{}) (Packs, error) {
+	result := Packs{}
+	for property, target := range map[string]*string{
+		"behaviorPack": &result.BehaviorFolder,
+		"resourcePack": &result.ResourceFolder,
+	} {
+		value, ok := obj[property]
+		if !ok {
+			continue
+		}
+		*target, ok = value.(string)
+		if !ok || *target == "" {
+			return result, WrappedErrorf(
+				jsonPropertyTypeError, property, "non-empty string")
+		}
+	}
 	return result, nil
 }
+
+// profileSources returns the source folders of the packs and the data path
+// used by the profile. These are the paths from the config with the
+// overrides from the profile.
+func (c *Config) profileSources(profile Profile) (Packs, string) {
+	packs := c.Packs
+	if profile.Packs.BehaviorFolder != "" {
+		packs.BehaviorFolder = profile.Packs.BehaviorFolder
+	}
+	if profile.Packs.ResourceFolder != "" {
+		packs.ResourceFolder = profile.Packs.ResourceFolder
+	}
+	dataPath := c.DataPath
+	if profile.DataPath != "" {
+		dataPath = profile.DataPath
+	}
+	return packs, dataPath
+}
+
+// copyExtraPacks copies the files from the extra source folders of the
+// profile to the tmp directory. The files replace the files with the same
+// paths copied from the main source folders and from the previous extra
+// folders.
+func copyExtraPacks(profile Profile, tmpPath string) error {
+	for _, packs := range profile.ExtraPacks {
+		for _, pack := range []struct{ source, shortName string }{
+			{packs.ResourceFolder, "RP"},
+			{packs.BehaviorFolder, "BP"},
+		} {
+			if pack.source == "" {
+				continue
+			}
+			target := filepath.Join(tmpPath, pack.shortName)
+			stats, err := os.Stat(pack.source)
+			if err != nil {
+				if os.IsNotExist(err) {
+					Logger.Warnf("Extra pack %q does not exist", pack.source)
+					continue
+				}
+				return WrapErrorf(err, osStatErrorAny, pack.source)
+			}
+			if !stats.IsDir() {
+				return WrappedErrorf(isDirNotADirError, pack.source)
+			}
+			err = copy.Copy(
+				pack.source, target,
+				copy.Options{PreserveTimes: false, Sync: false})
+			if err != nil {
+				return WrapErrorf(err, osCopyError, pack.source, target)
+			}
+		}
+	}
+	return nil
+}
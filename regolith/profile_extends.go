@@ -0,0 +1,166 @@
+package regolith
+
+import (
+	"strings"
+)
+
+// resolveProfiles returns a copy of the "profiles" object from the config
+// file with the "extends" properties of the profiles resolved. The profiles
+// that extend other profiles are merged with them using
+// mergeProfileObjects.
+func resolveProfiles(
+	profiles map[string]interface{},
+) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(profiles))
+	for name := range profiles {
+		profile, err := resolveProfile(name, profiles)
+		if err != nil {
+			return nil, WrapErrorf(
+				err, jsonPropertyParseError, "profiles->"+name)
+		}
+		result[name] = profile
+	}
+	return result, nil
+}
+
+// resolveProfile returns the object of the profile from the "profiles"
+// object of the config file, merged with the profiles that it extends.
+// Values that aren't objects are returned unchanged, so they can be
+// reported by ProfileFromObject.
+func resolveProfile(
+	name string, profiles map[string]interface{},
+) (interface{}, error) {
+	return resolveProfileChain(name, profiles, nil)
+}
+
+// resolveProfileChain implements resolveProfile. The chain is the list of
+// the profiles that extend the current profile, used for detecting the
+// circular references.
+func resolveProfileChain(
+	name string, profiles map[string]interface{}, chain []string,
+) (interface{}, error) {
+	chain = append(chain, name)
+	for _, previous := range chain[:len(chain)-1] {
+		if previous == name {
+			return nil, WrappedErrorf(
+				"Circular \"extends\" references between the profiles.\n"+
+					"Chain: %s", strings.Join(chain, " -> "))
+		}
+	}
+	profileObj, ok := profiles[name]
+	if !ok {
+		return nil, WrappedErrorf(
+			"The extended profile doesn't exist.\nProfile: %s\nChain: %s",
+			name, strings.Join(chain, " -> "))
+	}
+	profile, ok := profileObj.(map[string]interface{})
+	if !ok {
+		return profileObj, nil
+	}
+	extendsObj, ok := profile["extends"]
+	if !ok {
+		if _, ok := profile["prependFilters"]; ok {
+			return nil, WrappedError(
+				"The \"prependFilters\" property can only be used in " +
+					"profiles with \"extends\".")
+		}
+		if _, ok := profile["appendFilters"]; ok {
+			return nil, WrappedError(
+				"The \"appendFilters\" property can only be used in " +
+					"profiles with \"extends\".")
+		}
+		return profile, nil
+	}
+	extends, ok := extendsObj.(string)
+	if !ok {
+		return nil, WrappedErrorf(jsonPathTypeError, "extends", "string")
+	}
+	base, err := resolveProfileChain(extends, profiles, chain)
+	if err != nil {
+		return nil, PassError(err)
+	}
+	baseObj, ok := base.(map[string]interface{})
+	if !ok {
+		return nil, WrappedErrorf(
+			jsonPathTypeError, "profiles->"+extends, "object")
+	}
+	result, err := mergeProfileObjects(baseObj, profile)
+	if err != nil {
+		return nil, PassError(err)
+	}
+	return result, nil
+}
+
+// mergeProfileObjects merges the object of a profile with the object of the
+// profile that it extends. The properties of the profile replace the
+// properties of the base profile (including "filters" and "export"). The
+// "prependFilters" and "appendFilters" properties add filters before and
+// after the filters of the base profile (or the replaced filters).
+func mergeProfileObjects(
+	base, profile map[string]interface{},
+) (map[string]interface{}, error) {
+	result := deepCopyJson(base).(map[string]interface{})
+	for key, value := range profile {
+		switch key {
+		case "extends", "prependFilters", "appendFilters":
+			continue
+		}
+		result[key] = deepCopyJson(value)
+	}
+	prependFilters, err := optionalArrayFromObject(profile, "prependFilters")
+	if err != nil {
+		return nil, PassError(err)
+	}
+	appendFilters, err := optionalArrayFromObject(profile, "appendFilters")
+	if err != nil {
+		return nil, PassError(err)
+	}
+	if prependFilters == nil && appendFilters == nil {
+		return result, nil
+	}
+	filters, ok := result["filters"].([]interface{})
+	if !ok {
+		return nil, WrappedErrorf(jsonPathTypeError, "filters", "array")
+	}
+	merged := []interface{}{}
+	merged = append(merged, deepCopyJson(prependFilters).([]interface{})...)
+	merged = append(merged, filters...)
+	merged = append(merged, deepCopyJson(appendFilters).([]interface{})...)
+	result["filters"] = merged
+	return result, nil
+}
+
+// optionalArrayFromObject returns the array from the property of the object
+// or nil if the property doesn't exist.
+func optionalArrayFromObject(
+	obj map[string]interface{}, property string,
+) ([]interface{}, error) {
+	value, ok := obj[property]
+	if !ok {
+		return nil, nil
+	}
+	result, ok := value.([]interface{})
+	if !ok {
+		return nil, WrappedErrorf(jsonPathTypeError, property, "array")
+	}
+	return result, nil
+}
+
+// deepCopyJson returns a deep copy of a value parsed from JSON.
+func deepCopyJson(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			result[key] = deepCopyJson(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, item := range value {
+			result[i] = deepCopyJson(item)
+		}
+		return result
+	}
+	return value
+}
@@ -0,0 +1,159 @@
+package regolith
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/otiai10/copy"
+)
+
+// tmpSnapshotsPath is the path to the directory with the snapshots of the
+// tmp directory saved after the filters, relative to the .regolith
+// directory. Every profile has its own directory with the snapshots named
+// after the indices of the filters.
+const tmpSnapshotsPath = "cache/snapshots"
+
+// profileSnapshotsPath returns the path to the directory with the snapshots
+// of the profile.
+func profileSnapshotsPath(dotRegolithPath, profileName string) string {
+	return filepath.Join(dotRegolithPath, tmpSnapshotsPath, profileName)
+}
+
+// listSnapshots returns the indices of the filters that have the snapshots
+// saved for the profile.
+func listSnapshots(dotRegolithPath, profileName string) ([]int, error) {
+	path := profileSnapshotsPath(dotRegolithPath, profileName)
+	entries, err := ioutil.ReadDir(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, WrapErrorf(err, "Failed to list the snapshots.\nPath: %s", path)
+	}
+	result := []int{}
+	for _, entry := range entries {
+		index, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		result = append(result, index)
+	}
+	return result, nil
+}
+
+// saveSnapshot saves a copy of the tmp directory after running the filter
+// with the given index.
+func saveSnapshot(dotRegolithPath, profileName string, index int) error {
+	path := filepath.Join(
+		profileSnapshotsPath(dotRegolithPath, profileName),
+		strconv.Itoa(index))
+	if err := os.RemoveAll(path); err != nil {
+		return WrapErrorf(err, osRemoveError, path)
+	}
+	tmpPath := filepath.Join(dotRegolithPath, "tmp")
+	err := copy.Copy(tmpPath, path, copy.Options{PreserveTimes: false, Sync: false})
+	if err != nil {
+		return WrapErrorf(err, osCopyError, tmpPath, path)
+	}
+	return nil
+}
+
+// clearSnapshots removes the snapshots of the filters with the index greater
+// than or equal to the given index, because they're outdated after running
+// the filters again.
+func clearSnapshots(dotRegolithPath, profileName string, from int) error {
+	indices, err := listSnapshots(dotRegolithPath, profileName)
+	if err != nil {
+		return PassError(err)
+	}
+	for _, index := range indices {
+		if index < from {
+			continue
+		}
+		path := filepath.Join(
+			profileSnapshotsPath(dotRegolithPath, profileName),
+			strconv.Itoa(index))
+		if err := os.RemoveAll(path); err != nil {
+			return WrapErrorf(err, osRemoveError, path)
+		}
+	}
+	return nil
+}
+
+// restoreSnapshot replaces the tmp directory with the latest snapshot saved
+// before the filter with the given index. It returns false if the index is
+// the index of the first filter, in which case the tmp directory should be
+// created from the source files as usual.
+func restoreSnapshot(
+	dotRegolithPath, profileName string, index int,
+) (bool, error) {
+	if index == 0 {
+		return false, nil
+	}
+	indices, err := listSnapshots(dotRegolithPath, profileName)
+	if err != nil {
+		return false, PassError(err)
+	}
+	latest := -1
+	for _, snapshotIndex := range indices {
+		if snapshotIndex < index && snapshotIndex > latest {
+			latest = snapshotIndex
+		}
+	}
+	if latest == -1 {
+		return false, WrappedErrorf(
+			"There is no snapshot of the filters before the first filter "+
+				"that runs.\nProfile: %s\n"+
+				"You can save the snapshots by running the whole profile "+
+				"with the \"--snapshots\" flag.", profileName)
+	}
+	tmpPath := filepath.Join(dotRegolithPath, "tmp")
+	if err := os.RemoveAll(tmpPath); err != nil {
+		return false, WrapErrorf(err, osRemoveError, tmpPath)
+	}
+	path := filepath.Join(
+		profileSnapshotsPath(dotRegolithPath, profileName),
+		strconv.Itoa(latest))
+	Logger.Infof("Restoring the tmp directory from the snapshot: %s", path)
+	err = copy.Copy(path, tmpPath, copy.Options{PreserveTimes: false, Sync: false})
+	if err != nil {
+		return false, WrapErrorf(err, osCopyError, path, tmpPath)
+	}
+	return true, nil
+}
+
+// setupTmpFromSnapshot prepares the snapshots for running the profile with
+// the options of the context. If the ReuseSnapshot option is enabled, it
+// restores the tmp directory from the snapshot saved before the first
+// selected filter and returns true. If the SaveSnapshots option is enabled,
+// the outdated snapshots are removed.
+func (c *RunContext) setupTmpFromSnapshot(profile Profile) (bool, error) {
+	if !c.Options.ReuseSnapshot && !c.Options.SaveSnapshots {
+		return false, nil
+	}
+	selected, err := selectFilters(profile, c.Options)
+	if err != nil {
+		return false, PassError(err)
+	}
+	first := firstSelectedFilter(selected, len(profile.Filters))
+	restored := false
+	if c.Options.ReuseSnapshot {
+		restored, err = restoreSnapshot(c.DotRegolithPath, c.Profile, first)
+		if err != nil {
+			return false, WrapError(
+				err, "Failed to restore the snapshot of the tmp directory.")
+		}
+	}
+	if c.Options.SaveSnapshots {
+		if !restored {
+			first = 0 // The whole profile runs from the source files
+		}
+		err = clearSnapshots(c.DotRegolithPath, c.Profile, first)
+		if err != nil {
+			return false, WrapError(err, "Failed to clear the snapshots.")
+		}
+	}
+	return restored, nil
+}
@@ -0,0 +1,457 @@
+package regolith
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// tracePath is the path to the directory with the trace of the last run
+// with the "--trace" flag, relative to the .regolith directory. The trace
+// has a copy of the tmp directory for every stage of the run. The files that
+// didn't change since the previous stage are hard links to the files of the
+// previous stage.
+const tracePath = "cache/trace"
+
+// traceInfoFileName is the name of the file with the list of the stages of
+// the trace.
+const traceInfoFileName = "trace.json"
+
+// traceInfo is the content of the trace.json file.
+type traceInfo struct {
+	// Profile is the name of the traced profile
+	Profile string `json:"profile"`
+
+	// Stages are the stages of the run in the order of execution. The first
+	// stage is the state of the tmp directory before running the filters.
+	Stages []traceStage `json:"stages"`
+}
+
+// traceStage is a single stage of the trace.
+type traceStage struct {
+	// Name is the name of the filter or "setup" for the first stage
+	Name string `json:"name"`
+
+	// Filter is the index of the filter in the profile, -1 for the first
+	// stage
+	Filter int `json:"filter"`
+
+	// Path is the name of the directory with the files of the stage
+	Path string `json:"path"`
+}
+
+// traceFileChange is the kind of the change of a file between two stages.
+type traceFileChange string
+
+const (
+	traceFileCopied   traceFileChange = "copied"
+	traceFileCreated  traceFileChange = "created"
+	traceFileModified traceFileChange = "modified"
+	traceFileDeleted  traceFileChange = "deleted"
+)
+
+// traceHistoryEntry is a change of a file in a stage of the trace.
+type traceHistoryEntry struct {
+	// stage is the index of the stage
+	stage int
+
+	// change is the kind of the change. The files from the first stage are
+	// copied from the source files.
+	change traceFileChange
+}
+
+// description returns the description of the change used in the text
+// output of the "regolith trace file" command.
+func (e traceHistoryEntry) description(info traceInfo) string {
+	if e.change == traceFileCopied {
+		return fmt.Sprintf(
+			"%s: copied from the source files", info.stageName(e.stage))
+	}
+	return fmt.Sprintf("%s: %s", info.stageName(e.stage), e.change)
+}
+
+// loadTraceInfo loads the trace.json file of the trace.
+func loadTraceInfo(dotRegolithPath string) (traceInfo, error) {
+	result := traceInfo{}
+	path := filepath.Join(dotRegolithPath, tracePath, traceInfoFileName)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return result, WrappedError(
+			"There is no trace of the filters.\n" +
+				"You can create it by running a profile with the \"--trace\" " +
+				"flag.")
+	}
+	if err != nil {
+		return result, WrapErrorf(err, fileReadError, path)
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return result, WrapErrorf(err, jsonUnmarshalError, path)
+	}
+	return result, nil
+}
+
+// save saves the trace.json file of the trace.
+func (t *traceInfo) save(dotRegolithPath string) error {
+	path := filepath.Join(dotRegolithPath, tracePath, traceInfoFileName)
+	data, _ := json.MarshalIndent(t, "", "\t") // no error
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return WrapErrorf(err, fileWriteError, path)
+	}
+	return nil
+}
+
+// stagePath returns the path to the directory with the files of the stage.
+func (t *traceInfo) stagePath(dotRegolithPath string, stage int) string {
+	return filepath.Join(dotRegolithPath, tracePath, t.Stages[stage].Path)
+}
+
+// stageName returns the name of the stage used in the messages.
+func (t *traceInfo) stageName(stage int) string {
+	return fmt.Sprintf("%d (%s)", stage, t.Stages[stage].Name)
+}
+
+// findStage returns the index of the stage identified by its index or by
+// the name of its filter.
+func (t *traceInfo) findStage(id string) (int, error) {
+	if index, err := strconv.Atoi(id); err == nil {
+		if index < 0 || index >= len(t.Stages) {
+			return 0, WrappedErrorf(
+				"The stage doesn't exist.\nStage: %d\nNumber of stages: %d",
+				index, len(t.Stages))
+		}
+		return index, nil
+	}
+	for i, stage := range t.Stages {
+		if stage.Name == id {
+			return i, nil
+		}
+	}
+	return 0, WrappedErrorf("The stage doesn't exist.\nStage: %s", id)
+}
+
+// startTrace removes the previous trace and saves the current state of the
+// tmp directory as the first stage of the new trace.
+func (c *RunContext) startTrace() error {
+	path := filepath.Join(c.DotRegolithPath, tracePath)
+	if err := os.RemoveAll(path); err != nil {
+		return WrapErrorf(err, osRemoveError, path)
+	}
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return WrapErrorf(err, osMkdirError, path)
+	}
+	info := traceInfo{Profile: c.Profile, Stages: []traceStage{}}
+	return c.recordTraceStage(&info, "setup", -1)
+}
+
+// traceFilter saves the current state of the tmp directory as the stage of
+// the trace after running the filter with the given index.
+func (c *RunContext) traceFilter(filter FilterRunner, index int) error {
+	info, err := loadTraceInfo(c.DotRegolithPath)
+	if err != nil {
+		return PassError(err)
+	}
+	name := filter.GetId()
+	if name == "" {
+		name = fmt.Sprintf("filter %d", index)
+	}
+	return c.recordTraceStage(&info, name, index)
+}
+
+// recordTraceStage adds a stage with the current state of the tmp directory
+// to the trace.
+func (c *RunContext) recordTraceStage(
+	info *traceInfo, name string, filter int,
+) error {
+	stage := traceStage{
+		Name: name, Filter: filter, Path: strconv.Itoa(len(info.Stages))}
+	previous := ""
+	if len(info.Stages) > 0 {
+		previous = info.stagePath(c.DotRegolithPath, len(info.Stages)-1)
+	}
+	info.Stages = append(info.Stages, stage)
+	err := snapshotDir(
+		filepath.Join(c.DotRegolithPath, "tmp"),
+		info.stagePath(c.DotRegolithPath, len(info.Stages)-1), previous)
+	if err != nil {
+		return WrapErrorf(err, "Failed to save the stage of the trace.\n"+
+			"Stage: %s", name)
+	}
+	if err := info.save(c.DotRegolithPath); err != nil {
+		return PassError(err)
+	}
+	return nil
+}
+
+// snapshotDir copies the files from the source directory to the target
+// directory. The files that have the same content as the files with the same
+// paths in the previous directory are hard links to the files of the
+// previous directory if possible. The previous directory can be empty.
+func snapshotDir(source, target, previous string) error {
+	return filepath.WalkDir(
+		source, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			relPath, err := filepath.Rel(source, path)
+			if err != nil {
+				return WrapErrorf(err, filepathRelError, source, path)
+			}
+			targetPath := filepath.Join(target, relPath)
+			if d.IsDir() {
+				if err := os.MkdirAll(targetPath, 0755); err != nil {
+					return WrapErrorf(err, osMkdirError, targetPath)
+				}
+				return nil
+			}
+			if previous != "" {
+				previousPath := filepath.Join(previous, relPath)
+				same, err := sameFileContent(path, previousPath)
+				if err != nil {
+					return PassError(err)
+				}
+				if same && os.Link(previousPath, targetPath) == nil {
+					return nil
+				}
+			}
+			if err := CopyFile(path, targetPath); err != nil {
+				return WrapErrorf(err, osCopyError, path, targetPath)
+			}
+			return nil
+		})
+}
+
+// sameFileContent returns true if both files exist and have the same
+// content.
+func sameFileContent(path1, path2 string) (bool, error) {
+	stat1, err1 := os.Stat(path1)
+	stat2, err2 := os.Stat(path2)
+	if err1 != nil || err2 != nil || stat1.IsDir() || stat2.IsDir() {
+		return false, nil
+	}
+	if os.SameFile(stat1, stat2) {
+		return true, nil
+	}
+	if stat1.Size() != stat2.Size() {
+		return false, nil
+	}
+	data1, err := ioutil.ReadFile(path1)
+	if err != nil {
+		return false, WrapErrorf(err, fileReadError, path1)
+	}
+	data2, err := ioutil.ReadFile(path2)
+	if err != nil {
+		return false, WrapErrorf(err, fileReadError, path2)
+	}
+	return bytes.Equal(data1, data2), nil
+}
+
+// listStageFiles returns the paths of the files of a stage relative to the
+// directory of the stage, using the forward slashes.
+func listStageFiles(stagePath string) (map[string]struct{}, error) {
+	result := map[string]struct{}{}
+	err := filepath.WalkDir(
+		stagePath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			relPath, err := filepath.Rel(stagePath, path)
+			if err != nil {
+				return WrapErrorf(err, filepathRelError, stagePath, path)
+			}
+			result[filepath.ToSlash(relPath)] = struct{}{}
+			return nil
+		})
+	if err != nil {
+		return nil, WrapErrorf(
+			err, "Failed to list the files of the stage.\nPath: %s", stagePath)
+	}
+	return result, nil
+}
+
+// compareStages returns the changes of the files between two stages of the
+// trace, sorted by the paths of the files.
+func compareStages(
+	fromPath, toPath string,
+) ([]string, map[string]traceFileChange, error) {
+	fromFiles, err := listStageFiles(fromPath)
+	if err != nil {
+		return nil, nil, PassError(err)
+	}
+	toFiles, err := listStageFiles(toPath)
+	if err != nil {
+		return nil, nil, PassError(err)
+	}
+	changes := map[string]traceFileChange{}
+	for path := range toFiles {
+		if _, ok := fromFiles[path]; !ok {
+			changes[path] = traceFileCreated
+			continue
+		}
+		same, err := sameFileContent(
+			filepath.Join(fromPath, path), filepath.Join(toPath, path))
+		if err != nil {
+			return nil, nil, PassError(err)
+		}
+		if !same {
+			changes[path] = traceFileModified
+		}
+	}
+	for path := range fromFiles {
+		if _, ok := toFiles[path]; !ok {
+			changes[path] = traceFileDeleted
+		}
+	}
+	paths := make([]string, 0, len(changes))
+	for path := range changes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths, changes, nil
+}
+
+// traceFileHistory returns the changes of the file in every stage of the
+// trace. The stages that didn't change the file are skipped.
+func traceFileHistory(
+	info traceInfo, dotRegolithPath, file string,
+) ([]traceHistoryEntry, error) {
+	result := []traceHistoryEntry{}
+	var previous string
+	for i := range info.Stages {
+		path := filepath.Join(info.stagePath(dotRegolithPath, i), file)
+		_, err := os.Stat(path)
+		exists := err == nil
+		var change traceFileChange
+		switch {
+		case i == 0 && exists:
+			change = traceFileCopied
+		case previous == "" && exists:
+			change = traceFileCreated
+		case previous != "" && !exists:
+			change = traceFileDeleted
+		case previous != "" && exists:
+			same, err := sameFileContent(previous, path)
+			if err != nil {
+				return nil, PassError(err)
+			}
+			if !same {
+				change = traceFileModified
+			}
+		}
+		if change != "" {
+			result = append(result, traceHistoryEntry{stage: i, change: change})
+		}
+		previous = ""
+		if exists {
+			previous = path
+		}
+	}
+	return result, nil
+}
+
+// diffLines returns a unified diff of two texts with 3 lines of context.
+func diffLines(from, to string) string {
+	a := strings.Split(from, "\n")
+	b := strings.Split(to, "\n")
+	// The longest common subsequence of the lines
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	// The lines with the prefixes of the diff
+	lines := []string{}
+	for i, j := 0, 0; i < len(a) || j < len(b); {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, " "+a[i])
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			lines = append(lines, "+"+b[j])
+			j++
+		default:
+			lines = append(lines, "-"+a[i])
+			i++
+		}
+	}
+	// Only the changed lines with their context
+	const context = 3
+	var result strings.Builder
+	lastPrinted := -1
+	for i, line := range lines {
+		near := false
+		for k := i - context; k <= i+context; k++ {
+			if k >= 0 && k < len(lines) && lines[k][0] != ' ' {
+				near = true
+				break
+			}
+		}
+		if !near {
+			continue
+		}
+		if lastPrinted != i-1 {
+			result.WriteString("@@\n")
+		}
+		result.WriteString(line + "\n")
+		lastPrinted = i
+	}
+	return result.String()
+}
+
+// maxDiffLines is the maximal product of the numbers of the lines of the
+// files compared by diffFiles. Larger files are only reported as different.
+const maxDiffLines = 4_000_000
+
+// diffFiles returns the diff of the file between two stages. Missing files
+// are treated as empty files.
+func diffFiles(fromPath, toPath string) (string, error) {
+	readFile := func(path string) ([]byte, error) {
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			return []byte{}, nil
+		}
+		if err != nil {
+			return nil, WrapErrorf(err, fileReadError, path)
+		}
+		return data, nil
+	}
+	from, err := readFile(fromPath)
+	if err != nil {
+		return "", PassError(err)
+	}
+	to, err := readFile(toPath)
+	if err != nil {
+		return "", PassError(err)
+	}
+	if bytes.Equal(from, to) {
+		return "", nil
+	}
+	if bytes.IndexByte(from, 0) != -1 || bytes.IndexByte(to, 0) != -1 {
+		return "Binary files differ\n", nil
+	}
+	if (bytes.Count(from, []byte("\n"))+1)*(bytes.Count(to, []byte("\n"))+1) >
+		maxDiffLines {
+		return "The files are too large to show the differences\n", nil
+	}
+	return diffLines(string(from), string(to)), nil
+}
@@ -0,0 +1,47 @@
+package regolith
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"muzzammil.xyz/jsonc"
+)
+
+// userConfigFileName is the name of the file with the global settings of
+// Regolith, stored in the path returned by GetRegolithConfigPath.
+const userConfigFileName = "user_config.json"
+
+// UserConfig represents the global settings of Regolith shared between all of
+// the projects of the user. The settings are saved in "user_config.json".
+type UserConfig struct {
+	// ComMojangPath overrides the path to the com.mojang directory
+	ComMojangPath string `json:"comMojangPath,omitempty"`
+
+	// ComMojangPreviewPath overrides the path to the com.mojang directory of
+	// Minecraft Preview
+	ComMojangPreviewPath string `json:"comMojangPreviewPath,omitempty"`
+}
+
+// LoadUserConfig loads the global settings of Regolith. If the file with the
+// settings doesn't exist, it returns an empty UserConfig.
+func LoadUserConfig() (UserConfig, error) {
+	result := UserConfig{}
+	path, err := GetRegolithConfigPath()
+	if err != nil {
+		return result, WrapError(err, getRegolithConfigPathError)
+	}
+	path = filepath.Join(path, userConfigFileName)
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, nil
+		}
+		return result, WrapErrorf(err, fileReadError, path)
+	}
+	err = jsonc.Unmarshal(file, &result)
+	if err != nil {
+		return result, WrapErrorf(err, jsonUnmarshalError, path)
+	}
+	return result, nil
+}
@@ -2,9 +2,10 @@ package regolith
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/hex"
-	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -60,14 +61,43 @@ func firstErr(errors ...error) error {
 	return nil
 }
 
+// wrappedError is the error created by the WrapError family of functions.
+// Apart from the text with the stack traces, it stores the plain messages of
+// the wrapped errors, used by ErrorChain.
+type wrappedError struct {
+	// text is the full text of the error, with the messages of the wrapped
+	// errors and the stack traces
+	text string
+
+	// chain is the list of the messages of the error and the errors wrapped
+	// by it, starting from the outermost one
+	chain []string
+}
+
+func (e *wrappedError) Error() string {
+	return e.text
+}
+
+// errorChain returns the messages of the error and the errors wrapped by it,
+// starting from the outermost one. The errors that weren't created by the
+// WrapError family of functions have only one message.
+func errorChain(err error) []string {
+	if err, ok := err.(*wrappedError); ok {
+		return err.chain
+	}
+	return []string{err.Error()}
+}
+
 // wrapErrorStackTrace is used by other wrapped error functions to add a stack
 // trace to the error message.
 func wrapErrorStackTrace(err error, text string) error {
+	chain := []string{text}
 	text = strings.Replace(text, "\n", color.YellowString("\n   >> "), -1)
 
 	if err != nil {
 		text = fmt.Sprintf(
 			"%s\n[%s]: %s", text, color.RedString("+"), err.Error())
+		chain = append(chain, errorChain(err)...)
 	}
 	if printStackTraces {
 		pc, fn, line, _ := runtime.Caller(2)
@@ -75,7 +105,7 @@ func wrapErrorStackTrace(err error, text string) error {
 			"%s\n   [%s] %s:%d", text, runtime.FuncForPC(pc).Name(),
 			filepath.Base(fn), line)
 	}
-	return errors.New(text)
+	return &wrappedError{text: text, chain: chain}
 }
 
 func FullFilterToNiceFilterName(name string) string {
@@ -109,7 +139,7 @@ func PassError(err error) error {
 			"%s\n   [%s] %s:%d", text, runtime.FuncForPC(pc).Name(),
 			filepath.Base(fn), line)
 	}
-	return errors.New(text)
+	return &wrappedError{text: text, chain: errorChain(err)}
 }
 
 // NotImplementedError is used by default functions, that need implementation.
@@ -141,6 +171,27 @@ func WrapErrorf(err error, text string, args ...interface{}) error {
 	return wrapErrorStackTrace(err, fmt.Sprintf(text, args...))
 }
 
+// WrapErrorsf wraps multiple errors with a stack trace and adds additional
+// formatted text information. It's used when multiple independent operations
+// fail and all of the errors should be reported.
+func WrapErrorsf(errs []error, text string, args ...interface{}) error {
+	text = fmt.Sprintf(text, args...)
+	chain := []string{text}
+	text = strings.Replace(text, "\n", color.YellowString("\n   >> "), -1)
+	for _, err := range errs {
+		text = fmt.Sprintf(
+			"%s\n[%s]: %s", text, color.RedString("+"), err.Error())
+		chain = append(chain, errorChain(err)...)
+	}
+	if printStackTraces {
+		pc, fn, line, _ := runtime.Caller(1)
+		text = fmt.Sprintf(
+			"%s\n   [%s] %s:%d", text, runtime.FuncForPC(pc).Name(),
+			filepath.Base(fn), line)
+	}
+	return &wrappedError{text: text, chain: chain}
+}
+
 func CreateDirectoryIfNotExists(directory string, mustSucceed bool) error {
 	if _, err := os.Stat(directory); os.IsNotExist(err) {
 		err = os.MkdirAll(directory, 0755)
@@ -182,28 +233,116 @@ func CreateEnvironmentVariables(filterDir string) ([]string, error) {
 // RunSubProcess runs a sub-process with specified arguments and working
 // directory
 func RunSubProcess(command string, args []string, filterDir string, workingDir string, outputLabel string) error {
+	return RunSubProcessContext(
+		context.Background(), command, args, filterDir, workingDir, outputLabel)
+}
+
+// RunSubProcessContext works like RunSubProcess, but it kills the sub-process
+// and all of its children when the ctx is done. If the ctx can't be canceled
+// (like context.Background()), the sub-process isn't moved to its own process
+// group, so it stops together with Regolith when the user presses Ctrl+C.
+func RunSubProcessContext(
+	ctx context.Context, command string, args []string, filterDir string,
+	workingDir string, outputLabel string,
+) error {
+	return runSubProcess(
+		ctx, command, args, filterDir, workingDir, outputLabel, nil, nil, "",
+		func(in io.ReadCloser) { go LogStd(in, "stdout", outputLabel) })
+}
+
+// runSubProcess works like RunSubProcessContext, but it writes the stdin to
+// the standard input of the sub-process (unless it's nil), adds the env
+// ("NAME=value") to its environment variables and uses the logStdout
+// function to log its standard output. The logStdout function finishes
+// before runSubProcess returns. If the commandLine isn't empty, it replaces
+// the command line built from the command and the args on Windows.
+func runSubProcess(
+	ctx context.Context, command string, args []string, filterDir string,
+	workingDir string, outputLabel string, stdin []byte, env []string,
+	commandLine string, logStdout func(in io.ReadCloser),
+) error {
 	Logger.Debugf("Exec: %s %s", command, strings.Join(args, " "))
 	cmd := exec.Command(command, args...)
 	cmd.Dir = workingDir
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	if ctx.Done() != nil {
+		// Only the processes that can be killed by Regolith run in their
+		// own process groups. The others (e.g. the installations of the
+		// dependencies) receive Ctrl+C from the terminal.
+		setProcessGroup(cmd)
+	}
+	if commandLine != "" {
+		setCommandLine(cmd, commandLine)
+	}
 	out, _ := cmd.StdoutPipe()
 	err, _ := cmd.StderrPipe()
-	go LogStd(out, Logger.Infof, outputLabel)
-	go LogStd(err, Logger.Errorf, outputLabel)
-	env, err1 := CreateEnvironmentVariables(filterDir)
+	stdoutDone := make(chan struct{})
+	go func() {
+		logStdout(out)
+		close(stdoutDone)
+	}()
+	go LogStd(err, "stderr", outputLabel)
+	cmdEnv, err1 := CreateEnvironmentVariables(filterDir)
 	if err1 != nil {
 		return WrapErrorf(
 			err1,
 			"Failed to create FILTER_DIR and ROOT_DIR environment variables.")
 	}
-	cmd.Env = env
+	cmd.Env = append(cmdEnv, env...)
 
-	return cmd.Run()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		// The output must be read before waiting for the process
+		<-stdoutDone
+		done <- cmd.Wait()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		err := killProcessTree(cmd.Process)
+		<-done
+		if err != nil {
+			return WrapErrorf(
+				err, "Failed to kill the process.\nCommand: %s", command)
+		}
+		return WrappedErrorf("The process was killed.\nCommand: %s", command)
+	}
 }
 
-func LogStd(in io.ReadCloser, logFunc func(template string, args ...interface{}), outputLabel string) {
+// LogStd logs the lines of the output of a sub process. The stream is the
+// name of the output ("stdout" or "stderr"). The lines from stderr are logged
+// as errors.
+func LogStd(in io.ReadCloser, stream string, outputLabel string) {
 	scanner := bufio.NewScanner(in)
 	for scanner.Scan() {
-		logFunc("[%s] %s", outputLabel, scanner.Text())
+		logStdLine(scanner.Text(), stream, outputLabel)
+	}
+}
+
+// logStdLine logs a line of the output of a sub process like LogStd.
+func logStdLine(line, stream, outputLabel string) {
+	if IsJsonOutput() {
+		fields := []interface{}{
+			"event", subprocessOutputEvent, "filter", outputLabel,
+			"stream", stream, "line", line}
+		message := fmt.Sprintf("[%s] %s", outputLabel, line)
+		if stream == "stderr" {
+			Logger.Errorw(message, fields...)
+		} else {
+			Logger.Infow(message, fields...)
+		}
+		return
+	}
+	if stream == "stderr" {
+		Logger.Errorf("[%s] %s", outputLabel, line)
+	} else {
+		Logger.Infof("[%s] %s", outputLabel, line)
 	}
 }
 
@@ -0,0 +1,309 @@
+package regolith
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ConfigProblem is a single problem found in the config file by
+// ValidateConfig.
+type ConfigProblem struct {
+	// JsonPath is the path to the invalid part of the config file
+	JsonPath string
+
+	// Err is the error that describes the problem
+	Err error
+}
+
+// configValidator collects the problems found in the config file.
+type configValidator struct {
+	problems []ConfigProblem
+	reported map[string]struct{}
+}
+
+// add adds a problem to the list unless the same problem was already
+// reported for the same JSON path.
+func (v *configValidator) add(jsonPath string, err error) {
+	key := jsonPath + "\n" + err.Error()
+	if _, ok := v.reported[key]; ok {
+		return
+	}
+	v.reported[key] = struct{}{}
+	v.problems = append(v.problems, ConfigProblem{JsonPath: jsonPath, Err: err})
+}
+
+// sortedKeys returns the keys of the map sorted alphabetically, so the
+// problems are always reported in the same order.
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ValidateConfig checks the config file loaded with LoadConfigAsMap and
+// returns all of the problems found in it. Unlike ConfigFromObject, it
+// doesn't stop on the first problem. It uses the same functions to parse the
+// parts of the config, so the problems match the errors that would be
+// reported when running Regolith.
+func ValidateConfig(obj map[string]interface{}) []ConfigProblem {
+	v := &configValidator{reported: map[string]struct{}{}}
+	// Placeholders
+	obj, problems := interpolateConfig(obj)
+	for _, problem := range problems {
+		v.add(problem.JsonPath, problem.Err)
+	}
+	// Name and author
+	for _, property := range []string{"name", "author"} {
+		value, ok := obj[property]
+		if !ok {
+			v.add(property, WrappedErrorf(jsonPathMissingError, property))
+		} else if _, ok := value.(string); !ok {
+			v.add(property, WrappedErrorf(jsonPathTypeError, property, "string"))
+		}
+	}
+	// Packs
+	if packs, ok := obj["packs"]; !ok {
+		v.add("packs", WrappedErrorf(jsonPathMissingError, "packs"))
+	} else if packs, ok := packs.(map[string]interface{}); !ok {
+		v.add("packs", WrappedErrorf(jsonPathTypeError, "packs", "object"))
+	} else {
+		for _, property := range []string{"behaviorPack", "resourcePack"} {
+			if value, ok := packs[property]; ok {
+				if _, ok := value.(string); !ok {
+					jsonPath := "packs->" + property
+					v.add(jsonPath, WrappedErrorf(
+						jsonPathTypeError, jsonPath, "string"))
+				}
+			}
+		}
+	}
+	// Regolith
+	regolithObj, ok := obj["regolith"]
+	if !ok {
+		v.add("regolith", WrappedErrorf(jsonPathMissingError, "regolith"))
+		return v.problems
+	}
+	regolith, ok := regolithObj.(map[string]interface{})
+	if !ok {
+		v.add("regolith", WrappedErrorf(jsonPathTypeError, "regolith", "object"))
+		return v.problems
+	}
+	v.validateRegolithProject(regolith)
+	return v.problems
+}
+
+// validateRegolithProject checks the "regolith" property of the config file.
+func (v *configValidator) validateRegolithProject(obj map[string]interface{}) {
+	config := &Config{
+		RegolithProject: RegolithProject{
+			Profiles:          map[string]Profile{},
+			FilterDefinitions: map[string]FilterInstaller{},
+		},
+	}
+	// DataPath
+	if dataPath, ok := obj["dataPath"]; !ok {
+		v.add("regolith->dataPath", WrappedErrorf(
+			jsonPathMissingError, "regolith->dataPath"))
+	} else if _, ok := dataPath.(string); !ok {
+		v.add("regolith->dataPath", WrappedErrorf(
+			jsonPathTypeError, "regolith->dataPath", "string"))
+	}
+	// UseAppData
+	if useAppData, ok := obj["useAppData"]; ok {
+		if _, ok := useAppData.(bool); !ok {
+			v.add("regolith->useAppData", WrappedErrorf(
+				jsonPathTypeError, "regolith->useAppData", "boolean"))
+		}
+	}
+	// Filter definitions. The names of the invalid definitions are
+	// remembered to avoid reporting the filters that use them as undefined.
+	invalidDefinitions := map[string]struct{}{}
+	if definitionsObj, ok := obj["filterDefinitions"]; ok {
+		definitions, ok := definitionsObj.(map[string]interface{})
+		if !ok {
+			v.add("regolith->filterDefinitions", WrappedErrorf(
+				jsonPathTypeError, "regolith->filterDefinitions", "object"))
+		}
+		for _, name := range sortedKeys(definitions) {
+			jsonPath := "regolith->filterDefinitions->" + name
+			invalidDefinitions[name] = struct{}{}
+			definition, ok := definitions[name].(map[string]interface{})
+			if !ok {
+				v.add(jsonPath, WrappedErrorf(
+					jsonPathTypeError, jsonPath, "object"))
+				continue
+			}
+			filterInstaller, err := FilterInstallerFromObject(name, definition)
+			if err != nil {
+				v.add(jsonPath, err)
+				continue
+			}
+			delete(invalidDefinitions, name)
+			config.FilterDefinitions[name] = filterInstaller
+		}
+	}
+	// Profiles
+	profilesObj, ok := obj["profiles"]
+	if !ok {
+		v.add("regolith->profiles", WrappedErrorf(
+			jsonPathMissingError, "regolith->profiles"))
+		return
+	}
+	profiles, ok := profilesObj.(map[string]interface{})
+	if !ok {
+		v.add("regolith->profiles", WrappedErrorf(
+			jsonPathTypeError, "regolith->profiles", "object"))
+		return
+	}
+	incompleteProfiles := map[string]struct{}{}
+	for _, name := range sortedKeys(profiles) {
+		jsonPath := "regolith->profiles->" + name
+		profileObj, err := resolveProfile(name, profiles)
+		if err != nil {
+			v.add(jsonPath, err)
+			continue
+		}
+		profile, ok := profileObj.(map[string]interface{})
+		if !ok {
+			v.add(jsonPath, WrappedErrorf(jsonPathTypeError, jsonPath, "object"))
+			continue
+		}
+		profileValue, ok := v.validateProfile(
+			jsonPath, profile, config.FilterDefinitions, invalidDefinitions)
+		config.Profiles[name] = profileValue
+		if !ok {
+			incompleteProfiles[name] = struct{}{}
+		}
+	}
+	// Check the relations between the profiles and the filters. The profiles
+	// with invalid filters are skipped, because the problems with the
+	// missing filters would be reported again.
+	for _, name := range sortedKeys(profiles) {
+		profile, ok := config.Profiles[name]
+		if !ok {
+			continue
+		}
+		if _, ok := incompleteProfiles[name]; ok {
+			continue
+		}
+		jsonPath := "regolith->profiles->" + name
+		err := checkFilterDependencies(profile, name)
+		if err != nil {
+			v.add(jsonPath+"->filters", err)
+		}
+		v.validateNestedProfiles(config, incompleteProfiles, name, nil)
+	}
+}
+
+// validateProfile checks a single profile and returns the part of the profile
+// that was parsed successfully. The returned bool is false if some of the
+// filters of the profile are invalid.
+func (v *configValidator) validateProfile(
+	jsonPath string, obj map[string]interface{},
+	filterDefinitions map[string]FilterInstaller,
+	invalidDefinitions map[string]struct{},
+) (Profile, bool) {
+	result := Profile{}
+	complete := true
+	// Filters
+	if filtersObj, ok := obj["filters"]; !ok {
+		v.add(jsonPath+"->filters", WrappedErrorf(
+			jsonPathMissingError, jsonPath+"->filters"))
+	} else if filters, ok := filtersObj.([]interface{}); !ok {
+		v.add(jsonPath+"->filters", WrappedErrorf(
+			jsonPathTypeError, jsonPath+"->filters", "array"))
+	} else {
+		for i, filterObj := range filters {
+			filterPath := fmt.Sprintf("%s->filters->%d", jsonPath, i)
+			filter, ok := filterObj.(map[string]interface{})
+			if !ok {
+				v.add(filterPath, WrappedErrorf(
+					jsonPathTypeError, filterPath, "object"))
+				complete = false
+				continue
+			}
+			// The problems with the definition are already reported
+			if name, ok := filter["filter"].(string); ok {
+				if _, ok := invalidDefinitions[name]; ok {
+					complete = false
+					continue
+				}
+			}
+			filterRunner, err := FilterRunnerFromObjectAndDefinitions(
+				filter, filterDefinitions)
+			if err != nil {
+				v.add(filterPath, err)
+				complete = false
+				continue
+			}
+			result.Filters = append(result.Filters, filterRunner)
+		}
+	}
+	// Export targets
+	exportPath := jsonPath + "->export"
+	exportObj, ok := obj["export"]
+	exports := map[string]interface{}{exportPath: exportObj}
+	if !ok {
+		v.add(exportPath, WrappedErrorf(jsonPathMissingError, exportPath))
+		exports = nil
+	} else if exportList, ok := exportObj.([]interface{}); ok {
+		if len(exportList) == 0 {
+			v.add(exportPath, WrappedError(
+				"The list of the export targets can't be empty."))
+		}
+		exports = map[string]interface{}{}
+		for i, export := range exportList {
+			exports[fmt.Sprintf("%s->%d", exportPath, i)] = export
+		}
+	}
+	for _, path := range sortedKeys(exports) {
+		if export, ok := exports[path].(map[string]interface{}); !ok {
+			v.add(path, WrappedErrorf(jsonPathTypeError, path, "object"))
+		} else if exportTarget, err := ExportTargetFromObject(export); err != nil {
+			v.add(path, err)
+		} else if err := validateExportTarget(exportTarget); err != nil {
+			v.add(path, err)
+		} else {
+			result.ExportTargets = append(result.ExportTargets, exportTarget)
+		}
+	}
+	// Other properties
+	if err := profileOptionsFromObject(obj, &result); err != nil {
+		v.add(jsonPath, err)
+	}
+	return result, complete
+}
+
+// validateNestedProfiles checks the references to the nested profiles in the
+// profile, the same way as ProfileFilter.Check does it, and recursively
+// checks the nested profiles, unless they are incomplete.
+func (v *configValidator) validateNestedProfiles(
+	config *Config, incompleteProfiles map[string]struct{},
+	profileName string, parent *RunContext,
+) {
+	context := RunContext{
+		Config:  config,
+		Profile: profileName,
+		Parent:  parent,
+	}
+	for i, filter := range config.Profiles[profileName].Filters {
+		profileFilter, ok := filter.(*ProfileFilter)
+		if !ok {
+			continue
+		}
+		_, err := profileFilter.checkReference(context)
+		if err != nil {
+			v.add(fmt.Sprintf(
+				"regolith->profiles->%s->filters->%d", profileName, i), err)
+			continue
+		}
+		if _, ok := incompleteProfiles[profileFilter.Profile]; ok {
+			continue
+		}
+		v.validateNestedProfiles(
+			config, incompleteProfiles, profileFilter.Profile, &context)
+	}
+}
@@ -0,0 +1,391 @@
+package regolith
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// The versions of the remote filters can be semver ranges, like in npm or
+// cargo. A range is a list of comparator sets separated with "||". A
+// version matches the range if it satisfies all of the comparators of any
+// of the sets. The comparators are separated with spaces:
+//   - "^1.2.3" allows the changes that don't modify the left-most non-zero
+//     number (>=1.2.3 <2.0.0, ^0.2.3 is >=0.2.3 <0.3.0),
+//   - "~1.2.3" allows the patch updates (>=1.2.3 <1.3.0),
+//   - ">=1.2.3", ">1.2.3", "<=1.2.3", "<1.2.3" and "=1.2.3" compare the
+//     versions,
+//   - "1.2.x", "1.x" and "*" are wildcards.
+// The versions in the comparators can be partial ("^1.2", ">=2", "<3").
+// The pre-release versions match the range only if one of the comparators
+// of the set has a pre-release version with the same major, minor and
+// patch numbers.
+
+// versionRange is a parsed semver range.
+type versionRange struct {
+	// sets are the comparator sets separated with "||"
+	sets [][]versionComparator
+}
+
+// versionComparator is a comparison with a version, to which all of the
+// other kinds of the comparators are converted.
+type versionComparator struct {
+	// operator is one of "=", ">", ">=", "<" or "<="
+	operator string
+
+	// version is a canonical semver with the "v" prefix
+	version string
+}
+
+// partialVersion is a version from a comparator, which can have missing or
+// wildcard numbers.
+type partialVersion struct {
+	// numbers are the major, minor and patch numbers, the missing numbers
+	// are 0
+	numbers [3]int
+
+	// known is the number of the numbers that are specified
+	known int
+
+	// prerelease is the pre-release part of the version with the leading
+	// "-" or an empty string
+	prerelease string
+}
+
+// isVersionRange returns true if the version of a remote filter is a semver
+// range. The exact versions, the commit SHAs and the "HEAD" and "latest"
+// keywords aren't ranges.
+func isVersionRange(version string) bool {
+	if version == "" || version == "HEAD" || version == "latest" ||
+		semver.IsValid("v"+version) || isCommitSha(version) {
+		return false
+	}
+	_, err := parseVersionRange(version)
+	return err == nil
+}
+
+// parseVersionRange parses the semver range.
+func parseVersionRange(text string) (versionRange, error) {
+	result := versionRange{}
+	for _, setText := range strings.Split(text, "||") {
+		fields := strings.Fields(setText)
+		if len(fields) == 0 {
+			return result, WrappedErrorf(
+				"The version range has an empty comparator set.\nRange: %s",
+				text)
+		}
+		set := []versionComparator{}
+		for i := 0; i < len(fields); i++ {
+			field := fields[i]
+			// Allow spaces between the operators and the versions
+			if strings.Trim(field, "^~<>=") == "" && i+1 < len(fields) {
+				i++
+				field += fields[i]
+			}
+			comparators, err := parseVersionComparator(field)
+			if err != nil {
+				return result, WrapErrorf(
+					err, "Failed to parse the version range.\nRange: %s", text)
+			}
+			set = append(set, comparators...)
+		}
+		result.sets = append(result.sets, set)
+	}
+	return result, nil
+}
+
+// parseVersionComparator parses a single comparator of a semver range and
+// converts it to the comparisons with the versions.
+func parseVersionComparator(text string) ([]versionComparator, error) {
+	operator := ""
+	for _, op := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(text, op) {
+			operator = op
+			break
+		}
+	}
+	v, err := parsePartialVersion(strings.TrimPrefix(text, operator))
+	if err != nil {
+		return nil, WrapErrorf(err, "Invalid comparator.\nComparator: %s", text)
+	}
+	major, minor, patch := v.numbers[0], v.numbers[1], v.numbers[2]
+	lower := v.version(major, minor, patch)
+	anyVersion := []versionComparator{{">=", "v0.0.0"}}
+	noVersion := []versionComparator{{"<", "v0.0.0"}}
+	between := func(upper string) []versionComparator {
+		return []versionComparator{{">=", lower}, {"<", upper}}
+	}
+	if v.known == 0 { // "*", "x", "^*", ">=*", etc.
+		if operator == ">" || operator == "<" {
+			return noVersion, nil
+		}
+		return anyVersion, nil
+	}
+	switch operator {
+	case "", "=":
+		switch v.known {
+		case 1:
+			return between(v.version(major+1, 0, 0)), nil
+		case 2:
+			return between(v.version(major, minor+1, 0)), nil
+		}
+		return []versionComparator{{"=", lower}}, nil
+	case "^":
+		if major > 0 || v.known == 1 {
+			return between(v.version(major+1, 0, 0)), nil
+		}
+		if minor > 0 || v.known == 2 {
+			return between(v.version(0, minor+1, 0)), nil
+		}
+		return between(v.version(0, 0, patch+1)), nil
+	case "~":
+		if v.known == 1 {
+			return between(v.version(major+1, 0, 0)), nil
+		}
+		return between(v.version(major, minor+1, 0)), nil
+	case ">=", "<":
+		return []versionComparator{{operator, lower}}, nil
+	case ">":
+		switch v.known {
+		case 1:
+			return []versionComparator{{">=", v.version(major+1, 0, 0)}}, nil
+		case 2:
+			return []versionComparator{{">=", v.version(major, minor+1, 0)}}, nil
+		}
+		return []versionComparator{{">", lower}}, nil
+	case "<=":
+		switch v.known {
+		case 1:
+			return []versionComparator{{"<", v.version(major+1, 0, 0)}}, nil
+		case 2:
+			return []versionComparator{{"<", v.version(major, minor+1, 0)}}, nil
+		}
+		return []versionComparator{{"<=", lower}}, nil
+	}
+	return nil, nil // Unreachable, all of the operators are handled
+}
+
+// parsePartialVersion parses the version from a comparator of a semver
+// range. The build metadata is ignored.
+func parsePartialVersion(text string) (partialVersion, error) {
+	result := partialVersion{}
+	text = strings.TrimPrefix(text, "v")
+	if i := strings.Index(text, "+"); i != -1 {
+		text = text[:i]
+	}
+	if i := strings.Index(text, "-"); i != -1 {
+		text, result.prerelease = text[:i], text[i:]
+	}
+	parts := strings.Split(text, ".")
+	if text == "" || len(parts) > 3 {
+		return result, WrappedErrorf("Invalid version.\nVersion: %s", text)
+	}
+	wildcard := false
+	for i, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			wildcard = true
+			continue
+		}
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 || wildcard {
+			return result, WrappedErrorf(
+				"Invalid version.\nVersion: %s", text)
+		}
+		result.numbers[i] = number
+		result.known = i + 1
+	}
+	if result.prerelease != "" &&
+		(result.known != 3 || !semver.IsValid("v0.0.0"+result.prerelease)) {
+		return result, WrappedErrorf(
+			"Invalid pre-release version.\nVersion: %s%s",
+			text, result.prerelease)
+	}
+	return result, nil
+}
+
+// version returns the canonical semver with the numbers. The pre-release
+// part of the partial version is kept only if the numbers are the same.
+func (v partialVersion) version(major, minor, patch int) string {
+	result := fmt.Sprintf("v%d.%d.%d", major, minor, patch)
+	if [3]int{major, minor, patch} == v.numbers {
+		result += v.prerelease
+	}
+	return result
+}
+
+// matches returns true if the version satisfies the comparator.
+func (c versionComparator) matches(version string) bool {
+	comparison := semver.Compare(version, c.version)
+	switch c.operator {
+	case "=":
+		return comparison == 0
+	case ">":
+		return comparison > 0
+	case ">=":
+		return comparison >= 0
+	case "<":
+		return comparison < 0
+	case "<=":
+		return comparison <= 0
+	}
+	return false
+}
+
+// matches returns true if the version (without the "v" prefix) satisfies
+// the range.
+func (r versionRange) matches(version string) bool {
+	version = "v" + version
+	if !semver.IsValid(version) {
+		return false
+	}
+	prerelease := semver.Prerelease(version)
+	release := strings.TrimSuffix(semver.Canonical(version), prerelease)
+	for _, set := range r.sets {
+		matchesSet := true
+		allowsPrerelease := prerelease == ""
+		for _, comparator := range set {
+			if !comparator.matches(version) {
+				matchesSet = false
+				break
+			}
+			comparatorPrerelease := semver.Prerelease(comparator.version)
+			if comparatorPrerelease != "" && strings.TrimSuffix(
+				comparator.version, comparatorPrerelease) == release {
+				allowsPrerelease = true
+			}
+		}
+		if matchesSet && allowsPrerelease {
+			return true
+		}
+	}
+	return false
+}
+
+// versionRangeMatches returns true if the version (without the "v" prefix)
+// satisfies the semver range. It returns false if the range is invalid.
+func versionRangeMatches(versionRangeText, version string) bool {
+	r, err := parseVersionRange(versionRangeText)
+	return err == nil && r.matches(version)
+}
+
+// isSemverConstraint returns true if the version of a remote filter is a
+// semver range or an exact semantic version.
+func isSemverConstraint(version string) bool {
+	return semver.IsValid("v"+version) || isVersionRange(version)
+}
+
+// intersectVersionRanges returns a semver range that matches the versions
+// that satisfy both of the semver constraints (ranges or exact versions).
+// The comparator sets of the constraints are combined in every possible
+// way.
+func intersectVersionRanges(a, b string) string {
+	sets := []string{}
+	for _, setA := range strings.Split(a, "||") {
+		for _, setB := range strings.Split(b, "||") {
+			sets = append(
+				sets, strings.TrimSpace(setA)+" "+strings.TrimSpace(setB))
+		}
+	}
+	return strings.Join(sets, " || ")
+}
+
+// highestMatchingTag returns the tag of the highest version that satisfies
+// the semver range from the sorted list of the tags of the filter. It
+// returns false if none of the tags matches.
+func highestMatchingTag(tags []string, name, versionRangeText string) (string, bool) {
+	for i := len(tags) - 1; i >= 0; i-- {
+		if versionRangeMatches(versionRangeText, trimFilterPrefix(tags[i], name)) {
+			return tags[i], true
+		}
+	}
+	return "", false
+}
+
+// GetMatchingRemoteFilterTag returns the tag of the highest version of the
+// remote filter that satisfies the semver range.
+func GetMatchingRemoteFilterTag(url, name, versionRangeText string) (string, error) {
+	if _, err := parseVersionRange(versionRangeText); err != nil {
+		return "", PassError(err)
+	}
+	tags, err := ListRemoteFilterTags(url, name)
+	if err != nil {
+		return "", PassError(err)
+	}
+	if tag, ok := highestMatchingTag(tags, name, versionRangeText); ok {
+		return tag, nil
+	}
+	return "", WrappedErrorf(
+		"No version of the filter satisfies the version range.\n"+
+			"Filter: %s\nRange: %s", name, versionRangeText)
+}
+
+// widenVersionRange replaces the semver range of the filter with a range
+// that includes the latest version of the filter, if the current range
+// doesn't include it. The new range uses the "~" operator if the old one
+// starts with it and the "^" operator otherwise. It returns true if the
+// range was changed.
+func (f *RemoteFilterDefinition) widenVersionRange() (bool, error) {
+	tag, err := GetLatestRemoteFilterTag(f.Url, f.Id)
+	if err != nil {
+		return false, PassError(err)
+	}
+	latest := trimFilterPrefix(tag, f.Id)
+	if versionRangeMatches(f.Version, latest) {
+		return false, nil
+	}
+	operator := "^"
+	if strings.HasPrefix(strings.TrimSpace(f.Version), "~") {
+		operator = "~"
+	}
+	Logger.Infof(
+		"Changing the version range of filter %q to include the latest "+
+			"version: %q->%q.", f.Id, f.Version, operator+latest)
+	f.Version = operator + latest
+	return true, nil
+}
+
+// saveWidenedVersionRanges saves the semver ranges of the remote filters
+// changed by widenVersionRange in the config file. The config file is
+// modified without merging the local config, like in "regolith install".
+func saveWidenedVersionRanges(filterInstallers map[string]FilterInstaller) error {
+	config, err := loadConfigFileAsMap()
+	if err != nil {
+		return WrapError(err, "Unable to load config file.")
+	}
+	filterDefinitions, err := filterDefinitionsFromConfigMap(config)
+	if err != nil {
+		return WrapError(
+			err,
+			"Failed to get the list of filter definitions from config file.")
+	}
+	changed := false
+	for name, filterInstaller := range filterInstallers {
+		remoteFilter, ok := filterInstaller.(*RemoteFilterDefinition)
+		if !ok {
+			continue
+		}
+		definition, ok := filterDefinitions[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		version, ok := definition["version"].(string)
+		if !ok || !isVersionRange(version) || version == remoteFilter.Version {
+			continue
+		}
+		definition["version"] = remoteFilter.Version
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	jsonBytes, _ := json.MarshalIndent(config, "", "  ")
+	err = ioutil.WriteFile(ConfigFilePath, jsonBytes, 0644)
+	if err != nil {
+		return WrapErrorf(err, fileWriteError, ConfigFilePath)
+	}
+	return nil
+}
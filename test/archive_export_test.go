@@ -0,0 +1,174 @@
+package test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+)
+
+// archiveEntries returns the names of the files in a zip archive.
+func archiveEntries(t *testing.T, path string) []string {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("Failed to open the archive %q: %s", path, err)
+	}
+	defer reader.Close()
+	result := []string{}
+	for _, file := range reader.File {
+		result = append(result, file.Name)
+	}
+	return result
+}
+
+// archiveJsonFile returns the parsed content of a JSON file from a zip
+// archive.
+func archiveJsonFile(t *testing.T, path, name string) interface{} {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("Failed to open the archive %q: %s", path, err)
+	}
+	defer reader.Close()
+	file, err := reader.Open(name)
+	if err != nil {
+		t.Fatalf("Failed to open %q from the archive %q: %s", name, path, err)
+	}
+	defer file.Close()
+	var result interface{}
+	if err := json.NewDecoder(file).Decode(&result); err != nil {
+		t.Fatalf("Failed to parse %q from the archive %q: %s", name, path, err)
+	}
+	return result
+}
+
+// testArchiveExport tests the "mcpack", "mcaddon" and "mcworld" export
+// targets. It checks the names and the content of the archives and if running
+// the same profile twice produces identical archives.
+func testArchiveExport(t *testing.T, recycled bool) {
+	cleanup := prepareTestProject(t, archiveExportPath)
+	defer cleanup()
+	// THE TEST
+	if err := regolith.Unlock(true); err != nil {
+		t.Fatal("'regolith unlock' failed:", err.Error())
+	}
+	// mcpack
+	if err := regolith.Run("mcpack", recycled, true); err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	bpArchive := filepath.Join("build", "regolith_test_project_bp_1.0.0.mcpack")
+	rpArchive := filepath.Join("build", "regolith_test_project_rp_1.0.0.mcpack")
+	expected := []string{
+		"entities/", "entities/example.json", "manifest.json"}
+	if entries := archiveEntries(t, bpArchive); !reflect.DeepEqual(
+		entries, expected) {
+		t.Fatalf("Unexpected files in %q: %v", bpArchive, entries)
+	}
+	expected = []string{"manifest.json"}
+	if entries := archiveEntries(t, rpArchive); !reflect.DeepEqual(
+		entries, expected) {
+		t.Fatalf("Unexpected files in %q: %v", rpArchive, entries)
+	}
+	firstRun, err := ioutil.ReadFile(bpArchive)
+	if err != nil {
+		t.Fatal("Failed to read the archive:", err)
+	}
+	if err := regolith.Run("mcpack", recycled, true); err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	secondRun, err := ioutil.ReadFile(bpArchive)
+	if err != nil {
+		t.Fatal("Failed to read the archive:", err)
+	}
+	if !bytes.Equal(firstRun, secondRun) {
+		t.Fatal("Exporting the same files produced different archives")
+	}
+
+	// mcpack with a file name that would be the same for both packs
+	err = regolith.Run("mcpack_same_file_name", recycled, true)
+	if err == nil {
+		t.Fatal("Expected 'regolith run' to reject the file name without " +
+			"the {pack} placeholder")
+	}
+	if !strings.Contains(err.Error(), "{pack}") {
+		t.Fatalf("Expected the error to mention the {pack} placeholder, "+
+			"got:\n%s", err.Error())
+	}
+	assertNotExists(t, filepath.Join(
+		"build", "regolith_test_project-1.0.0.mcpack"))
+
+	// mcaddon
+	if err := regolith.Run("mcaddon", recycled, true); err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	addonArchive := filepath.Join("dist", "regolith_test_project.mcaddon")
+	expected = []string{
+		"regolith_test_project_bp/",
+		"regolith_test_project_bp/entities/",
+		"regolith_test_project_bp/entities/example.json",
+		"regolith_test_project_bp/manifest.json",
+		"regolith_test_project_rp/",
+		"regolith_test_project_rp/manifest.json",
+	}
+	if entries := archiveEntries(t, addonArchive); !reflect.DeepEqual(
+		entries, expected) {
+		t.Fatalf("Unexpected files in %q: %v", addonArchive, entries)
+	}
+
+	// mcworld
+	if err := regolith.Run("mcworld", recycled, true); err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	worldArchive := filepath.Join("build", "regolith_test_project.mcworld")
+	expected = []string{
+		"behavior_packs/",
+		"behavior_packs/other_bp/",
+		"behavior_packs/other_bp/manifest.json",
+		"behavior_packs/regolith_test_project_bp/",
+		"behavior_packs/regolith_test_project_bp/entities/",
+		"behavior_packs/regolith_test_project_bp/entities/example.json",
+		"behavior_packs/regolith_test_project_bp/manifest.json",
+		"level.dat",
+		"levelname.txt",
+		"resource_packs/regolith_test_project_rp/",
+		"resource_packs/regolith_test_project_rp/manifest.json",
+		"world_behavior_packs.json",
+		"world_resource_packs.json",
+	}
+	if entries := archiveEntries(t, worldArchive); !reflect.DeepEqual(
+		entries, expected) {
+		t.Fatalf("Unexpected files in %q: %v", worldArchive, entries)
+	}
+	// The old version of the exported pack is replaced, other packs are kept
+	var expectedJson interface{}
+	json.Unmarshal([]byte(`[
+		{"pack_id": "96b53fd2-b7a1-4d26-b74f-1b9394c8d0bc", "version": [1, 0, 0]},
+		{"pack_id": "0b6c1f2c-4a0a-4d5e-9a43-5d2a6f1e7b10", "version": [1, 0, 0]}
+	]`), &expectedJson)
+	if registry := archiveJsonFile(
+		t, worldArchive, "world_behavior_packs.json"); !reflect.DeepEqual(
+		registry, expectedJson) {
+		t.Fatalf("Unexpected world_behavior_packs.json: %v", registry)
+	}
+	json.Unmarshal([]byte(`[
+		{"pack_id": "6f6e3f0b-1627-488d-a9aa-2d1430ba368a", "version": [1, 0, 0]}
+	]`), &expectedJson)
+	if registry := archiveJsonFile(
+		t, worldArchive, "world_resource_packs.json"); !reflect.DeepEqual(
+		registry, expectedJson) {
+		t.Fatalf("Unexpected world_resource_packs.json: %v", registry)
+	}
+}
+
+func TestArchiveExport(t *testing.T) {
+	testArchiveExport(t, false)
+}
+
+func TestArchiveExportRecycled(t *testing.T) {
+	testArchiveExport(t, true)
+}
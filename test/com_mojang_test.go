@@ -0,0 +1,85 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+)
+
+// TestFindMojangDirOverride tests if the path to com.mojang set with the
+// REGOLITH_COM_MOJANG environment variable is used by FindMojangDir and if
+// an invalid path causes an error.
+func TestFindMojangDirOverride(t *testing.T) {
+	regolith.InitLogging(true)
+	tmpDir, err := ioutil.TempDir("", "regolith-test")
+	if err != nil {
+		t.Fatal("Unable to create temporary directory:", err)
+	}
+	t.Log("Created temporary directory:", tmpDir)
+	defer os.RemoveAll(tmpDir)
+	// Don't let the user config of the machine affect the test
+	t.Setenv("XDG_CACHE_HOME", tmpDir)
+	t.Setenv("LOCALAPPDATA", tmpDir)
+
+	comMojang := filepath.Join(tmpDir, "com.mojang")
+	err = os.Mkdir(comMojang, 0755)
+	if err != nil {
+		t.Fatal("Unable to create com.mojang directory:", err)
+	}
+	t.Setenv("REGOLITH_COM_MOJANG", comMojang)
+	result, err := regolith.FindMojangDir()
+	if err != nil {
+		t.Fatal("FindMojangDir failed:", err)
+	}
+	if result != comMojang {
+		t.Fatalf("Expected %q, got %q", comMojang, result)
+	}
+
+	t.Setenv("REGOLITH_COM_MOJANG", filepath.Join(tmpDir, "missing"))
+	_, err = regolith.FindMojangDir()
+	if err == nil {
+		t.Fatal("Expected FindMojangDir to fail for a missing path")
+	}
+}
+
+// TestFindMojangDirMcpelauncher tests if FindMojangDir finds the com.mojang
+// directory of mcpelauncher on Linux.
+func TestFindMojangDirMcpelauncher(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("mcpelauncher paths are tested only on Linux")
+	}
+	regolith.InitLogging(true)
+	tmpDir, err := ioutil.TempDir("", "regolith-test")
+	if err != nil {
+		t.Fatal("Unable to create temporary directory:", err)
+	}
+	t.Log("Created temporary directory:", tmpDir)
+	defer os.RemoveAll(tmpDir)
+	t.Setenv("HOME", tmpDir)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(tmpDir, ".cache"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(tmpDir, ".local", "share"))
+	t.Setenv("WINEPREFIX", "")
+	t.Setenv("REGOLITH_COM_MOJANG", "")
+
+	_, err = regolith.FindMojangDir()
+	if err == nil {
+		t.Fatal("Expected FindMojangDir to fail without com.mojang")
+	}
+	comMojang := filepath.Join(
+		tmpDir, ".local", "share", "mcpelauncher", "games", "com.mojang")
+	err = os.MkdirAll(comMojang, 0755)
+	if err != nil {
+		t.Fatal("Unable to create com.mojang directory:", err)
+	}
+	result, err := regolith.FindMojangDir()
+	if err != nil {
+		t.Fatal("FindMojangDir failed:", err)
+	}
+	if result != comMojang {
+		t.Fatalf("Expected %q, got %q", comMojang, result)
+	}
+}
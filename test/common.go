@@ -5,9 +5,12 @@ import (
 	"encoding/hex"
 	"io/fs"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/otiai10/copy"
 )
 
 // The ".ignoreme" files inside the test directories are files used to simulate
@@ -51,6 +54,91 @@ const (
 	// ProfileFilter. It contains a project and an expected result. The
 	// projects has both valid and invalid profiles.
 	profileFilterPath = "testdata/profile_filter"
+
+	// parallelFiltersPath is a directory that contains files for testing
+	// the profiles that run their filters in parallel. It contains a project
+	// and an expected result. The project has a valid profile and a profile
+	// with circular dependencies between the filters.
+	parallelFiltersPath = "testdata/parallel_filters"
+
+	// filterCachePath is a project with a shell filter that declares its
+	// inputs. The filter counts its runs in the "runs.txt" file in the root
+	// of the project. The filter of the "interrupted" profile changes the data
+	// folder and waits to be stopped the first time it runs.
+	filterCachePath = "testdata/filter_cache/project"
+
+	// filterTimeoutPath is a project with a shell filter that never finishes
+	// before its timeout.
+	filterTimeoutPath = "testdata/filter_timeout/project"
+
+	// lockedFilterPath is a directory with a project that uses a remote
+	// filter listed in its regolith.lock file ("project") and the files of
+	// the installed filter ("filter").
+	lockedFilterPath = "testdata/locked_filter"
+
+	// archiveExportPath is a project with profiles that export the packs as
+	// .mcpack, .mcaddon and .mcworld archives. The .mcworld archive is based
+	// on the "world_template" directory of the project.
+	archiveExportPath = "testdata/archive_export/project"
+
+	// manifestUpdatePath is a project with profiles that change the versions
+	// and the UUIDs in the manifests of the packs of the minimal project. The
+	// behavior pack depends on the resource pack.
+	manifestUpdatePath = "testdata/manifest_update/project"
+
+	// profileSourcesPath is a project with profiles that override the source
+	// folders of the packs and the data path, and that add extra source
+	// folders from the "variants" directory.
+	profileSourcesPath = "testdata/profile_sources/project"
+
+	// profileExtendsPath is a directory with a config file with profiles
+	// that extend other profiles.
+	profileExtendsPath = "testdata/profile_extends"
+
+	// exportTargetsPath is a project with profiles that export to multiple
+	// targets, including a profile with a broken target and a profile with
+	// targets that use the same path.
+	exportTargetsPath = "testdata/export_targets/project"
+
+	// configInterpolationPath is a project with placeholders in the config
+	// file and a config.local.json file that overrides one of the profiles.
+	configInterpolationPath = "testdata/config_interpolation/project"
+
+	// filterWhenPath is a project with shell filters that have "when"
+	// expressions.
+	filterWhenPath = "testdata/filter_when/project"
+
+	// filterSelectionPath is a project with shell filters that append their
+	// names to the same file, used for testing running a part of a profile.
+	filterSelectionPath = "testdata/filter_selection/project"
+
+	// tracePath is a project with shell filters that create, modify and
+	// delete files, used for testing the "--trace" flag.
+	tracePath = "testdata/trace/project"
+
+	// filterProtocolPath is a project with shell filters that use the filter
+	// protocol, used for testing the requests and the messages of the
+	// protocol.
+	filterProtocolPath = "testdata/filter_protocol/project"
+
+	// shellArgumentsPath is a project with shell filters that save their
+	// arguments and settings, used for testing the quoting of the arguments
+	// and the ways of passing the settings.
+	shellArgumentsPath = "testdata/shell_arguments/project"
+
+	// filterSourcesPath is a project with a directory with a remote filter,
+	// used for testing installing the remote filters from the local
+	// directories.
+	filterSourcesPath = "testdata/filter_sources/project"
+
+	// nestedRemoteFiltersPath is a project with directories with remote
+	// filters that use other remote filters, used for testing the nested
+	// remote filters, their cycles and conflicts.
+	nestedRemoteFiltersPath = "testdata/nested_remote_filters/project"
+
+	// invalidConfigPath is a directory with a config file that has multiple
+	// problems, used for testing "regolith validate".
+	invalidConfigPath = "testdata/invalid_config"
 )
 
 // firstErr returns the first error in a list of errors. If the list is empty
@@ -64,6 +152,78 @@ func firstErr(errors ...error) error {
 	return nil
 }
 
+// prepareTestProject creates a temporary directory with a copy of the
+// minimal project and changes the working directory to it. The files from
+// the "path" directory are copied on top of the minimal project, so the test
+// projects only need the files that are different, usually only the config
+// file. The "path" can be empty to use only the minimal project. The filter
+// store uses a temporary user cache directory. The returned function changes
+// the working directory back and deletes the temporary directory.
+func prepareTestProject(t *testing.T, path string) (cleanup func()) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal("Unable to get current working directory")
+	}
+	tmpDir, err := ioutil.TempDir("", "regolith-test")
+	if err != nil {
+		t.Fatal("Unable to create temporary directory:", err)
+	}
+	t.Log("Created temporary directory:", tmpDir)
+	cleanup = func() {
+		// Before deleting "tmpDir" the test must stop using it
+		os.Chdir(wd)
+		os.RemoveAll(tmpDir)
+	}
+	// Use a temporary user cache directory for the filter store
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(tmpDir, "cache"))
+	workingDir := filepath.Join(tmpDir, "project")
+	for _, project := range []string{minimalProjectPath, path} {
+		if project == "" {
+			continue
+		}
+		err = copy.Copy(
+			project, workingDir,
+			copy.Options{PreserveTimes: false, Sync: false})
+		if err != nil {
+			cleanup()
+			t.Fatalf(
+				"Failed to copy test files from %q into the working "+
+					"directory %q", project, workingDir)
+		}
+	}
+	os.Chdir(workingDir)
+	return cleanup
+}
+
+// assertFileEquals checks if the file exists and has the expected content.
+func assertFileEquals(t *testing.T, path, expected string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %q: %s", path, err)
+	}
+	if string(data) != expected {
+		t.Fatalf("Expected %q to be %q, got %q", path, expected, data)
+	}
+}
+
+// assertFileContains checks if the file exists and contains the text.
+func assertFileContains(t *testing.T, path, text string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %q: %s", path, err)
+	}
+	if !strings.Contains(string(data), text) {
+		t.Fatalf("Expected %q to contain %q, got:\n%s", path, text, data)
+	}
+}
+
+// assertNotExists checks if the path doesn't exist.
+func assertNotExists(t *testing.T, path string) {
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Expected %q to not exist", path)
+	}
+}
+
 // listPaths returns a dictionary with paths of the files from 'path' directory
 // relative to 'root' directory used as keys, and with md5 hashes paths as
 // values. The directory paths use empty strings instead of MD5. The function
@@ -0,0 +1,50 @@
+package test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+)
+
+// testConfigInterpolation tests the placeholders in the config file and
+// merging the config.local.json file over the config.json file.
+func testConfigInterpolation(t *testing.T, recycled bool) {
+	t.Setenv("REGOLITH_TEST_EXPORT", "from_env")
+	cleanup := prepareTestProject(t, configInterpolationPath)
+	defer cleanup()
+	// THE TEST
+	if err := regolith.Unlock(true); err != nil {
+		t.Fatal("'regolith unlock' failed:", err.Error())
+	}
+	// Placeholders
+	if err := regolith.Run("default", recycled, true); err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	assertFileContains(
+		t, "out/regolith_test_project_default/BP/manifest.json",
+		"Regolith Test BP")
+	assertFileContains(t, "out/from_env/RP/manifest.json", "Regolith Test RP")
+
+	// Export target overridden by the config.local.json file
+	if err := regolith.Run("local", recycled, true); err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	assertFileContains(t, "local/BP/manifest.json", "Regolith Test BP")
+	assertFileContains(t, "local/RP/manifest.json", "Regolith Test RP")
+	assertNotExists(t, "build")
+
+	// Missing environment variable
+	os.Unsetenv("REGOLITH_TEST_EXPORT")
+	if err := regolith.Run("local", recycled, true); err == nil {
+		t.Fatal("Expected 'regolith run' to fail")
+	}
+}
+
+func TestConfigInterpolation(t *testing.T) {
+	testConfigInterpolation(t, false)
+}
+
+func TestConfigInterpolationRecycled(t *testing.T) {
+	testConfigInterpolation(t, true)
+}
@@ -0,0 +1,93 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+)
+
+// awaitDirWatcherMessage waits for a message from the interruption channel
+// used by the DirWatcher and fails the test if it doesn't come in time.
+func awaitDirWatcherMessage(
+	t *testing.T, interruptionChannel chan string, expected string,
+) {
+	select {
+	case message := <-interruptionChannel:
+		if message != expected {
+			t.Fatalf("Unexpected interruption message: %q", message)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("DirWatcher didn't report the change in time")
+	}
+}
+
+// TestDirWatcher tests if the DirWatcher reports the changes in the watched
+// directory, including the changes inside of the subdirectories created after
+// the watching began. It performs the following:
+// 1. Starts watching an empty directory.
+// 2. Creates a nested directory and checks if the change is reported.
+// 3. Creates a file inside of the new directory and checks if the change is
+// reported.
+func TestDirWatcher(t *testing.T) {
+	regolith.InitLogging(true)
+	tmpDir, err := ioutil.TempDir("", "regolith-test")
+	if err != nil {
+		t.Fatal("Unable to create temporary directory:", err)
+	}
+	t.Log("Created temporary directory:", tmpDir)
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	watcher, err := regolith.NewDirWatcher(tmpDir)
+	if err != nil {
+		t.Fatal("Unable to create DirWatcher:", err)
+	}
+	interruptionChannel := make(chan string, 1)
+	watcherDone := make(chan struct{})
+	go func() {
+		defer close(watcherDone)
+		for {
+			err := watcher.WaitForChangeGroup(
+				100, interruptionChannel, "change")
+			if err != nil {
+				return
+			}
+		}
+	}()
+	// Stop the watcher before deleting the directory. The goroutine can be
+	// blocked on sending a message that nobody reads, so the channel is
+	// drained until the goroutine exits.
+	t.Cleanup(func() {
+		watcher.Close()
+		for {
+			select {
+			case <-interruptionChannel:
+			case <-watcherDone:
+				return
+			}
+		}
+	})
+	// Give the polling backends time to take the initial snapshot
+	time.Sleep(time.Second)
+
+	// Create nested directory
+	nestedDir := filepath.Join(tmpDir, "a", "b")
+	err = os.MkdirAll(nestedDir, 0755)
+	if err != nil {
+		t.Fatal("Unable to create nested directory:", err)
+	}
+	awaitDirWatcherMessage(t, interruptionChannel, "change")
+	// Wait for the group timeout to pass
+	time.Sleep(time.Second)
+
+	// Create a file in the new directory
+	err = ioutil.WriteFile(
+		filepath.Join(nestedDir, "file.txt"), []byte("test"), 0644)
+	if err != nil {
+		t.Fatal("Unable to create file:", err)
+	}
+	awaitDirWatcherMessage(t, interruptionChannel, "change")
+}
@@ -0,0 +1,125 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+	"github.com/fatih/color"
+)
+
+// TestErrorChain tests if ErrorChain returns the list of messages of the
+// wrapped errors used in the JSON output mode, without the colors and the
+// stack traces of the text of the errors.
+func TestErrorChain(t *testing.T) {
+	regolith.InitLogging(true)
+	noColor := color.NoColor
+	defer func() { color.NoColor = noColor }()
+	color.NoColor = false
+	err := regolith.WrapError(
+		regolith.WrapError(errors.New("Root cause."), "Middle."),
+		"Outer.\nWith details.")
+	expected := []string{"Outer.\nWith details.", "Middle.", "Root cause."}
+	result := regolith.ErrorChain(err)
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("Expected %q, got %q", expected, result)
+	}
+}
+
+// TestSetOutputFormat tests if SetOutputFormat rejects unknown formats.
+func TestSetOutputFormat(t *testing.T) {
+	defer regolith.SetOutputFormat(regolith.TextOutputFormat)
+	if err := regolith.SetOutputFormat("xml"); err == nil {
+		t.Fatal("Expected SetOutputFormat to fail for an unknown format")
+	}
+	if err := regolith.SetOutputFormat(regolith.JsonOutputFormat); err != nil {
+		t.Fatal("SetOutputFormat failed:", err)
+	}
+	if !regolith.IsJsonOutput() {
+		t.Fatal("Expected the JSON output mode to be enabled")
+	}
+}
+
+// TestErrorJsonOutput tests if the error of a failing run is logged in the
+// JSON output mode as a JSON object with the chain of the messages of the
+// wrapped errors.
+func TestErrorJsonOutput(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal("Unable to get current working directory")
+	}
+	defer os.Chdir(wd)
+	tmpDir := t.TempDir()
+	// Capture the output of the JSON logger, which prints to stdout
+	outputPath := filepath.Join(tmpDir, "output.json")
+	output, err := os.Create(outputPath)
+	if err != nil {
+		t.Fatal("Unable to create the output file:", err)
+	}
+	defer output.Close()
+	logger, stdout, noColor := regolith.Logger, os.Stdout, color.NoColor
+	defer func() {
+		regolith.Logger, os.Stdout, color.NoColor = logger, stdout, noColor
+		regolith.SetOutputFormat(regolith.TextOutputFormat)
+	}()
+	os.Stdout = output
+	regolith.Logger = nil
+	if err := regolith.SetOutputFormat(regolith.JsonOutputFormat); err != nil {
+		t.Fatal("SetOutputFormat failed:", err)
+	}
+	regolith.InitLogging(true)
+
+	// THE TEST
+	// The working directory doesn't have a config file
+	workingDir := filepath.Join(tmpDir, "project")
+	if err := os.Mkdir(workingDir, 0755); err != nil {
+		t.Fatal("Unable to create the working directory:", err)
+	}
+	os.Chdir(workingDir)
+	err = regolith.Run("default", false, true)
+	if err == nil {
+		t.Fatal("Expected 'regolith run' to fail without a config file")
+	}
+	regolith.LogError(err)
+	regolith.Logger.Sync()
+	data, err := ioutil.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal("Unable to read the output file:", err)
+	}
+	var errorEvent map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var object map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &object); err != nil {
+			t.Fatalf("Invalid JSON output line %q: %s", line, err)
+		}
+		if object["event"] == "error" {
+			errorEvent = object
+		}
+	}
+	if errorEvent == nil {
+		t.Fatalf("Expected an error event in the output:\n%s", data)
+	}
+	chain, ok := errorEvent["chain"].([]interface{})
+	if !ok || len(chain) < 2 {
+		t.Fatalf("Expected the chain of the wrapped errors, got %v",
+			errorEvent["chain"])
+	}
+	if chain[0] != errorEvent["msg"] {
+		t.Fatalf("Expected the message of the event to be %q, got %q",
+			chain[0], errorEvent["msg"])
+	}
+	for _, message := range chain {
+		message, ok := message.(string)
+		if !ok || strings.Contains(message, "\x1b") ||
+			strings.Contains(message, "[+]") ||
+			strings.Contains(message, ".go:") {
+			t.Fatalf("Unexpected message in the chain: %q", message)
+		}
+	}
+}
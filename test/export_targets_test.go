@@ -0,0 +1,79 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+)
+
+// testExportTargets tests the profiles with multiple export targets. The
+// files should be exported to every target, and a failure of one of the
+// targets should revert the changes in the other ones.
+func testExportTargets(t *testing.T, recycled bool) {
+	cleanup := prepareTestProject(t, exportTargetsPath)
+	defer cleanup()
+	// THE TEST
+	if err := regolith.Unlock(true); err != nil {
+		t.Fatal("'regolith unlock' failed:", err.Error())
+	}
+	// Export to every target
+	if err := regolith.Run("multiple", recycled, true); err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	for _, path := range []string{
+		"build/BP/manifest.json", "build/RP/manifest.json",
+		"exact/BP/manifest.json", "exact/RP/manifest.json",
+	} {
+		assertFileContains(t, path, "Regolith Test")
+	}
+	stat, err := os.Stat("exact/BP/manifest.json")
+	if err != nil {
+		t.Fatal("Failed to stat the exported file:", err)
+	}
+	if stat.Mode().Perm()&0222 != 0 {
+		t.Fatal("Expected the files of the read-only target to be read-only")
+	}
+	stat, err = os.Stat("build/BP/manifest.json")
+	if err != nil {
+		t.Fatal("Failed to stat the exported file:", err)
+	}
+	if stat.Mode().Perm()&0200 == 0 {
+		t.Fatal("Expected the files of the local target to be writable")
+	}
+	archive := archiveEntries(t, "build/regolith_test_project.mcaddon")
+	if len(archive) == 0 {
+		t.Fatal("Expected the mcaddon archive to have files")
+	}
+	assertFileContains(
+		t, "packs/data/example_data_file.json", "")
+
+	// A failing target reverts the other targets
+	err = ioutil.WriteFile("packs/BP/new_file.json", []byte("{}"), 0644)
+	if err != nil {
+		t.Fatal("Failed to add a file to the behavior pack:", err)
+	}
+	if err := regolith.Run("rollback", recycled, true); err == nil {
+		t.Fatal("Expected 'regolith run' to fail")
+	}
+	assertNotExists(t, "exact/BP/new_file.json")
+	assertFileContains(t, "exact/BP/manifest.json", "Regolith Test")
+	assertFileContains(t, "exact/RP/manifest.json", "Regolith Test")
+	assertFileContains(t, "packs/data/example_data_file.json", "")
+	assertNotExists(t, ".regolith/.exportBackup")
+
+	// The targets can't use the same paths
+	if err := regolith.Run("duplicate", recycled, true); err == nil {
+		t.Fatal("Expected 'regolith run' to fail")
+	}
+	assertFileContains(t, "build/BP/manifest.json", "Regolith Test")
+}
+
+func TestExportTargets(t *testing.T) {
+	testExportTargets(t, false)
+}
+
+func TestExportTargetsRecycled(t *testing.T) {
+	testExportTargets(t, true)
+}
@@ -0,0 +1,145 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+)
+
+// assertFilterCacheRun runs the default profile of the filter cache test
+// project and checks how many times the filter was executed in total and the
+// content of the files exported by the filter.
+func assertFilterCacheRun(
+	t *testing.T, recycled bool, expectedRuns int, expectedOut string,
+) {
+	if err := regolith.Run("default", recycled, true); err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	runs, err := ioutil.ReadFile("runs.txt")
+	if err != nil {
+		t.Fatal("Unable to read the runs.txt file:", err)
+	}
+	if n := strings.Count(string(runs), "run"); n != expectedRuns {
+		t.Fatalf("Expected the filter to run %d times, got %d",
+			expectedRuns, n)
+	}
+	out, err := ioutil.ReadFile(filepath.Join("build", "BP", "output", "out.txt"))
+	if err != nil {
+		t.Fatal("Unable to read the output of the filter:", err)
+	}
+	if string(out) != expectedOut {
+		t.Fatalf("Unexpected output of the filter: %q", string(out))
+	}
+	_, err = os.Stat(filepath.Join("build", "BP", "remove_me.txt"))
+	if !os.IsNotExist(err) {
+		t.Fatal("The file deleted by the filter was exported")
+	}
+}
+
+// testFilterCache tests if a filter with declared inputs is skipped when its
+// inputs didn't change and if its cached output is used instead. The test
+// runs the same profile three times. The second run reuses the output of the
+// first one. Before the third run, the input of the filter is modified so the
+// filter must run again.
+func testFilterCache(t *testing.T, recycled bool) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test project uses POSIX shell commands")
+	}
+	cleanup := prepareTestProject(t, filterCachePath)
+	defer cleanup()
+	// THE TEST
+	if err := regolith.Unlock(true); err != nil {
+		t.Fatal("'regolith unlock' failed:", err.Error())
+	}
+	t.Log("Running the filter for the first time")
+	assertFilterCacheRun(t, recycled, 1, "first\n")
+	t.Log("Running the profile without changes (the filter should be skipped)")
+	assertFilterCacheRun(t, recycled, 1, "first\n")
+	t.Log("Running the profile after changing the input of the filter")
+	err := ioutil.WriteFile(
+		filepath.Join("packs", "BP", "in.txt"), []byte("second\n"), 0644)
+	if err != nil {
+		t.Fatal("Unable to modify the input of the filter:", err)
+	}
+	assertFilterCacheRun(t, recycled, 2, "second\n")
+}
+
+// testFilterCacheInterrupted tests if the output of a filter that was stopped
+// in the watch mode isn't cached. The filter changes the data folder and
+// waits to be stopped the first time it runs. Regolith restarts the profile
+// after the interruption and the filter must run again instead of using its
+// partial output from the cache.
+func testFilterCacheInterrupted(t *testing.T, recycled bool) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test project uses POSIX shell commands")
+	}
+	cleanup := prepareTestProject(t, filterCachePath)
+	defer cleanup()
+	// THE TEST
+	if err := regolith.Unlock(true); err != nil {
+		t.Fatal("'regolith unlock' failed:", err.Error())
+	}
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- regolith.Watch("interrupted", recycled, true)
+	}()
+	outPath := filepath.Join("build", "BP", "output", "out.txt")
+	exported := false
+	for deadline := time.Now().Add(30 * time.Second); time.Now().Before(deadline); {
+		if _, err := os.Stat(outPath); err == nil {
+			exported = true
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	// Stop watching like after pressing Ctrl+C
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal("Unable to find the test process:", err)
+	}
+	if err := process.Signal(os.Interrupt); err != nil {
+		t.Fatal("Unable to stop 'regolith watch':", err)
+	}
+	if err := <-watchErr; err != nil {
+		t.Fatal("'regolith watch' failed:", err.Error())
+	}
+	if !exported {
+		t.Fatal("'regolith watch' didn't export the project")
+	}
+	runs, err := ioutil.ReadFile("runs.txt")
+	if err != nil {
+		t.Fatal("Unable to read the runs.txt file:", err)
+	}
+	if n := strings.Count(string(runs), "run"); n != 2 {
+		t.Fatalf("Expected the filter to run 2 times, got %d", n)
+	}
+	out, err := ioutil.ReadFile(outPath)
+	if err != nil {
+		t.Fatal("Unable to read the output of the filter:", err)
+	}
+	if string(out) != "first\n" {
+		t.Fatalf("Unexpected output of the filter: %q", string(out))
+	}
+}
+
+func TestFilterCache(t *testing.T) {
+	testFilterCache(t, false)
+}
+
+func TestFilterCacheRecycled(t *testing.T) {
+	testFilterCache(t, true)
+}
+
+func TestFilterCacheInterrupted(t *testing.T) {
+	testFilterCacheInterrupted(t, false)
+}
+
+func TestFilterCacheInterruptedRecycled(t *testing.T) {
+	testFilterCacheInterrupted(t, true)
+}
@@ -0,0 +1,68 @@
+package test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+)
+
+// TestFilterProtocol tests the filters that use the filter protocol. It
+// checks the request written to the standard input of the filter and the
+// error messages sent by the filter.
+func TestFilterProtocol(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test project uses POSIX shell commands")
+	}
+	cleanup := prepareTestProject(t, filterProtocolPath)
+	defer cleanup()
+	// THE TEST
+	if err := regolith.Unlock(true); err != nil {
+		t.Fatal("'regolith unlock' failed:", err.Error())
+	}
+	// The request written to the standard input of the filter
+	if err := regolith.Run("default", false, true); err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	data, err := ioutil.ReadFile("build/BP/request.json")
+	if err != nil {
+		t.Fatal("The filter didn't save the request:", err)
+	}
+	var request struct {
+		Protocol  int                    `json:"protocol"`
+		Filter    string                 `json:"filter"`
+		Profile   string                 `json:"profile"`
+		Settings  map[string]interface{} `json:"settings"`
+		Arguments []string               `json:"arguments"`
+		Paths     map[string]string      `json:"paths"`
+	}
+	if err := json.Unmarshal(data, &request); err != nil {
+		t.Fatal("Failed to parse the request:", err)
+	}
+	if request.Protocol != 1 || request.Filter != "save_request" ||
+		request.Profile != "default" {
+		t.Fatalf("Unexpected request: %s", data)
+	}
+	if request.Settings["message"] != "Hello World!" {
+		t.Fatalf("Unexpected settings in the request: %v", request.Settings)
+	}
+	if len(request.Arguments) != 1 || request.Arguments[0] != "--flag" {
+		t.Fatalf("Unexpected arguments in the request: %v", request.Arguments)
+	}
+	for _, path := range []string{
+		"root", "filter", "tmp", "behaviorPack", "resourcePack", "data",
+	} {
+		if !filepath.IsAbs(request.Paths[path]) {
+			t.Fatalf("Expected an absolute %q path in the request, got %q",
+				path, request.Paths[path])
+		}
+	}
+
+	// The error messages fail the filter
+	if err := regolith.Run("error", false, true); err == nil {
+		t.Fatal("Expected 'regolith run' to fail when the filter reports errors")
+	}
+}
@@ -0,0 +1,71 @@
+package test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+)
+
+// testFilterSelection tests running a part of the filters of a profile with
+// the Filters, From and Until options, and reusing the snapshots of the tmp
+// directory.
+func testFilterSelection(t *testing.T, recycled bool) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test project uses POSIX shell commands")
+	}
+	cleanup := prepareTestProject(t, filterSelectionPath)
+	defer cleanup()
+	// THE TEST
+	if err := regolith.Unlock(true); err != nil {
+		t.Fatal("'regolith unlock' failed:", err.Error())
+	}
+	run := func(options regolith.RunOptions) error {
+		return regolith.RunWithOptions("default", recycled, true, options)
+	}
+
+	// The whole profile with the snapshots
+	if err := run(regolith.RunOptions{SaveSnapshots: true}); err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	assertFileEquals(t, "build/BP/log.txt", "a\nb\nc\n")
+
+	// A single filter started from the snapshot of the previous filter
+	err := run(regolith.RunOptions{
+		From: "append_b", Until: "append_b", ReuseSnapshot: true})
+	if err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	assertFileEquals(t, "build/BP/log.txt", "a\nb\n")
+
+	// Selected filters started from the source files
+	err = run(regolith.RunOptions{Filters: []string{"append_a", "append_c"}})
+	if err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	assertFileEquals(t, "build/BP/log.txt", "a\nc\n")
+	err = run(regolith.RunOptions{From: "append_c"})
+	if err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	assertFileEquals(t, "build/BP/log.txt", "c\n")
+
+	// Filters that don't exist in the profile
+	for _, options := range []regolith.RunOptions{
+		{From: "missing"},
+		{Until: "append_a", From: "append_b"},
+		{Filters: []string{"missing"}},
+	} {
+		if err := run(options); err == nil {
+			t.Fatalf("Expected 'regolith run' to fail with options %+v", options)
+		}
+	}
+}
+
+func TestFilterSelection(t *testing.T) {
+	testFilterSelection(t, false)
+}
+
+func TestFilterSelectionRecycled(t *testing.T) {
+	testFilterSelection(t, true)
+}
@@ -0,0 +1,101 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+)
+
+// TestInstallFromLocalDirectory tests installing a remote filter from a
+// local directory and running it.
+func TestInstallFromLocalDirectory(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test project uses POSIX shell commands")
+	}
+	cleanup := prepareTestProject(t, filterSourcesPath)
+	defer cleanup()
+	// THE TEST
+	if err := regolith.Install([]string{"./filters/hello"}, false, true); err != nil {
+		t.Fatal("'regolith install' failed:", err.Error())
+	}
+	assertFileContains(t, "config.json", `"url": "./filters"`)
+	if err := regolith.Unlock(true); err != nil {
+		t.Fatal("'regolith unlock' failed:", err.Error())
+	}
+	if err := regolith.Run("default", false, true); err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	assertFileEquals(t, "build/BP/hello.txt", "hello\n")
+
+	// The local directories don't have versions
+	err := regolith.Install([]string{"./filters/hello==1.0.0"}, true, true)
+	if err == nil {
+		t.Fatal("Expected 'regolith install' to fail for a versioned local filter")
+	}
+}
+
+// TestGitFilterSourceVersions tests finding the versions of the remote
+// filters in a git repository with a "file://" URL.
+func TestGitFilterSourceVersions(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("Git is not installed")
+	}
+	repo, err := ioutil.TempDir("", "regolith-test")
+	if err != nil {
+		t.Fatal("Unable to create temporary directory:", err)
+	}
+	defer os.RemoveAll(repo)
+	git := func(args ...string) string {
+		args = append(
+			[]string{"-c", "user.name=test", "-c", "user.email=test@test"},
+			args...)
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		output, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("'git %s' failed: %s", strings.Join(args, " "), err)
+		}
+		return strings.TrimSpace(string(output))
+	}
+	git("init", "-q")
+	for _, tag := range []string{"hello-1.0.0", "other-2.0.0", "hello-1.1.0"} {
+		git("commit", "-q", "--allow-empty", "-m", tag)
+		git("tag", tag)
+	}
+	url := "file://" + filepath.ToSlash(repo)
+
+	tags, err := regolith.ListRemoteFilterTags(url, "hello")
+	if err != nil {
+		t.Fatal("Failed to list the tags:", err.Error())
+	}
+	if strings.Join(tags, ",") != "hello-1.0.0,hello-1.1.0" {
+		t.Fatalf("Unexpected tags: %v", tags)
+	}
+	ref, err := regolith.GetRemoteFilterDownloadRef(url, "hello", "latest")
+	if err != nil {
+		t.Fatal("Failed to get the latest version:", err.Error())
+	}
+	if ref != "hello-1.1.0" {
+		t.Fatalf("Expected the latest version to be hello-1.1.0, got %s", ref)
+	}
+	sha, err := regolith.GetRemoteFilterRefSha(url, "hello-1.0.0")
+	if err != nil {
+		t.Fatal("Failed to get the SHA of the tag:", err.Error())
+	}
+	if expected := git("rev-parse", "hello-1.0.0"); sha != expected {
+		t.Fatalf("Expected the SHA of the tag to be %s, got %s", expected, sha)
+	}
+	head, err := regolith.GetHeadSha(url, "hello")
+	if err != nil {
+		t.Fatal("Failed to get the SHA of HEAD:", err.Error())
+	}
+	if expected := git("rev-parse", "HEAD"); head != expected {
+		t.Fatalf("Expected the SHA of HEAD to be %s, got %s", expected, head)
+	}
+}
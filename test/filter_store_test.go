@@ -0,0 +1,148 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+	"github.com/otiai10/copy"
+)
+
+// TestFilterStore tests installing a remote filter from a git repository
+// through the filter store, installing it again in offline mode after the
+// repository is removed and pruning the store.
+func TestFilterStore(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test project uses POSIX shell commands")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("Git is not installed")
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal("Unable to get current working directory")
+	}
+	defer os.Chdir(wd)
+	tmpDir, err := ioutil.TempDir("", "regolith-test")
+	if err != nil {
+		t.Fatal("Unable to create temporary directory:", err)
+	}
+	t.Log("Created temporary directory:", tmpDir)
+	defer os.RemoveAll(tmpDir)
+	// Use a temporary user cache directory for the filter store
+	userCache := filepath.Join(tmpDir, "cache")
+	t.Setenv("XDG_CACHE_HOME", userCache)
+	t.Setenv("HOME", filepath.Join(tmpDir, "home"))
+	store := filepath.Join(userCache, "regolith", "filter-store")
+	storeEntries := func() int {
+		dirs, err := ioutil.ReadDir(store)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal("Unable to list the entries of the filter store:", err)
+		}
+		count := 0
+		for _, dir := range dirs {
+			if dir.IsDir() {
+				count++
+			}
+		}
+		return count
+	}
+	// Create a git repository with the filter
+	project, err := filepath.Abs(filterSourcesPath)
+	if err != nil {
+		t.Fatal("Unable to get absolute path to the test project:", err)
+	}
+	repo := filepath.Join(tmpDir, "repo")
+	err = copy.Copy(
+		filepath.Join(project, "filters"), repo,
+		copy.Options{PreserveTimes: false, Sync: false})
+	if err != nil {
+		t.Fatal("Unable to create the repository:", err)
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"commit", "-q", "-m", "hello"},
+		{"tag", "hello-1.0.0"},
+	} {
+		args = append(
+			[]string{"-c", "user.name=test", "-c", "user.email=test@test"},
+			args...)
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		if err := cmd.Run(); err != nil {
+			t.Fatalf("'git %s' failed: %s", strings.Join(args, " "), err)
+		}
+	}
+	url := "file://" + filepath.ToSlash(repo)
+	// Create two projects
+	projectA := filepath.Join(tmpDir, "a")
+	projectB := filepath.Join(tmpDir, "b")
+	for _, path := range []string{projectA, projectB} {
+		err = copy.Copy(
+			project, path, copy.Options{PreserveTimes: false, Sync: false})
+		if err != nil {
+			t.Fatalf("Failed to copy test files from %q into %q", project, path)
+		}
+	}
+
+	// THE TEST
+	// Install the filter in the first project
+	os.Chdir(projectA)
+	err = regolith.Install([]string{url + "/hello==1.0.0"}, false, true)
+	if err != nil {
+		t.Fatal("'regolith install' failed:", err.Error())
+	}
+	if n := storeEntries(); n != 1 {
+		t.Fatalf("Expected 1 entry in the filter store, got %d", n)
+	}
+
+	// Install the filter in the second project without the repository
+	for _, file := range []string{"config.json", "regolith.lock"} {
+		err = copy.Copy(file, filepath.Join(projectB, file))
+		if err != nil {
+			t.Fatalf("Failed to copy %s to the second project", file)
+		}
+	}
+	os.RemoveAll(repo)
+	os.Chdir(projectB)
+	if err := regolith.InstallAll(false, true, true); err != nil {
+		t.Fatal("'regolith install-all --offline' failed:", err.Error())
+	}
+	if err := regolith.Unlock(true); err != nil {
+		t.Fatal("'regolith unlock' failed:", err.Error())
+	}
+	if err := regolith.Run("default", false, true); err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	assertFileEquals(t, "build/BP/hello.txt", "hello\n")
+
+	// The filters that aren't in the lock file can't be installed offline
+	os.Remove("regolith.lock")
+	if err := regolith.InstallAll(true, true, true); err == nil {
+		t.Fatal("Expected 'regolith install-all --offline' to fail " +
+			"without the lock file")
+	}
+
+	// The filter is still locked by the first project
+	if err := regolith.CachePrune(true); err != nil {
+		t.Fatal("'regolith cache prune' failed:", err.Error())
+	}
+	if n := storeEntries(); n != 1 {
+		t.Fatalf("Expected 1 entry in the filter store, got %d", n)
+	}
+	// The filter isn't used after the first project is removed
+	os.Chdir(wd)
+	os.RemoveAll(projectA)
+	if err := regolith.CachePrune(true); err != nil {
+		t.Fatal("'regolith cache prune' failed:", err.Error())
+	}
+	if n := storeEntries(); n != 0 {
+		t.Fatalf("Expected an empty filter store, got %d entries", n)
+	}
+}
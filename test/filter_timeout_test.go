@@ -0,0 +1,46 @@
+package test
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+)
+
+// testFilterTimeout tests if a filter that doesn't finish before its timeout
+// is killed and if the error names the filter and the timeout.
+func testFilterTimeout(t *testing.T, recycled bool) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test project uses POSIX shell commands")
+	}
+	cleanup := prepareTestProject(t, filterTimeoutPath)
+	defer cleanup()
+	// THE TEST
+	if err := regolith.Unlock(true); err != nil {
+		t.Fatal("'regolith unlock' failed:", err.Error())
+	}
+	start := time.Now()
+	err := regolith.Run("default", recycled, true)
+	if err == nil {
+		t.Fatal("Expected 'regolith run' to fail")
+	}
+	if duration := time.Since(start); duration > 30*time.Second {
+		t.Fatalf("The filter wasn't killed after the timeout (%s)", duration)
+	}
+	for _, expected := range []string{"Filter: hang", "Timeout: 1s"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("Expected the error to contain %q, got:\n%s",
+				expected, err.Error())
+		}
+	}
+}
+
+func TestFilterTimeout(t *testing.T) {
+	testFilterTimeout(t, false)
+}
+
+func TestFilterTimeoutRecycled(t *testing.T) {
+	testFilterTimeout(t, true)
+}
@@ -0,0 +1,75 @@
+package test
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+)
+
+// testFilterWhen tests the "when" expressions of the filters with the
+// variables from the command line, the environment, the operating system and
+// the profile.
+func testFilterWhen(t *testing.T, recycled bool) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test project uses POSIX shell commands")
+	}
+	cleanup := prepareTestProject(t, filterWhenPath)
+	defer cleanup()
+	// THE TEST
+	if err := regolith.Unlock(true); err != nil {
+		t.Fatal("'regolith unlock' failed:", err.Error())
+	}
+	// Variables from the command line and the environment
+	t.Setenv("REGOLITH_TEST_WHEN", "yes")
+	variables, err := regolith.ParseRunVariables([]string{"release=true"})
+	if err != nil {
+		t.Fatal("Failed to parse the variables:", err)
+	}
+	err = regolith.RunWithOptions(
+		"default", recycled, true,
+		regolith.RunOptions{Variables: variables})
+	if err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	assertFileContains(t, "build/BP/release.txt", "release")
+	assertNotExists(t, "build/BP/debug.txt")
+	assertFileContains(t, "build/BP/os.txt", "os")
+	assertFileContains(t, "build/BP/env.txt", "env")
+	assertNotExists(t, "build/BP/watch.txt")
+
+	// Variables that aren't set
+	os.Unsetenv("REGOLITH_TEST_WHEN")
+	if err := regolith.Run("default", recycled, true); err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	assertNotExists(t, "build/BP/release.txt")
+	assertFileContains(t, "build/BP/debug.txt", "debug")
+	assertNotExists(t, "build/BP/env.txt")
+}
+
+func TestFilterWhen(t *testing.T) {
+	testFilterWhen(t, false)
+}
+
+func TestFilterWhenRecycled(t *testing.T) {
+	testFilterWhen(t, true)
+}
+
+// TestParseRunVariables tests parsing the variables from the "-v" flags.
+func TestParseRunVariables(t *testing.T) {
+	variables, err := regolith.ParseRunVariables(
+		[]string{"release=true", "target=a=b"})
+	if err != nil {
+		t.Fatal("Failed to parse the variables:", err)
+	}
+	if variables["release"] != "true" || variables["target"] != "a=b" {
+		t.Fatalf("Unexpected variables: %v", variables)
+	}
+	for _, invalid := range []string{"release", "os=linux", "my-var=1"} {
+		if _, err := regolith.ParseRunVariables([]string{invalid}); err == nil {
+			t.Fatalf("Expected an error for variable %q", invalid)
+		}
+	}
+}
@@ -133,7 +133,7 @@ func TestLocalRequirementsInstallAndRun(t *testing.T) {
 	// Switch to the working directory
 	os.Chdir(filepath.Join(tmpDir, "project"))
 	// THE TEST
-	err = regolith.InstallAll(false, true)
+	err = regolith.InstallAll(false, false, true)
 	if err != nil {
 		t.Fatal("'regolith install-all' failed", err.Error())
 	}
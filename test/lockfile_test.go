@@ -0,0 +1,62 @@
+package test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+	"github.com/otiai10/copy"
+)
+
+// TestLockfileTampering tests if running a profile with a remote filter
+// fails when the files of the installed filter don't match the hash from the
+// regolith.lock file. The filter is copied to the cache directly, because
+// the test doesn't download anything.
+func TestLockfileTampering(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test project uses POSIX shell commands")
+	}
+	filter, err := filepath.Abs(filepath.Join(lockedFilterPath, "filter"))
+	if err != nil {
+		t.Fatal("Unable to get absolute path to the test filter:", err)
+	}
+	cleanup := prepareTestProject(
+		t, filepath.Join(lockedFilterPath, "project"))
+	defer cleanup()
+	// Copy the installed filter to the working directory
+	installedFilter := filepath.Join(
+		".regolith", "cache", "filters", "locked_filter")
+	err = copy.Copy(
+		filter, installedFilter,
+		copy.Options{PreserveTimes: false, Sync: false})
+	if err != nil {
+		t.Fatalf("Failed to copy test files from %q to %q",
+			filter, installedFilter)
+	}
+	// THE TEST
+	if err := regolith.Unlock(true); err != nil {
+		t.Fatal("'regolith unlock' failed:", err.Error())
+	}
+	t.Log("Running the filter with unmodified files")
+	if err := regolith.Run("default", false, true); err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	t.Log("Running the filter after modifying its files")
+	err = ioutil.WriteFile(
+		filepath.Join(installedFilter, "filter.json"),
+		[]byte(`{"filters": [{"runWith": "shell", "command": "echo evil"}],`+
+			`"version": "1.0.0"}`), 0644)
+	if err != nil {
+		t.Fatal("Unable to modify the filter:", err)
+	}
+	err = regolith.Run("default", false, true)
+	if err == nil {
+		t.Fatal("Expected 'regolith run' to fail after modifying the filter")
+	}
+	if !strings.Contains(err.Error(), "Filter: locked_filter") {
+		t.Fatal("The error doesn't name the modified filter:", err.Error())
+	}
+}
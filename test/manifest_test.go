@@ -0,0 +1,110 @@
+package test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+)
+
+// Original UUIDs of the packs of the minimal project
+const (
+	manifestUpdateBpUuid = "96b53fd2-b7a1-4d26-b74f-1b9394c8d0bc"
+	manifestUpdateRpUuid = "6f6e3f0b-1627-488d-a9aa-2d1430ba368a"
+)
+
+// loadExportedManifest loads the manifest.json file of an exported pack.
+func loadExportedManifest(t *testing.T, packPath string) map[string]interface{} {
+	manifestPath := filepath.Join(packPath, "manifest.json")
+	data, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatalf("Failed to read %q: %s", manifestPath, err)
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatalf("Failed to parse %q: %s", manifestPath, err)
+	}
+	return result
+}
+
+// testManifestUpdate tests if the versions and the UUIDs of the packs are
+// updated according to the "manifest" property of the profile and the
+// options of the run, and if the dependency of the behavior pack on the
+// resource pack stays consistent.
+func testManifestUpdate(t *testing.T, recycled bool) {
+	cleanup := prepareTestProject(t, manifestUpdatePath)
+	defer cleanup()
+	// THE TEST
+	if err := regolith.Unlock(true); err != nil {
+		t.Fatal("'regolith unlock' failed:", err.Error())
+	}
+	checkVersions := func(expected []interface{}) {
+		bp := loadExportedManifest(t, "build/BP")
+		rp := loadExportedManifest(t, "build/RP")
+		for _, manifest := range []map[string]interface{}{bp, rp} {
+			header := manifest["header"].(map[string]interface{})
+			module := manifest["modules"].([]interface{})[0].(map[string]interface{})
+			if !reflect.DeepEqual(header["version"], expected) ||
+				!reflect.DeepEqual(module["version"], expected) {
+				t.Fatalf("Expected version %v, got:\n%v", expected, manifest)
+			}
+		}
+		dependency := bp["dependencies"].([]interface{})[0].(map[string]interface{})
+		if !reflect.DeepEqual(dependency["version"], expected) {
+			t.Fatalf("Expected dependency version %v, got %v",
+				expected, dependency["version"])
+		}
+	}
+
+	// Version from the profile
+	if err := regolith.Run("release", recycled, true); err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	checkVersions([]interface{}{2.0, 3.0, 4.0})
+
+	// Version from the options overrides the profile
+	err := regolith.RunWithOptions(
+		"release", recycled, true,
+		regolith.RunOptions{ManifestVersion: "3.0.1"})
+	if err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	checkVersions([]interface{}{3.0, 0.0, 1.0})
+
+	// New UUIDs
+	if err := regolith.Run("beta", recycled, true); err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	checkVersions([]interface{}{1.0, 0.0, 0.0})
+	bp := loadExportedManifest(t, "build/BP")
+	rp := loadExportedManifest(t, "build/RP")
+	bpUuid := bp["header"].(map[string]interface{})["uuid"]
+	rpUuid := rp["header"].(map[string]interface{})["uuid"]
+	if bpUuid == manifestUpdateBpUuid || rpUuid == manifestUpdateRpUuid {
+		t.Fatal("The UUIDs of the packs weren't changed")
+	}
+	dependency := bp["dependencies"].([]interface{})[0].(map[string]interface{})
+	if dependency["uuid"] != rpUuid {
+		t.Fatalf("Expected dependency UUID %v, got %v",
+			rpUuid, dependency["uuid"])
+	}
+	// The UUIDs are the same every time
+	if err := regolith.Run("beta", recycled, true); err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	bp = loadExportedManifest(t, "build/BP")
+	if bp["header"].(map[string]interface{})["uuid"] != bpUuid {
+		t.Fatal("The UUIDs changed between the runs of the same profile")
+	}
+}
+
+func TestManifestUpdate(t *testing.T) {
+	testManifestUpdate(t, false)
+}
+
+func TestManifestUpdateRecycled(t *testing.T) {
+	testManifestUpdate(t, true)
+}
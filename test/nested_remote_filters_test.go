@@ -0,0 +1,55 @@
+package test
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+)
+
+// TestNestedRemoteFilters tests installing and running a remote filter that
+// uses another remote filter, and detecting the cycles and the conflicts of
+// the remote filters that use other remote filters.
+func TestNestedRemoteFilters(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test project uses POSIX shell commands")
+	}
+	cleanup := prepareTestProject(t, nestedRemoteFiltersPath)
+	defer cleanup()
+	// THE TEST
+	if err := regolith.Install([]string{"./filters/outer"}, false, true); err != nil {
+		t.Fatal("'regolith install' failed:", err.Error())
+	}
+	assertFileContains(t, "regolith.lock", `"requiredBy": [`)
+	if err := regolith.Unlock(true); err != nil {
+		t.Fatal("'regolith unlock' failed:", err.Error())
+	}
+	if err := regolith.Run("default", false, true); err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	assertFileEquals(t, "build/BP/inner.txt", "inner\n")
+	assertFileEquals(t, "build/BP/outer.txt", "outer\n")
+
+	// The filters that use each other can't be installed
+	err := regolith.Install([]string{"./filters/cycle_a"}, false, true)
+	if err == nil {
+		t.Fatal("Expected 'regolith install' to fail for a cycle of filters")
+	}
+	if !strings.Contains(err.Error(), "cycle_a -> cycle_b -> cycle_a") {
+		t.Fatal("Expected the error to name the cycle of filters:", err.Error())
+	}
+
+	// The filter can't require a different version of an installed filter
+	err = regolith.Install([]string{"./filters/conflict"}, false, true)
+	if err == nil {
+		t.Fatal("Expected 'regolith install' to fail for conflicting filters")
+	}
+	for _, chain := range []string{"outer -> inner", "conflict -> inner"} {
+		if !strings.Contains(err.Error(), chain) {
+			t.Fatalf(
+				"Expected the error to name the filter chain %q:\n%s",
+				chain, err.Error())
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package test
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+	"github.com/otiai10/copy"
+)
+
+// TestOutdated tests finding the updates of the remote filters with the
+// "regolith outdated" command.
+func TestOutdated(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test project uses POSIX shell commands")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("Git is not installed")
+	}
+	cleanup := prepareTestProject(t, filterSourcesPath)
+	defer cleanup()
+	// Create a git repository with two versions of the filter
+	repo := filepath.Join(t.TempDir(), "repo")
+	err := copy.Copy(
+		"filters", repo, copy.Options{PreserveTimes: false, Sync: false})
+	if err != nil {
+		t.Fatal("Unable to create the repository:", err)
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"commit", "-q", "-m", "hello"},
+		{"tag", "hello-1.0.0"},
+		{"commit", "-q", "--allow-empty", "-m", "hello 1.1.0"},
+		{"tag", "hello-1.1.0"},
+	} {
+		args = append(
+			[]string{"-c", "user.name=test", "-c", "user.email=test@test"},
+			args...)
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		if err := cmd.Run(); err != nil {
+			t.Fatalf("'git %s' failed: %s", strings.Join(args, " "), err)
+		}
+	}
+	url := "file://" + filepath.ToSlash(repo)
+	config, err := ioutil.ReadFile("config.json")
+	if err != nil {
+		t.Fatal("Unable to read the config file:", err)
+	}
+	// setVersion sets the version of the filter in the config file
+	setVersion := func(version string) {
+		definition := `"filterDefinitions": {"hello": {"url": "` + url +
+			`", "version": "` + version + `"}}`
+		err := ioutil.WriteFile("config.json", []byte(strings.Replace(
+			string(config), `"filterDefinitions": {}`, definition, 1)), 0644)
+		if err != nil {
+			t.Fatal("Unable to write the config file:", err)
+		}
+	}
+
+	// THE TEST
+	setVersion("1.0.0")
+	if err := regolith.Outdated(true); err == nil {
+		t.Fatal("Expected 'regolith outdated' to find a newer version")
+	}
+	setVersion("1.1.0")
+	if err := regolith.Outdated(true); err != nil {
+		t.Fatal("Expected 'regolith outdated' to find no updates:", err.Error())
+	}
+
+	// The installed version is older than the latest version
+	err = regolith.Install([]string{url + "/hello==1.0.0"}, true, true)
+	if err != nil {
+		t.Fatal("'regolith install' failed:", err.Error())
+	}
+	setVersion("latest")
+	if err := regolith.Outdated(true); err == nil {
+		t.Fatal("Expected 'regolith outdated' to find a newer version")
+	}
+}
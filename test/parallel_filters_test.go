@@ -0,0 +1,66 @@
+package test
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+)
+
+// testParallelFiltersRun tests the profiles that run their filters in
+// parallel. The first filter of the valid profile waits for a file created by
+// the second filter, so the profile can succeed only if both of them run at
+// the same time. The third filter depends on the first two and merges their
+// outputs. The invalid profile has circular dependencies and should fail.
+func testParallelFiltersRun(t *testing.T, recycled bool) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test project uses POSIX shell commands")
+	}
+	expectedBuildResult, err := filepath.Abs(
+		filepath.Join(parallelFiltersPath, "expected_build_result"))
+	if err != nil {
+		t.Fatal(
+			"Unable to get absolute path to the expected build result:", err)
+	}
+	cleanup := prepareTestProject(
+		t, filepath.Join(parallelFiltersPath, "project"))
+	defer cleanup()
+	// THE TEST
+	if err := regolith.Unlock(true); err != nil {
+		t.Fatal("'regolith unlock' failed:", err.Error())
+	}
+	t.Log("Running profile with circular dependencies between the " +
+		"filters (this should fail)")
+	if err := regolith.Run(
+		"invalid_circular_dependency", recycled, true); err == nil {
+		t.Fatal("'regolith run' didn't return an error after running" +
+			" a profile with circular dependencies")
+	} else {
+		t.Log("Task failed successfully")
+	}
+	t.Log("Running profile with parallel filters")
+	if err := regolith.Run("parallel", recycled, true); err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	// Load expected result
+	expectedPaths, err := listPaths(expectedBuildResult, expectedBuildResult)
+	if err != nil {
+		t.Fatalf("Failed to load the expected results: %s", err)
+	}
+	// Load actual result
+	actualPaths, err := listPaths("build", "build")
+	if err != nil {
+		t.Fatalf("Failed to load the actual results: %s", err)
+	}
+	// Compare the results
+	comparePathMaps(expectedPaths, actualPaths, t)
+}
+
+func TestParallelFiltersRun(t *testing.T) {
+	testParallelFiltersRun(t, false)
+}
+
+func TestParallelFiltersRunRecycled(t *testing.T) {
+	testParallelFiltersRun(t, true)
+}
@@ -0,0 +1,60 @@
+package test
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+)
+
+// TestProfileExtends tests if the profiles that extend other profiles
+// inherit their filters and export targets, and if they can override the
+// export target and prepend, append or replace the filters.
+func TestProfileExtends(t *testing.T) {
+	regolith.InitLogging(true)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal("Unable to get current working directory")
+	}
+	defer os.Chdir(wd)
+	os.Chdir(profileExtendsPath)
+	configJson, err := regolith.LoadConfigAsMap()
+	if err != nil {
+		t.Fatal("Unable to load the config file:", err)
+	}
+	config, err := regolith.ConfigFromObject(configJson)
+	if err != nil {
+		t.Fatal("Unable to parse the config file:", err)
+	}
+	for _, expected := range []struct {
+		profile string
+		filters []string
+		target  string
+	}{
+		{"default", []string{"generate"}, "development"},
+		{"release", []string{"generate", "minify"}, "local"},
+		{"release_with_docs", []string{"docs", "generate", "minify"}, "local"},
+		{"docs_only", []string{"docs"}, "development"},
+	} {
+		profile, ok := config.Profiles[expected.profile]
+		if !ok {
+			t.Fatalf("Profile %q is missing", expected.profile)
+		}
+		filters := []string{}
+		for _, filter := range profile.Filters {
+			filters = append(filters, filter.GetId())
+		}
+		if !reflect.DeepEqual(filters, expected.filters) {
+			t.Fatalf("Expected filters %v in profile %q, got %v",
+				expected.filters, expected.profile, filters)
+		}
+		if profile.ExportTargets[0].Target != expected.target {
+			t.Fatalf("Expected export target %q in profile %q, got %q",
+				expected.target, expected.profile, profile.ExportTargets[0].Target)
+		}
+	}
+	if err := regolith.ConfigShow("release_with_docs", true); err != nil {
+		t.Fatal("'regolith config show' failed:", err)
+	}
+}
@@ -0,0 +1,50 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+)
+
+// testProfileSources tests the profiles that override the source folders of
+// the packs and the data path, and the profiles with extra source folders.
+func testProfileSources(t *testing.T, recycled bool) {
+	cleanup := prepareTestProject(t, profileSourcesPath)
+	defer cleanup()
+	// THE TEST
+	if err := regolith.Unlock(true); err != nil {
+		t.Fatal("'regolith unlock' failed:", err.Error())
+	}
+	// Overridden behavior pack folder
+	if err := regolith.Run("marketplace", recycled, true); err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	assertFileContains(t, "build/BP/variant.json", "marketplace")
+	assertFileContains(t, "build/RP/manifest.json", "Regolith Test RP")
+
+	// Extra packs merged in order and overridden data path
+	if err := regolith.Run("free", recycled, true); err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	assertFileContains(t, "build/BP/variant.json", "seasonal")
+	assertFileContains(t, "build/BP/free.json", "free")
+	assertFileContains(t, "build/BP/manifest.json", "Regolith Test BP")
+	assertFileContains(t, "build/RP/seasonal.json", "seasonal")
+	assertFileContains(t, "build/RP/manifest.json", "Regolith Test RP")
+	// The data is saved only to the data path of the profile
+	assertFileContains(t, "variants/free/data/free_data.json", "free")
+	assertNotExists(t, "variants/free/data/main_data.json")
+	assertFileContains(t, "packs/data/main_data.json", "main")
+	assertNotExists(t, "packs/data/free_data.json")
+	// The extra folders aren't modified
+	assertNotExists(t, "variants/free/BP/manifest.json")
+	assertFileContains(t, "variants/free/BP/variant.json", "free")
+}
+
+func TestProfileSources(t *testing.T) {
+	testProfileSources(t, false)
+}
+
+func TestProfileSourcesRecycled(t *testing.T) {
+	testProfileSources(t, true)
+}
@@ -36,6 +36,8 @@ func TestInstallAllUnlockAndRun(t *testing.T) {
 	t.Log("Created temporary directory:", tmpDir)
 	// Before deleting "workingDir" the test must stop using it
 	defer os.RemoveAll(tmpDir)
+	// Use a temporary user cache directory for the filter store
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(tmpDir, "cache"))
 	defer os.Chdir(wd)
 	workingDir := filepath.Join(tmpDir, "working-dir")
 	os.Mkdir(workingDir, 0755)
@@ -55,7 +57,7 @@ func TestInstallAllUnlockAndRun(t *testing.T) {
 	os.Chdir(workingDir)
 	// THE TEST
 	// Run InstallDependencies
-	err = regolith.InstallAll(false, true)
+	err = regolith.InstallAll(false, false, true)
 	if err != nil {
 		t.Fatal("'regolith install-all' failed:", err)
 	}
@@ -85,6 +87,8 @@ func TestInstall(t *testing.T) {
 	defer os.Chdir(wd) // Go back before the test ends
 	tmpDir, err2 := ioutil.TempDir("", "regolith-test")
 	defer os.RemoveAll(tmpDir)
+	// Use a temporary user cache directory for the filter store
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(tmpDir, "cache"))
 	defer os.Chdir(wd) // 'tmpDir' can't be used when we delete it
 	err3 := copy.Copy( // Copy the test files
 		freshProjectPath,
@@ -143,6 +147,8 @@ func TestUpdateAndUpdateAll(t *testing.T) {
 	defer os.Chdir(wd) // Go back before the test ends
 	tmpDir, err2 := ioutil.TempDir("", "regolith-test")
 	defer os.RemoveAll(tmpDir)
+	// Use a temporary user cache directory for the filter store
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(tmpDir, "cache"))
 	defer os.Chdir(wd) // 'tmpDir' can't be used when we delete it
 	err3 := copy.Copy( // Copy the test files
 		freshProjectPath,
@@ -175,7 +181,7 @@ func TestUpdateAndUpdateAll(t *testing.T) {
 		},
 		"update-all": func(_ []string) error {
 			// UpdateAll doesn't use the "filters" argument
-			return regolith.UpdateAll(true)
+			return regolith.UpdateAll(false, true)
 		},
 	}
 	for updateFunctionName, updateFunction := range updateFunctions {
@@ -0,0 +1,31 @@
+package test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+)
+
+// TestShellArguments tests passing the settings and the arguments with
+// spaces and quotes to the shell filters, as arguments of the command, in
+// an environment variable and in a temporary file.
+func TestShellArguments(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test project uses POSIX shell commands")
+	}
+	cleanup := prepareTestProject(t, shellArgumentsPath)
+	defer cleanup()
+	// THE TEST
+	if err := regolith.Unlock(true); err != nil {
+		t.Fatal("'regolith unlock' failed:", err.Error())
+	}
+	if err := regolith.Run("default", false, true); err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	settings := `{"message":"Hello \"World\"! It's $HOME \u0026 more"}`
+	assertFileEquals(
+		t, "build/BP/arguments.txt", settings+"|two words|it's|")
+	assertFileEquals(t, "build/BP/env.json", settings)
+	assertFileEquals(t, "build/BP/file.json", settings)
+}
@@ -0,0 +1,41 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+)
+
+// TestShellCommandLine tests the command lines of the shells that run the
+// commands of the shell filters on Windows, with the arguments with spaces,
+// quotes and the special characters of the shells.
+func TestShellCommandLine(t *testing.T) {
+	args := []string{"a b", `say "hi"`, "100%", "plain"}
+	for _, tc := range []struct {
+		shell, shellArg, expected string
+	}{
+		{
+			"cmd", "/k",
+			`cmd /s /k "echo ^"a b^" ^"say \^"hi\^"^" ^"100^%^" plain"`,
+		},
+		{
+			"powershell", "-command",
+			`powershell -command "echo 'a b' 'say \\\"hi\\\"' '100%' plain"`,
+		},
+		{
+			"bash", "-c",
+			`bash -c "echo 'a b' 'say \"hi\"' '100%' plain"`,
+		},
+		{
+			"sh", "-c",
+			`sh -c "echo 'a b' 'say \"hi\"' '100%' plain"`,
+		},
+	} {
+		commandLine := regolith.ShellCommandLine(
+			tc.shell, tc.shellArg, "echo", args)
+		if commandLine != tc.expected {
+			t.Errorf("Unexpected command line of %s:\nExpected: %s\nActual:   %s",
+				tc.shell, tc.expected, commandLine)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+//go:build !windows
+// +build !windows
+
+package test
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+)
+
+// TestInstallSubProcessInterrupt tests if the sub-processes that can't be
+// canceled by Regolith, like the installations of the dependencies of the
+// filters, run in the process group of Regolith, so Ctrl+C from the
+// terminal stops them too.
+func TestInstallSubProcessInterrupt(t *testing.T) {
+	regolith.InitLogging(true)
+	tmpDir := t.TempDir()
+	pgidPath := filepath.Join(tmpDir, "pgid.txt")
+	err := regolith.RunSubProcess(
+		"sh", []string{"-c", "ps -o pgid= -p $$ > " + pgidPath},
+		tmpDir, tmpDir, "install")
+	if err != nil {
+		t.Fatal("Failed to run the sub-process:", err.Error())
+	}
+	data, err := ioutil.ReadFile(pgidPath)
+	if err != nil {
+		t.Fatal("Unable to read the process group of the sub-process:", err)
+	}
+	pgid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatalf("Invalid process group of the sub-process: %q", data)
+	}
+	if pgid != syscall.Getpgrp() {
+		t.Fatalf(
+			"Expected the sub-process to run in the process group of "+
+				"Regolith (%d), got %d", syscall.Getpgrp(), pgid)
+	}
+}
+
+// TestSubProcessCancel tests if canceling the context of a sub-process
+// kills the sub-process and its children.
+func TestSubProcessCancel(t *testing.T) {
+	regolith.InitLogging(true)
+	tmpDir := t.TempDir()
+	alivePath := filepath.Join(tmpDir, "alive.txt")
+	ctx, cancel := context.WithTimeout(
+		context.Background(), 500*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := regolith.RunSubProcessContext(
+		ctx, "sh",
+		[]string{"-c", "(sleep 2; echo alive > " + alivePath + ") & wait"},
+		tmpDir, tmpDir, "install")
+	if err == nil {
+		t.Fatal("Expected the canceled sub-process to fail")
+	}
+	if duration := time.Since(start); duration > 2*time.Second {
+		t.Fatalf("The sub-process wasn't killed after canceling (%s)", duration)
+	}
+	// The child would write the file if it wasn't killed
+	time.Sleep(3 * time.Second)
+	assertNotExists(t, alivePath)
+}
@@ -0,0 +1,103 @@
+package test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+)
+
+// testTrace tests saving the states of the tmp directory after every filter
+// with the Trace option and inspecting them with the "regolith trace"
+// commands.
+func testTrace(t *testing.T, recycled bool) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test project uses POSIX shell commands")
+	}
+	cleanup := prepareTestProject(t, tracePath)
+	defer cleanup()
+	// THE TEST
+	if err := regolith.Unlock(true); err != nil {
+		t.Fatal("'regolith unlock' failed:", err.Error())
+	}
+	err := regolith.RunWithOptions(
+		"default", recycled, true, regolith.RunOptions{Trace: true})
+	if err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+
+	// The stages of the trace
+	tracePath := ".regolith/cache/trace"
+	data, err := ioutil.ReadFile(filepath.Join(tracePath, "trace.json"))
+	if err != nil {
+		t.Fatal("Failed to read the trace:", err)
+	}
+	var info struct {
+		Stages []struct {
+			Name string `json:"name"`
+			Path string `json:"path"`
+		} `json:"stages"`
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		t.Fatal("Failed to parse the trace:", err)
+	}
+	expectedStages := []string{"setup", "create", "append", "remove"}
+	if len(info.Stages) != len(expectedStages) {
+		t.Fatalf("Expected %d stages, got %d", len(expectedStages), len(info.Stages))
+	}
+	for i, name := range expectedStages {
+		if info.Stages[i].Name != name {
+			t.Fatalf("Expected stage %d to be %q, got %q", i, name, info.Stages[i].Name)
+		}
+	}
+	stage := func(i int, path string) string {
+		return filepath.Join(tracePath, info.Stages[i].Path, path)
+	}
+	assertNotExists(t, stage(0, "BP/log.txt"))
+	assertFileEquals(t, stage(1, "BP/log.txt"), "a\n")
+	assertFileEquals(t, stage(1, "BP/temp.txt"), "temp\n")
+	assertFileEquals(t, stage(2, "BP/log.txt"), "a\nb\n")
+	assertNotExists(t, stage(3, "BP/temp.txt"))
+
+	// The files that didn't change are shared between the stages
+	stat1, err1 := os.Stat(stage(0, "BP/manifest.json"))
+	stat2, err2 := os.Stat(stage(3, "BP/manifest.json"))
+	if err1 != nil || err2 != nil {
+		t.Fatal("Failed to read the manifest from the trace")
+	}
+	if !os.SameFile(stat1, stat2) {
+		t.Fatal("Expected the unchanged file to be hard linked between the stages")
+	}
+
+	// The trace commands
+	if err := regolith.Trace(true); err != nil {
+		t.Fatal("'regolith trace' failed:", err.Error())
+	}
+	if err := regolith.TraceFile("BP/temp.txt", true); err != nil {
+		t.Fatal("'regolith trace file' failed:", err.Error())
+	}
+	if err := regolith.TraceDiff("setup", "remove", "", true); err != nil {
+		t.Fatal("'regolith trace diff' failed:", err.Error())
+	}
+	if err := regolith.TraceDiff("1", "append", "BP/log.txt", true); err != nil {
+		t.Fatal("'regolith trace diff' with a path failed:", err.Error())
+	}
+	if err := regolith.TraceDiff("0", "unknown", "", true); err == nil {
+		t.Fatal("Expected 'regolith trace diff' to fail for an unknown stage")
+	}
+}
+
+// TestTrace tests the Trace option of the run command.
+func TestTrace(t *testing.T) {
+	testTrace(t, false)
+}
+
+// TestTraceRecycled tests the Trace option of the run command with the
+// recycled version of the run function.
+func TestTraceRecycled(t *testing.T) {
+	testTrace(t, true)
+}
@@ -0,0 +1,61 @@
+package test
+
+import (
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+)
+
+// TestValidateConfig tests if ValidateConfig reports all of the problems of
+// the invalid config file with their JSON paths and if the valid project
+// passes the validation.
+func TestValidateConfig(t *testing.T) {
+	regolith.InitLogging(true)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal("Unable to get current working directory")
+	}
+	defer os.Chdir(wd)
+	os.Chdir(invalidConfigPath)
+	config, err := regolith.LoadConfigAsMap()
+	if err != nil {
+		t.Fatal("Unable to load the config file:", err)
+	}
+	problems := regolith.ValidateConfig(config)
+	actual := []string{}
+	for _, problem := range problems {
+		t.Logf("%s: %s", problem.JsonPath, problem.Err.Error())
+		actual = append(actual, problem.JsonPath)
+	}
+	sort.Strings(actual)
+	expected := []string{
+		"regolith->dataPath",
+		"regolith->filterDefinitions->invalid_run_with",
+		"regolith->profiles->circular_1->filters->0",
+		"regolith->profiles->circular_2->filters->0",
+		"regolith->profiles->extends_cycle_1",
+		"regolith->profiles->extends_cycle_2",
+		"regolith->profiles->undefined_filter->filters->0",
+		"regolith->profiles->world_name_and_path->export",
+	}
+	if len(actual) != len(expected) {
+		t.Fatalf("Expected problems at %v, got %v", expected, actual)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Fatalf("Expected problems at %v, got %v", expected, actual)
+		}
+	}
+	if err := regolith.Validate(true); err == nil {
+		t.Fatal("'regolith validate' didn't fail for an invalid config")
+	}
+
+	// The valid project
+	os.Chdir(wd)
+	os.Chdir(minimalProjectPath)
+	if err := regolith.Validate(true); err != nil {
+		t.Fatal("'regolith validate' failed for a valid config:", err)
+	}
+}
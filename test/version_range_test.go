@@ -0,0 +1,186 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Bedrock-OSS/regolith/regolith"
+	"github.com/otiai10/copy"
+)
+
+// createVersionRangeRepository creates a git repository with the "hello"
+// filter from the "filters" directory of the working directory in versions
+// 1.0.0, 1.2.0 and 2.0.0 and with the "uses_caret", "uses_exact" and
+// "uses_major" filters, which use the "hello" filter with the "^1.0",
+// "1.0.0" and "^2.0" versions. It returns the URL of the repository.
+func createVersionRangeRepository(t *testing.T) string {
+	repo := filepath.Join(t.TempDir(), "repo")
+	url := "file://" + filepath.ToSlash(repo)
+	err := copy.Copy(
+		"filters", repo, copy.Options{PreserveTimes: false, Sync: false})
+	if err != nil {
+		t.Fatal("Unable to create the repository:", err)
+	}
+	for name, version := range map[string]string{
+		"uses_caret": "^1.0", "uses_exact": "1.0.0", "uses_major": "^2.0",
+	} {
+		err := os.MkdirAll(filepath.Join(repo, name), 0755)
+		if err != nil {
+			t.Fatal("Unable to create the filter:", err)
+		}
+		err = ioutil.WriteFile(
+			filepath.Join(repo, name, "filter.json"),
+			[]byte(`{"filters": [{"filter": "hello", "url": "`+url+
+				`", "version": "`+version+`"}]}`), 0644)
+		if err != nil {
+			t.Fatal("Unable to create the filter:", err)
+		}
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"commit", "-q", "-m", "hello"},
+		{"tag", "hello-1.0.0"},
+		{"commit", "-q", "--allow-empty", "-m", "hello 1.2.0"},
+		{"tag", "hello-1.2.0"},
+		{"commit", "-q", "--allow-empty", "-m", "hello 2.0.0"},
+		{"tag", "hello-2.0.0"},
+	} {
+		args = append(
+			[]string{"-c", "user.name=test", "-c", "user.email=test@test"},
+			args...)
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		if err := cmd.Run(); err != nil {
+			t.Fatalf("'git %s' failed: %s", strings.Join(args, " "), err)
+		}
+	}
+	return url
+}
+
+// TestVersionRange tests installing, running and updating a remote filter
+// with a semver range as its version.
+func TestVersionRange(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test project uses POSIX shell commands")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("Git is not installed")
+	}
+	cleanup := prepareTestProject(t, filterSourcesPath)
+	defer cleanup()
+	url := createVersionRangeRepository(t)
+	// assertLockedRef checks the tag of the filter from the lock file
+	assertLockedRef := func(expected string) {
+		lockfile, err := regolith.LoadLockfile()
+		if err != nil {
+			t.Fatal("Unable to load the lock file:", err.Error())
+		}
+		if ref := lockfile.Filters["hello"].Ref; ref != expected {
+			t.Fatalf("Expected the filter to be locked to %q, got %q",
+				expected, ref)
+		}
+	}
+
+	// THE TEST
+	// Install the highest version in the range
+	err := regolith.Install([]string{url + "/hello==^1.0"}, false, true)
+	if err != nil {
+		t.Fatal("'regolith install' failed:", err.Error())
+	}
+	assertLockedRef("hello-1.2.0")
+	assertFileContains(t, "config.json", `"version": "^1.0"`)
+	// The installed version satisfies the range
+	if err := regolith.Unlock(true); err != nil {
+		t.Fatal("'regolith unlock' failed:", err.Error())
+	}
+	if err := regolith.Run("default", false, true); err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	assertFileEquals(t, "build/BP/hello.txt", "hello\n")
+	// The version outside of the range is an available update
+	if err := regolith.Outdated(true); err == nil {
+		t.Fatal("Expected 'regolith outdated' to find a newer version")
+	}
+
+	// Update within the range
+	if err := regolith.UpdateAll(false, true); err != nil {
+		t.Fatal("'regolith update-all' failed:", err.Error())
+	}
+	assertLockedRef("hello-1.2.0")
+	assertFileContains(t, "config.json", `"version": "^1.0"`)
+
+	// Update to the next major version
+	if err := regolith.UpdateAll(true, true); err != nil {
+		t.Fatal("'regolith update-all --major' failed:", err.Error())
+	}
+	assertLockedRef("hello-2.0.0")
+	assertFileContains(t, "config.json", `"version": "^2.0.0"`)
+	if err := regolith.Outdated(true); err != nil {
+		t.Fatal("Expected 'regolith outdated' to find no updates:", err.Error())
+	}
+}
+
+// TestVersionRangeConflicts tests installing a filter used by multiple
+// remote filters that require different, but compatible versions of it, and
+// detecting the versions that aren't compatible.
+func TestVersionRangeConflicts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test project uses POSIX shell commands")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("Git is not installed")
+	}
+	cleanup := prepareTestProject(t, filterSourcesPath)
+	defer cleanup()
+	url := createVersionRangeRepository(t)
+	// Run the filters that use the "hello" filter instead of the "hello"
+	// filter
+	config, err := ioutil.ReadFile("config.json")
+	if err != nil {
+		t.Fatal("Unable to read the config file:", err)
+	}
+	err = ioutil.WriteFile("config.json", []byte(strings.Replace(
+		string(config), `"filter": "hello"`,
+		`"filter": "uses_caret"}, {"filter": "uses_exact"`, 1)), 0644)
+	if err != nil {
+		t.Fatal("Unable to write the config file:", err)
+	}
+
+	// THE TEST
+	// Version 1.0.0 satisfies both "^1.0" and "1.0.0"
+	err = regolith.Install(
+		[]string{url + "/uses_caret", url + "/uses_exact"}, false, true)
+	if err != nil {
+		t.Fatal("'regolith install' failed:", err.Error())
+	}
+	lockfile, err := regolith.LoadLockfile()
+	if err != nil {
+		t.Fatal("Unable to load the lock file:", err.Error())
+	}
+	if ref := lockfile.Filters["hello"].Ref; ref != "hello-1.0.0" {
+		t.Fatalf("Expected the filter to be locked to %q, got %q",
+			"hello-1.0.0", ref)
+	}
+	if err := regolith.Unlock(true); err != nil {
+		t.Fatal("'regolith unlock' failed:", err.Error())
+	}
+	if err := regolith.Run("default", false, true); err != nil {
+		t.Fatal("'regolith run' failed:", err.Error())
+	}
+	assertFileEquals(t, "build/BP/hello.txt", "hello\n")
+
+	// No version satisfies both "1.0.0" and "^2.0"
+	err = regolith.Install([]string{url + "/uses_major"}, false, true)
+	if err == nil {
+		t.Fatal("Expected 'regolith install' to fail for conflicting filters")
+	}
+	if !strings.Contains(err.Error(), "different versions") {
+		t.Fatal("Expected the error to report the conflict:", err.Error())
+	}
+}